@@ -0,0 +1,118 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+var checkCommand = cli.Command{
+	Name:  "check",
+	Usage: "check CRI endpoint health, exits non-zero when unhealthy",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "endpoint",
+			Usage: "CRI endpoint to check",
+			Value: "unix:///run/containerd/containerd.sock",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "timeout for the whole check",
+			Value: 10 * time.Second,
+		},
+	},
+	Action: func(cliCtx *cli.Context) error {
+		ctx, cancel := context.WithTimeout(context.Background(), cliCtx.Duration("timeout"))
+		defer cancel()
+		conn, err := dialEndpoint(ctx, cliCtx.String("endpoint"))
+		if err != nil {
+			return errors.Wrapf(err, "failed to connect CRI endpoint %q", cliCtx.String("endpoint"))
+		}
+		defer conn.Close()
+		return healthCheck(ctx, runtime.NewRuntimeServiceClient(conn), os.Stdout)
+	},
+}
+
+// dialEndpoint connects to a CRI endpoint. Only unix endpoints are
+// supported, either as "unix:///path" or as a plain socket path.
+func dialEndpoint(ctx context.Context, endpoint string) (*grpc.ClientConn, error) {
+	addr := strings.TrimPrefix(endpoint, "unix://")
+	return grpc.DialContext(ctx, addr,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	)
+}
+
+// healthCheck calls `Version` and `Status` on the runtime service and writes
+// a concise pass/fail report. It returns an error when the runtime or its
+// network is not ready, so that the command exits non-zero and can be used
+// as a readiness probe.
+func healthCheck(ctx context.Context, client runtime.RuntimeServiceClient, out io.Writer) error {
+	version, err := client.Version(ctx, &runtime.VersionRequest{})
+	if err != nil {
+		return errors.Wrap(err, "failed to get runtime version")
+	}
+	fmt.Fprintf(out, "runtime: %s %s (CRI %s)\n",
+		version.GetRuntimeName(), version.GetRuntimeVersion(), version.GetRuntimeApiVersion())
+
+	status, err := client.Status(ctx, &runtime.StatusRequest{})
+	if err != nil {
+		return errors.Wrap(err, "failed to get runtime status")
+	}
+	required := map[string]bool{
+		runtime.RuntimeReady: false,
+		runtime.NetworkReady: false,
+	}
+	for _, cond := range status.GetStatus().GetConditions() {
+		if cond.GetStatus() {
+			fmt.Fprintf(out, "%s: ok\n", cond.GetType())
+		} else {
+			fmt.Fprintf(out, "%s: not ready (%s: %s)\n", cond.GetType(), cond.GetReason(), cond.GetMessage())
+		}
+		if _, ok := required[cond.GetType()]; ok {
+			required[cond.GetType()] = cond.GetStatus()
+		}
+	}
+	var failed []string
+	for typ, ok := range required {
+		if !ok {
+			failed = append(failed, typ)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		fmt.Fprintln(out, "FAIL")
+		return errors.Errorf("unhealthy runtime conditions: %s", strings.Join(failed, ", "))
+	}
+	fmt.Fprintln(out, "PASS")
+	return nil
+}
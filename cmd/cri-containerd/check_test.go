@@ -0,0 +1,197 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// fakeRuntimeServer is a fake CRI runtime service only serving `Version`
+// and `Status` with configurable conditions.
+type fakeRuntimeServer struct {
+	runtime.UnimplementedRuntimeServiceServer
+	conditions []*runtime.RuntimeCondition
+	containers []*runtime.Container
+}
+
+func (f *fakeRuntimeServer) Version(context.Context, *runtime.VersionRequest) (*runtime.VersionResponse, error) {
+	return &runtime.VersionResponse{
+		RuntimeName:       "containerd",
+		RuntimeVersion:    "test",
+		RuntimeApiVersion: "v1alpha2",
+	}, nil
+}
+
+func (f *fakeRuntimeServer) Status(context.Context, *runtime.StatusRequest) (*runtime.StatusResponse, error) {
+	return &runtime.StatusResponse{
+		Status: &runtime.RuntimeStatus{Conditions: f.conditions},
+	}, nil
+}
+
+// startFakeCRIServer serves the fake runtime and image services on a unix
+// socket and returns the endpoint.
+func startFakeCRIServer(t *testing.T, fakeRuntime runtime.RuntimeServiceServer, fakeImage runtime.ImageServiceServer) string {
+	tmpDir, err := ioutil.TempDir("", "cri-containerd-check")
+	require.NoError(t, err)
+	socket := filepath.Join(tmpDir, "cri.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	if fakeRuntime != nil {
+		runtime.RegisterRuntimeServiceServer(server, fakeRuntime)
+	}
+	if fakeImage != nil {
+		runtime.RegisterImageServiceServer(server, fakeImage)
+	}
+	go server.Serve(listener) // nolint: errcheck
+	t.Cleanup(func() {
+		server.Stop()
+		os.RemoveAll(tmpDir)
+	})
+	return "unix://" + socket
+}
+
+func TestHealthCheck(t *testing.T) {
+	readyCondition := func(typ string, ready bool) *runtime.RuntimeCondition {
+		cond := &runtime.RuntimeCondition{Type: typ, Status: ready}
+		if !ready {
+			cond.Reason = "TestNotReady"
+			cond.Message = "injected failure"
+		}
+		return cond
+	}
+	for desc, test := range map[string]struct {
+		conditions  []*runtime.RuntimeCondition
+		expectedErr string
+	}{
+		"should pass when all conditions are true": {
+			conditions: []*runtime.RuntimeCondition{
+				readyCondition(runtime.RuntimeReady, true),
+				readyCondition(runtime.NetworkReady, true),
+			},
+		},
+		"should fail when the network is not ready": {
+			conditions: []*runtime.RuntimeCondition{
+				readyCondition(runtime.RuntimeReady, true),
+				readyCondition(runtime.NetworkReady, false),
+			},
+			expectedErr: "unhealthy runtime conditions: NetworkReady",
+		},
+		"should fail when a required condition is missing": {
+			conditions: []*runtime.RuntimeCondition{
+				readyCondition(runtime.NetworkReady, true),
+			},
+			expectedErr: "unhealthy runtime conditions: RuntimeReady",
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		endpoint := startFakeCRIServer(t, &fakeRuntimeServer{conditions: test.conditions}, nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		conn, err := dialEndpoint(ctx, endpoint)
+		require.NoError(t, err)
+		out := new(bytes.Buffer)
+		err = healthCheck(ctx, runtime.NewRuntimeServiceClient(conn), out)
+		assert.Contains(t, out.String(), "runtime: containerd test (CRI v1alpha2)")
+		if test.expectedErr != "" {
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expectedErr)
+			assert.Contains(t, out.String(), "FAIL")
+		} else {
+			assert.NoError(t, err)
+			assert.Contains(t, out.String(), "PASS")
+		}
+		conn.Close()
+		cancel()
+	}
+}
+
+func (f *fakeRuntimeServer) ListContainers(context.Context, *runtime.ListContainersRequest) (*runtime.ListContainersResponse, error) {
+	return &runtime.ListContainersResponse{Containers: f.containers}, nil
+}
+
+// fakeImageServer is a fake CRI image service serving a fixed image list
+// and recording image removals.
+type fakeImageServer struct {
+	runtime.UnimplementedImageServiceServer
+	images  []*runtime.Image
+	removed []string
+}
+
+func (f *fakeImageServer) ListImages(context.Context, *runtime.ListImagesRequest) (*runtime.ListImagesResponse, error) {
+	return &runtime.ListImagesResponse{Images: f.images}, nil
+}
+
+func (f *fakeImageServer) RemoveImage(_ context.Context, r *runtime.RemoveImageRequest) (*runtime.RemoveImageResponse, error) {
+	f.removed = append(f.removed, r.GetImage().GetImage())
+	return &runtime.RemoveImageResponse{}, nil
+}
+
+func TestPruneImages(t *testing.T) {
+	newFakes := func() (*fakeRuntimeServer, *fakeImageServer) {
+		fakeRuntime := &fakeRuntimeServer{
+			containers: []*runtime.Container{
+				{Id: "container-1", ImageRef: "sha256:used"},
+			},
+		}
+		fakeImage := &fakeImageServer{
+			images: []*runtime.Image{
+				{Id: "sha256:tagged", RepoTags: []string{"example.com/app:latest"}, Size_: 100},
+				{Id: "sha256:used", Size_: 200},
+				{Id: "sha256:dangling-1", Size_: 300},
+				{Id: "sha256:dangling-2", Size_: 400},
+			},
+		}
+		return fakeRuntime, fakeImage
+	}
+
+	t.Logf("dry-run should list candidates without removing them")
+	fakeRuntime, fakeImage := newFakes()
+	endpoint := startFakeCRIServer(t, fakeRuntime, fakeImage)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := dialEndpoint(ctx, endpoint)
+	require.NoError(t, err)
+	defer conn.Close()
+	out := new(bytes.Buffer)
+	require.NoError(t, pruneImages(ctx, runtime.NewImageServiceClient(conn),
+		runtime.NewRuntimeServiceClient(conn), true, out))
+	assert.Empty(t, fakeImage.removed)
+	assert.Contains(t, out.String(), "would remove sha256:dangling-1 (300 bytes)")
+	assert.Contains(t, out.String(), "would remove sha256:dangling-2 (400 bytes)")
+	assert.Contains(t, out.String(), "would reclaim 700 bytes from 2 images")
+	assert.NotContains(t, out.String(), "sha256:tagged")
+	assert.NotContains(t, out.String(), "sha256:used")
+
+	t.Logf("a real run should remove each candidate")
+	out.Reset()
+	require.NoError(t, pruneImages(ctx, runtime.NewImageServiceClient(conn),
+		runtime.NewRuntimeServiceClient(conn), false, out))
+	assert.Equal(t, []string{"sha256:dangling-1", "sha256:dangling-2"}, fakeImage.removed)
+	assert.Contains(t, out.String(), "reclaimed 700 bytes from 2 images")
+}
@@ -0,0 +1,141 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	criconfig "github.com/containerd/cri/pkg/config"
+)
+
+var configCommand = cli.Command{
+	Name:  "config",
+	Usage: "manage CRI plugin configuration",
+	Subcommands: []cli.Command{
+		configValidateCommand,
+	},
+}
+
+var configValidateCommand = cli.Command{
+	Name:  "validate",
+	Usage: "validate a CRI plugin config file, exits non-zero on any problem",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "config",
+			Usage: "path to the CRI plugin config file (toml)",
+		},
+		cli.StringFlag{
+			Name:  "endpoint",
+			Usage: "containerd CRI endpoint whose reachability should be checked, empty to skip",
+		},
+	},
+	Action: func(cliCtx *cli.Context) error {
+		path := cliCtx.String("config")
+		if path == "" {
+			return errors.New("--config is required")
+		}
+		config := criconfig.DefaultConfig()
+		if _, err := toml.DecodeFile(path, &config); err != nil {
+			return errors.Wrapf(err, "failed to load config file %q", path)
+		}
+		problems := diagnoseConfig(&config, cliCtx.String("endpoint"))
+		reportProblems(problems, os.Stdout)
+		if len(problems) > 0 {
+			return errors.Errorf("config has %d problem(s)", len(problems))
+		}
+		return nil
+	},
+}
+
+// diagnoseConfig checks the config for problems which would only surface at
+// runtime, and returns one actionable message per problem. When endpoint is
+// not empty, its reachability is checked as well.
+func diagnoseConfig(config *criconfig.PluginConfig, endpoint string) []string {
+	var problems []string
+	if endpoint != "" {
+		addr := strings.TrimPrefix(endpoint, "unix://")
+		conn, err := net.DialTimeout("unix", addr, 2*time.Second)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf(
+				"containerd endpoint %q is unreachable: %v, check that containerd is running", endpoint, err))
+		} else {
+			conn.Close()
+		}
+	}
+	for desc, dir := range map[string]string{
+		"cni bin dir":  config.NetworkPluginBinDir,
+		"cni conf dir": config.NetworkPluginConfDir,
+	} {
+		if _, err := os.Stat(dir); err != nil {
+			problems = append(problems, fmt.Sprintf(
+				"%s %q is not accessible: %v, pod networking will not become ready", desc, dir, err))
+		}
+	}
+	for host, registry := range config.Registry.Configs {
+		if registry.TLS == nil || registry.TLS.CAFile == "" {
+			continue
+		}
+		if _, err := ioutil.ReadFile(registry.TLS.CAFile); err != nil {
+			problems = append(problems, fmt.Sprintf(
+				"registry CA file %q for %q is not readable: %v, pulls from that registry will fail", registry.TLS.CAFile, host, err))
+		}
+	}
+	if _, err := docker.ParseDockerRef(config.SandboxImage); err != nil {
+		problems = append(problems, fmt.Sprintf(
+			"invalid sandbox image %q: %v", config.SandboxImage, err))
+	}
+	if config.DefaultRuntimeName != "" && config.DefaultRuntime.Type != "" {
+		problems = append(problems,
+			"conflicting runtime configuration: both `default_runtime_name` and the deprecated `default_runtime` are set, use `default_runtime_name` only")
+	}
+	if config.UntrustedWorkloadRuntime.Type != "" {
+		if _, ok := config.Runtimes[criconfig.RuntimeUntrusted]; ok {
+			problems = append(problems, fmt.Sprintf(
+				"conflicting runtime configuration: both the deprecated `untrusted_workload_runtime` and `runtimes[%q]` are set", criconfig.RuntimeUntrusted))
+		}
+	}
+	if config.DefaultRuntimeName != "" {
+		if _, ok := config.Runtimes[config.DefaultRuntimeName]; !ok {
+			problems = append(problems, fmt.Sprintf(
+				"default runtime handler %q has no entry in the runtimes table", config.DefaultRuntimeName))
+		}
+	}
+	return problems
+}
+
+// reportProblems prints one line per problem, or a pass message when there
+// is none.
+func reportProblems(problems []string, out io.Writer) {
+	if len(problems) == 0 {
+		fmt.Fprintln(out, "config OK")
+		return
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(out, "problem: %s\n", problem)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	criconfig "github.com/containerd/cri/pkg/config"
+)
+
+func TestDiagnoseConfig(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "config-validate")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	binDir := filepath.Join(tmpDir, "cni-bin")
+	confDir := filepath.Join(tmpDir, "cni-conf")
+	require.NoError(t, os.MkdirAll(binDir, 0755))
+	require.NoError(t, os.MkdirAll(confDir, 0755))
+	caFile := filepath.Join(tmpDir, "registry-ca.crt")
+	require.NoError(t, ioutil.WriteFile(caFile, []byte("ca"), 0600))
+	socket := filepath.Join(tmpDir, "containerd.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	newValidConfig := func() *criconfig.PluginConfig {
+		config := criconfig.DefaultConfig()
+		config.NetworkPluginBinDir = binDir
+		config.NetworkPluginConfDir = confDir
+		config.DefaultRuntimeName = "runc"
+		config.Runtimes = map[string]criconfig.Runtime{
+			"runc": {Type: "io.containerd.runc.v2"},
+		}
+		config.Registry.Configs = map[string]criconfig.RegistryConfig{
+			"registry.example.com": {TLS: &criconfig.TLSConfig{CAFile: caFile}},
+		}
+		return &config
+	}
+
+	t.Logf("a valid config should have no problems")
+	assert.Empty(t, diagnoseConfig(newValidConfig(), "unix://"+socket))
+
+	for desc, test := range map[string]struct {
+		endpoint        string
+		breakConfig     func(config *criconfig.PluginConfig)
+		expectedProblem string
+	}{
+		"should report an unreachable containerd endpoint": {
+			endpoint:        "unix://" + filepath.Join(tmpDir, "does-not-exist.sock"),
+			breakConfig:     func(*criconfig.PluginConfig) {},
+			expectedProblem: "is unreachable",
+		},
+		"should report a missing cni bin dir": {
+			breakConfig: func(config *criconfig.PluginConfig) {
+				config.NetworkPluginBinDir = filepath.Join(tmpDir, "missing-bin")
+			},
+			expectedProblem: "cni bin dir",
+		},
+		"should report a missing cni conf dir": {
+			breakConfig: func(config *criconfig.PluginConfig) {
+				config.NetworkPluginConfDir = filepath.Join(tmpDir, "missing-conf")
+			},
+			expectedProblem: "cni conf dir",
+		},
+		"should report an unreadable registry CA file": {
+			breakConfig: func(config *criconfig.PluginConfig) {
+				config.Registry.Configs["registry.example.com"] = criconfig.RegistryConfig{
+					TLS: &criconfig.TLSConfig{CAFile: filepath.Join(tmpDir, "missing-ca.crt")},
+				}
+			},
+			expectedProblem: "registry CA file",
+		},
+		"should report an invalid sandbox image": {
+			breakConfig: func(config *criconfig.PluginConfig) {
+				config.SandboxImage = "invalid image name"
+			},
+			expectedProblem: "invalid sandbox image",
+		},
+		"should report conflicting default runtime configurations": {
+			breakConfig: func(config *criconfig.PluginConfig) {
+				config.DefaultRuntime = criconfig.Runtime{Type: "io.containerd.runc.v1"}
+			},
+			expectedProblem: "conflicting runtime configuration",
+		},
+		"should report conflicting untrusted runtime handlers": {
+			breakConfig: func(config *criconfig.PluginConfig) {
+				config.UntrustedWorkloadRuntime = criconfig.Runtime{Type: "io.containerd.runc.v2"}
+				config.Runtimes[criconfig.RuntimeUntrusted] = criconfig.Runtime{Type: "io.containerd.runc.v2"}
+			},
+			expectedProblem: "untrusted_workload_runtime",
+		},
+		"should report a default runtime handler without runtime entry": {
+			breakConfig: func(config *criconfig.PluginConfig) {
+				config.DefaultRuntimeName = "missing-handler"
+			},
+			expectedProblem: "no entry in the runtimes table",
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		config := newValidConfig()
+		test.breakConfig(config)
+		endpoint := test.endpoint
+		if endpoint == "" {
+			endpoint = "unix://" + socket
+		}
+		problems := diagnoseConfig(config, endpoint)
+		require.Len(t, problems, 1)
+		assert.Contains(t, problems[0], test.expectedProblem)
+	}
+}
+
+func TestReportProblems(t *testing.T) {
+	out := new(bytes.Buffer)
+	reportProblems(nil, out)
+	assert.Equal(t, "config OK\n", out.String())
+
+	out.Reset()
+	reportProblems([]string{"first", "second"}, out)
+	assert.Equal(t, "problem: first\nproblem: second\n", out.String())
+}
@@ -0,0 +1,122 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+var imagesCommand = cli.Command{
+	Name:  "images",
+	Usage: "manage images via the CRI endpoint",
+	Subcommands: []cli.Command{
+		pruneCommand,
+	},
+}
+
+var pruneCommand = cli.Command{
+	Name:  "prune",
+	Usage: "remove dangling images not used by any container",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "endpoint",
+			Usage: "CRI endpoint to connect to",
+			Value: "unix:///run/containerd/containerd.sock",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "timeout for the prune operation",
+			Value: 1 * time.Minute,
+		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "only list the images which would be removed",
+		},
+	},
+	Action: func(cliCtx *cli.Context) error {
+		ctx, cancel := context.WithTimeout(context.Background(), cliCtx.Duration("timeout"))
+		defer cancel()
+		conn, err := dialEndpoint(ctx, cliCtx.String("endpoint"))
+		if err != nil {
+			return errors.Wrapf(err, "failed to connect CRI endpoint %q", cliCtx.String("endpoint"))
+		}
+		defer conn.Close()
+		return pruneImages(ctx,
+			runtime.NewImageServiceClient(conn),
+			runtime.NewRuntimeServiceClient(conn),
+			cliCtx.Bool("dry-run"), os.Stdout)
+	},
+}
+
+// pruneImages removes all images without repo tags which are not used by
+// any container, printing the reclaimed space. With dryRun it only lists
+// the removal candidates.
+func pruneImages(ctx context.Context, imageClient runtime.ImageServiceClient,
+	runtimeClient runtime.RuntimeServiceClient, dryRun bool, out io.Writer) error {
+	images, err := imageClient.ListImages(ctx, &runtime.ListImagesRequest{})
+	if err != nil {
+		return errors.Wrap(err, "failed to list images")
+	}
+	containers, err := runtimeClient.ListContainers(ctx, &runtime.ListContainersRequest{})
+	if err != nil {
+		return errors.Wrap(err, "failed to list containers")
+	}
+	inUse := make(map[string]struct{})
+	for _, cntr := range containers.GetContainers() {
+		inUse[cntr.GetImageRef()] = struct{}{}
+		inUse[cntr.GetImage().GetImage()] = struct{}{}
+	}
+
+	var (
+		pruned    int
+		reclaimed uint64
+	)
+	for _, image := range images.GetImages() {
+		if len(image.GetRepoTags()) != 0 {
+			continue
+		}
+		if _, ok := inUse[image.GetId()]; ok {
+			continue
+		}
+		if dryRun {
+			fmt.Fprintf(out, "would remove %s (%d bytes)\n", image.GetId(), image.GetSize_())
+		} else {
+			if _, err := imageClient.RemoveImage(ctx, &runtime.RemoveImageRequest{
+				Image: &runtime.ImageSpec{Image: image.GetId()},
+			}); err != nil {
+				return errors.Wrapf(err, "failed to remove image %q", image.GetId())
+			}
+			fmt.Fprintf(out, "removed %s (%d bytes)\n", image.GetId(), image.GetSize_())
+		}
+		pruned++
+		reclaimed += image.GetSize_()
+	}
+	if dryRun {
+		fmt.Fprintf(out, "would reclaim %d bytes from %d images\n", reclaimed, pruned)
+	} else {
+		fmt.Fprintf(out, "reclaimed %d bytes from %d images\n", reclaimed, pruned)
+	}
+	return nil
+}
@@ -47,4 +47,101 @@ const (
 
 	// containerName is the name of the container in the pod
 	ContainerName = "io.kubernetes.cri.container-name"
+
+	// SandboxNetNSPath is the sandbox annotation specifying a pre-created
+	// network namespace path the sandbox should use instead of creating its
+	// own. The referenced netns is not owned by cri and is never removed.
+	SandboxNetNSPath = "io.kubernetes.cri.sandbox-netns-path"
+
+	// TargetContainerID is the container annotation indicating an existing
+	// running container in the same pod whose pid, network and ipc namespaces
+	// the new container should join. It is used for ephemeral debug containers.
+	TargetContainerID = "io.kubernetes.cri.target-container-id"
+
+	// ContainerHostname is the container annotation overriding the hostname
+	// for a single container. The container gets its own UTS namespace, so
+	// the hostname of the other containers in the pod is not affected.
+	ContainerHostname = "io.kubernetes.cri.container-hostname"
+
+	// RequestID is the sandbox/container annotation carrying a caller
+	// provided request id used to correlate log lines across kubelet, cri
+	// and containerd.
+	RequestID = "io.kubernetes.cri.request-id"
+
+	// RootfsQuota is the container annotation requesting a disk usage
+	// quota for the container writable layer, e.g. "10GB". It only takes
+	// effect when the configured snapshotter supports quota enforcement.
+	RootfsQuota = "io.kubernetes.cri.rootfs-quota"
+
+	// MemorySwapLimit is the container annotation specifying the
+	// memory+swap limit of the container in bytes. It must not be smaller
+	// than the memory limit.
+	MemorySwapLimit = "io.kubernetes.cri.memory-swap-limit"
+
+	// MemoryReservation is the container annotation specifying the memory
+	// soft limit of the container in bytes, used by the kernel to guide
+	// reclaim under memory pressure. It must not exceed the memory limit.
+	MemoryReservation = "io.kubernetes.cri.memory-reservation"
+
+	// CPURealtimeRuntime is the container annotation specifying the CPU
+	// realtime runtime of the container in microseconds, mapped to
+	// cpu.rt_runtime_us. It must not exceed the realtime period.
+	CPURealtimeRuntime = "io.kubernetes.cri.cpu-rt-runtime"
+
+	// AutoRemove is the container annotation requesting that the container
+	// is removed automatically once it exits, freeing its metadata and
+	// snapshot without an explicit RemoveContainer call. Intended for
+	// run-once batch workloads.
+	AutoRemove = "io.kubernetes.cri.auto-remove"
+
+	// CPURealtimePeriod is the container annotation specifying the CPU
+	// realtime period of the container in microseconds, mapped to
+	// cpu.rt_period_us.
+	CPURealtimePeriod = "io.kubernetes.cri.cpu-rt-period"
+
+	// LabelPrefix is the prefix used when propagating allowlisted CRI
+	// container labels into the OCI spec annotations.
+	LabelPrefix = "io.kubernetes.cri.label."
+
+	// CombinedOutput is the container annotation requesting that stderr is
+	// multiplexed into the stdout stream, producing a single combined
+	// stream with each line labeled by its origin. It preserves the
+	// relative ordering of stdout and stderr lines for log pipelines that
+	// need it.
+	CombinedOutput = "io.kubernetes.cri.combined-output"
+
+	// SelinuxRelabelModes is the container annotation listing per-mount
+	// selinux relabel modes as comma separated "<container-path>=<mode>"
+	// pairs. Mode "z" relabels the mount source with the shared label,
+	// "Z" with the private label (the default), and "skip" disables
+	// relabeling for the mount, e.g. for huge volumes where a recursive
+	// relabel would block container creation for a long time. It matches
+	// docker's `:z`/`:Z` volume options.
+	SelinuxRelabelModes = "io.kubernetes.cri.selinux-relabel-modes"
+
+	// WritableMounts is the container annotation listing container paths,
+	// comma separated, whose bind mounts keep write access when
+	// `force_mounts_readonly` is enabled for a read-only rootfs container.
+	WritableMounts = "io.kubernetes.cri.writable-mounts"
+
+	// AmbientCapabilities is the pod annotation requesting that
+	// capabilities explicitly added to a container are placed in the
+	// ambient set as well, so that non-root processes retain them. Every
+	// ambient capability must also be in the permitted and inheritable
+	// sets.
+	AmbientCapabilities = "io.kubernetes.cri.ambient-capabilities"
+
+	// CapabilitySetDrops is the container annotation listing capabilities
+	// to drop from individual capability sets only, as semicolon separated
+	// "<set>=<cap>[,<cap>...]" groups, where set is one of effective,
+	// permitted, inheritable, bounding and ambient. It allows e.g.
+	// dropping a capability from the bounding set while keeping it in the
+	// permitted set. Without the annotation, capabilities are added and
+	// dropped across all sets uniformly.
+	CapabilitySetDrops = "io.kubernetes.cri.capability-set-drops"
+
+	// HotplugDevices is the container annotation listing host device paths,
+	// comma separated, which should be hot-plugged into the running
+	// container when device hot-plug is enabled.
+	HotplugDevices = "io.kubernetes.cri.hotplug-devices"
 )
@@ -19,12 +19,15 @@ package config
 import (
 	"context"
 	"net/url"
+	"os"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/containerd/containerd/log"
 	"github.com/containerd/containerd/plugin"
 	"github.com/pkg/errors"
+
+	"github.com/containerd/cri/pkg/ioutil"
 )
 
 // Runtime struct to contain the type(ID), engine, and root variables for a default runtime
@@ -55,6 +58,57 @@ type Runtime struct {
 	PrivilegedWithoutHostDevices bool `toml:"privileged_without_host_devices" json:"privileged_without_host_devices"`
 	// BaseRuntimeSpec is a json file with OCI spec to use as base spec that all container's will be created from.
 	BaseRuntimeSpec string `toml:"base_runtime_spec" json:"baseRuntimeSpec"`
+	// Snapshotter overrides the default snapshotter for sandboxes and
+	// containers running under this handler, e.g. a VM based runtime
+	// using a block device backed snapshotter. Empty value means to use
+	// the default snapshotter.
+	Snapshotter string `toml:"snapshotter" json:"snapshotter"`
+	// DefaultResources are default resource settings applied to containers
+	// running under this handler when the corresponding values are left unset
+	// in the CRI request. This helps to account for per-runtime overhead,
+	// e.g. a VM based runtime needing more memory headroom.
+	DefaultResources *RuntimeDefaultResources `toml:"default_resources" json:"defaultResources"`
+}
+
+// RuntimeDefaultResources are optional per-runtime default resource settings.
+// A zero value means no default for that setting.
+type RuntimeDefaultResources struct {
+	// MemoryLimitInBytes is the default memory limit in bytes.
+	MemoryLimitInBytes int64 `toml:"memory_limit_in_bytes" json:"memoryLimitInBytes"`
+	// CpuShares is the default cpu shares (relative weight vs. other containers).
+	CpuShares int64 `toml:"cpu_shares" json:"cpuShares"`
+	// OomScoreAdj is the default OOM score adjustment.
+	OomScoreAdj int64 `toml:"oom_score_adj" json:"oomScoreAdj"`
+}
+
+// DeviceCgroupRule is a custom device cgroup allow rule applied to all
+// containers, e.g. to allow access to a whole device class. A negative major
+// or minor number matches all devices.
+type DeviceCgroupRule struct {
+	// Type is the device type, one of "a", "b" or "c".
+	Type string `toml:"type" json:"type"`
+	// Major is the device major number, -1 matches all.
+	Major int64 `toml:"major" json:"major"`
+	// Minor is the device minor number, -1 matches all.
+	Minor int64 `toml:"minor" json:"minor"`
+	// Access is the cgroup access, a combination of "r", "w" and "m".
+	Access string `toml:"access" json:"access"`
+}
+
+// OCIHook is an OCI runtime hook applied to container specs, e.g. for
+// device setup.
+type OCIHook struct {
+	// Phase is the hook phase, one of "prestart", "poststart" and "poststop".
+	Phase string `toml:"phase" json:"phase"`
+	// Path is the absolute path of the hook binary on the host.
+	Path string `toml:"path" json:"path"`
+	// Args are the arguments passed to the hook, including argv[0].
+	Args []string `toml:"args" json:"args"`
+	// Timeout is the hook timeout in seconds. Zero means no timeout.
+	Timeout int `toml:"timeout" json:"timeout"`
+	// MatchAnnotation is a container annotation key which must be present
+	// for the hook to be applied. Empty applies the hook to all containers.
+	MatchAnnotation string `toml:"match_annotation" json:"matchAnnotation"`
 }
 
 // ContainerdConfig contains toml config related to containerd
@@ -202,6 +256,19 @@ type PluginConfig struct {
 	// The string is in the golang duration format, see:
 	//   https://golang.org/pkg/time/#ParseDuration
 	StreamIdleTimeout string `toml:"stream_idle_timeout" json:"streamIdleTimeout"`
+	// StreamCopyBufferSize is the size in bytes of the pooled buffers used
+	// to copy container stdio streams for attach and output piping.
+	// Non-positive values use the 32KB io.Copy default.
+	StreamCopyBufferSize int `toml:"stream_copy_buffer_size" json:"streamCopyBufferSize"`
+	// StreamWriteQueueSize is the number of writes buffered per attach
+	// output stream, so that one slow consumer does not stall container
+	// output piping. Zero disables buffering and writes synchronously.
+	StreamWriteQueueSize int `toml:"stream_write_queue_size" json:"streamWriteQueueSize"`
+	// StreamSlowConsumerPolicy is the policy applied to an attach output
+	// stream whose write queue is full, either "drop" (the default, which
+	// discards writes) or "disconnect" (which closes the stream). Only
+	// used when StreamWriteQueueSize is positive.
+	StreamSlowConsumerPolicy string `toml:"stream_slow_consumer_policy" json:"streamSlowConsumerPolicy"`
 	// EnableSelinux indicates to enable the selinux support.
 	EnableSelinux bool `toml:"enable_selinux" json:"enableSelinux"`
 	// SelinuxCategoryRange allows the upper bound on the category range to be set.
@@ -209,8 +276,22 @@ type PluginConfig struct {
 	SelinuxCategoryRange int `toml:"selinux_category_range" json:"selinuxCategoryRange"`
 	// SandboxImage is the image used by sandbox container.
 	SandboxImage string `toml:"sandbox_image" json:"sandboxImage"`
+	// SandboxImagePullPolicy is the pull policy for the sandbox image,
+	// one of "Always", "IfNotPresent" and "Never". "Never" never pulls
+	// the sandbox image and fails sandbox creation when it is absent,
+	// which is useful for air-gapped clusters with preloaded images.
+	SandboxImagePullPolicy string `toml:"sandbox_image_pull_policy" json:"sandboxImagePullPolicy"`
+	// SandboxImageAuth contains the credentials used for pulling the sandbox
+	// image, e.g. when it is hosted in a private registry. It is never used
+	// for workload image pulls, which carry their own credentials.
+	SandboxImageAuth AuthConfig `toml:"sandbox_image_auth" json:"sandboxImageAuth"`
 	// StatsCollectPeriod is the period (in seconds) of snapshots stats collection.
+	// A non-positive period disables snapshots stats collection.
 	StatsCollectPeriod int `toml:"stats_collect_period" json:"statsCollectPeriod"`
+	// StatsCollectJitter is the fraction (0 <= jitter < 1) by which each snapshots
+	// stats collection interval is randomized (period +/- period*jitter), to avoid
+	// synchronized collection spikes across nodes.
+	StatsCollectJitter float64 `toml:"stats_collect_jitter" json:"statsCollectJitter"`
 	// SystemdCgroup enables systemd cgroup support.
 	// This only works for runtime type "io.containerd.runtime.v1.linux".
 	// DEPRECATED: config runc runtime handler instead. Remove when shim v1 is deprecated.
@@ -219,6 +300,10 @@ type PluginConfig struct {
 	EnableTLSStreaming bool `toml:"enable_tls_streaming" json:"enableTLSStreaming"`
 	// X509KeyPairStreaming is a x509 key pair used for TLS streaming
 	X509KeyPairStreaming `toml:"x509_key_pair_streaming" json:"x509KeyPairStreaming"`
+	// StreamAuthTokenFile is the path to a file containing a bearer token used
+	// to authenticate requests to the stream server. When set, requests which
+	// do not present the token in the Authorization header are rejected.
+	StreamAuthTokenFile string `toml:"stream_auth_token_file" json:"streamAuthTokenFile"`
 	// MaxContainerLogLineSize is the maximum log line size in bytes for a container.
 	// Log line longer than the limit will be split into multiple lines. Non-positive
 	// value means no limit.
@@ -229,12 +314,29 @@ type PluginConfig struct {
 	// DisableApparmor indicates to disable the apparmor support.
 	// This is useful when the containerd does not have permission to access Apparmor.
 	DisableApparmor bool `toml:"disable_apparmor" json:"disableApparmor"`
+	// ProcessArgsPolicy controls how container args given without a command
+	// interact with the image cmd when generating the container process
+	// args. With "replace" (the default), such args replace the image cmd
+	// entirely. With "append", they are appended after the image cmd. An
+	// explicitly given command always replaces the image entrypoint and
+	// drops the image cmd under both policies.
+	ProcessArgsPolicy string `toml:"process_args_policy" json:"processArgsPolicy"`
+	// ApparmorProfilesDir is the directory searched for file backed apparmor
+	// profiles. When a container requests a `localhost/<name>` profile which
+	// is not loaded in the kernel, the profile is loaded from
+	// "<dir>/<name>" before container creation fails.
+	ApparmorProfilesDir string `toml:"apparmor_profiles_dir" json:"apparmorProfilesDir"`
 	// RestrictOOMScoreAdj indicates to limit the lower bound of OOMScoreAdj to the containerd's
 	// current OOMScoreADj.
 	// This is useful when the containerd does not have permission to decrease OOMScoreAdj.
 	RestrictOOMScoreAdj bool `toml:"restrict_oom_score_adj" json:"restrictOOMScoreAdj"`
 	// MaxConcurrentDownloads restricts the number of concurrent downloads for each image.
 	MaxConcurrentDownloads int `toml:"max_concurrent_downloads" json:"maxConcurrentDownloads"`
+	// MaxConcurrentLoads restricts the number of concurrent image load
+	// operations, so that they do not contend on the content store.
+	// Loads beyond the limit fail fast with an unavailable error.
+	// Non-positive value means to serialize all loads.
+	MaxConcurrentLoads int `toml:"max_concurrent_loads" json:"maxConcurrentLoads"`
 	// DisableProcMount disables Kubernetes ProcMount support. This MUST be set to `true`
 	// when using containerd with Kubernetes <=1.11.
 	DisableProcMount bool `toml:"disable_proc_mount" json:"disableProcMount"`
@@ -253,6 +355,125 @@ type PluginConfig struct {
 	// isolation, security and early detection of issues in the mount configuration when using
 	// ReadOnlyRootFilesystem since containers won't silently mount a temporary volume.
 	IgnoreImageDefinedVolumes bool `toml:"ignore_image_defined_volumes" json:"ignoreImageDefinedVolumes"`
+	// FallbackToHostNetwork indicates to run a sandbox with host networking when
+	// network namespace creation is not permitted, instead of failing the sandbox.
+	// This is useful in restricted environments, e.g. unprivileged containers or
+	// some CI setups, where unsharing a network namespace is not allowed.
+	FallbackToHostNetwork bool `toml:"fallback_to_host_network" json:"fallbackToHostNetwork"`
+	// CleanupLeakedNetNSOnStart indicates to remove netns files under the netns
+	// directory which are not referenced by any recovered sandbox on startup.
+	// Such files can be leaked by ungraceful shutdowns.
+	CleanupLeakedNetNSOnStart bool `toml:"cleanup_leaked_netns_on_start" json:"cleanupLeakedNetNSOnStart"`
+	// MaxContainerDevices is the maximum number of devices which can be
+	// exposed to a container. Non-positive value means no limit.
+	MaxContainerDevices int `toml:"max_container_devices" json:"maxContainerDevices"`
+	// DefaultSupplementalGroups is a list of node default additional GIDs
+	// applied to all containers. The list is merged with the supplemental
+	// groups from the container config with duplicates removed.
+	DefaultSupplementalGroups []int64 `toml:"default_supplemental_groups" json:"defaultSupplementalGroups"`
+	// DeviceCgroupRules is a list of additional device cgroup rules merged
+	// into the device cgroup rules of all containers.
+	DeviceCgroupRules []DeviceCgroupRule `toml:"device_cgroup_rules" json:"deviceCgroupRules"`
+	// PrivilegedDeviceAllowlist is a list of host device path glob patterns
+	// exposed to privileged containers. When empty, privileged containers
+	// get all host devices.
+	PrivilegedDeviceAllowlist []string `toml:"privileged_device_allowlist" json:"privilegedDeviceAllowlist"`
+	// EnableAudit indicates to emit a structured audit record for every
+	// mutating CRI call.
+	EnableAudit bool `toml:"enable_audit" json:"enableAudit"`
+	// EnableDeviceHotplug indicates to hot-plug the host devices listed in
+	// the hot-plug annotation into the running container on
+	// UpdateContainerResources.
+	EnableDeviceHotplug bool `toml:"enable_device_hotplug" json:"enableDeviceHotplug"`
+	// SpecLabelAllowlist is a list of CRI container label key patterns
+	// which are propagated into the OCI spec annotations with the
+	// "io.kubernetes.cri.label." prefix, so that OCI hooks and tools
+	// reading the spec can see them. The pattern is in the format of
+	// glob.
+	SpecLabelAllowlist []string `toml:"spec_label_allowlist" json:"specLabelAllowlist"`
+	// OCIHooks is a list of OCI runtime hooks applied to container specs,
+	// optionally filtered by container annotation.
+	OCIHooks []OCIHook `toml:"oci_hooks" json:"ociHooks"`
+	// CDISpecDirs is the list of directories scanned for CDI (Container
+	// Device Interface) spec files used to resolve CDI device annotations.
+	CDISpecDirs []string `toml:"cdi_spec_dirs" json:"cdiSpecDirs"`
+	// ExtraEnvFile is the path of a file containing KEY=VALUE lines which
+	// are merged into the environment of every container with the lowest
+	// precedence, i.e. both image config and container config env override
+	// them. A missing file is ignored.
+	ExtraEnvFile string `toml:"extra_env_file" json:"extraEnvFile"`
+	// CreateWorkingDir indicates to create the working directory in the
+	// container rootfs when it does not exist in the image, mirroring
+	// docker behavior.
+	CreateWorkingDir bool `toml:"create_working_dir" json:"createWorkingDir"`
+	// ShutdownTimeout is the maximum time to wait for in-flight
+	// create/stop/remove operations to finish on shutdown.
+	// The string is in the golang duration format, see:
+	//   https://golang.org/pkg/time/#ParseDuration
+	ShutdownTimeout string `toml:"shutdown_timeout" json:"shutdownTimeout"`
+	// NetworkTeardownTimeout is the maximum time to wait for CNI network
+	// teardown during StopPodSandbox. On timeout the sandbox is still
+	// marked stopped, and the leaked network resources are logged for
+	// later garbage collection. Empty means to wait for network teardown
+	// without a timeout.
+	// The string is in the golang duration format, see:
+	//   https://golang.org/pkg/time/#ParseDuration
+	NetworkTeardownTimeout string `toml:"network_teardown_timeout" json:"networkTeardownTimeout"`
+	// StopSandboxesOnShutdown indicates to stop all tracked sandboxes and
+	// their containers when the CRI service is closed, instead of leaving
+	// them running. This is destructive and disabled by default.
+	StopSandboxesOnShutdown bool `toml:"stop_sandboxes_on_shutdown" json:"stopSandboxesOnShutdown"`
+	// MaxSandboxes is the maximum number of sandboxes the managed
+	// namespace may contain. Non-positive value means no limit.
+	MaxSandboxes int `toml:"max_sandboxes" json:"maxSandboxes"`
+	// MaxContainers is the maximum number of containers the managed
+	// namespace may contain. Non-positive value means no limit.
+	MaxContainers int `toml:"max_containers" json:"maxContainers"`
+	// MaxImageSize is the maximum compressed image size in bytes allowed
+	// when creating containers. Containers created from a larger image are
+	// rejected. Non-positive value means no limit.
+	MaxImageSize int64 `toml:"max_image_size" json:"maxImageSize"`
+	// ImageFSFreeBytesThreshold is the amount of free bytes on the image
+	// filesystem below which a degraded condition is reported in Status.
+	// Zero disables the check.
+	ImageFSFreeBytesThreshold int64 `toml:"image_fs_free_bytes_threshold" json:"imageFSFreeBytesThreshold"`
+	// ImageFSFreeInodesThreshold is the number of free inodes on the image
+	// filesystem below which a degraded condition is reported in Status.
+	// Zero disables the check.
+	ImageFSFreeInodesThreshold int64 `toml:"image_fs_free_inodes_threshold" json:"imageFSFreeInodesThreshold"`
+	// StatsIncludeStoppedContainers indicates to include exited but not
+	// yet removed containers in ListContainerStats, reporting writable
+	// layer usage from the snapshot store while leaving CPU/memory unset.
+	// This helps kubelet disk eviction without changing summary CPU/memory
+	// semantics.
+	StatsIncludeStoppedContainers bool `toml:"stats_include_stopped_containers" json:"statsIncludeStoppedContainers"`
+	// EnableRunTmpfs mounts a writable tmpfs on /run inside containers,
+	// with the image content under /run copied up, instead of removing
+	// the /run mount from the spec. Many images expect a writable /run.
+	EnableRunTmpfs bool `toml:"enable_run_tmpfs" json:"enableRunTmpfs"`
+	// RunTmpfsSize is the tmpfs size option of the /run mount, e.g. "64m".
+	// It only takes effect when `enable_run_tmpfs` is set. Empty value
+	// keeps the kernel default.
+	RunTmpfsSize string `toml:"run_tmpfs_size" json:"runTmpfsSize"`
+	// ForceMountsReadonly mounts the bind mounts of a container requesting
+	// a read-only rootfs read-only as well, matching docker's behavior.
+	// Individual mounts can keep write access via the
+	// "io.kubernetes.cri.writable-mounts" container annotation.
+	ForceMountsReadonly bool `toml:"force_mounts_readonly" json:"forceMountsReadonly"`
+	// EnableProfiling enables the pprof profiling server.
+	EnableProfiling bool `toml:"enable_profiling" json:"enableProfiling"`
+	// ProfilingAddress is the TCP host:port the profiling server listens
+	// on when no profiling socket path is configured.
+	ProfilingAddress string `toml:"profiling_address" json:"profilingAddress"`
+	// ProfilingSocketPath is the unix socket path the profiling server
+	// listens on. When set it takes precedence over ProfilingAddress, so
+	// that the pprof endpoints are not exposed over TCP on shared nodes.
+	ProfilingSocketPath string `toml:"profiling_socket_path" json:"profilingSocketPath"`
+	// NamespaceRootDirs maps containerd namespace names to base directories
+	// for persistent sandbox and container files, so that namespace roots
+	// can be placed on different mounts. Namespaces without an entry keep
+	// using the plugin root directory.
+	NamespaceRootDirs map[string]string `toml:"namespace_root_dirs" json:"namespaceRootDirs"`
 }
 
 // X509KeyPairStreaming contains the x509 configuration for streaming
@@ -286,6 +507,21 @@ const (
 	// KeyModelNode is the key model where key for encrypted images reside
 	// on the worker nodes
 	KeyModelNode = "node"
+	// SandboxImagePullPolicyAlways always pulls the sandbox image.
+	SandboxImagePullPolicyAlways = "Always"
+	// SandboxImagePullPolicyIfNotPresent pulls the sandbox image only when
+	// it is not present. This is the default.
+	SandboxImagePullPolicyIfNotPresent = "IfNotPresent"
+	// SandboxImagePullPolicyNever never pulls the sandbox image, and fails
+	// sandbox creation when the image is absent.
+	SandboxImagePullPolicyNever = "Never"
+	// ProcessArgsPolicyReplace makes container args given without a command
+	// replace the image cmd entirely. This is the default and matches
+	// docker's command override behavior.
+	ProcessArgsPolicyReplace = "replace"
+	// ProcessArgsPolicyAppend makes container args given without a command
+	// append after the image cmd instead of replacing it.
+	ProcessArgsPolicyAppend = "append"
 )
 
 // ValidatePluginConfig validates the given plugin configuration.
@@ -347,6 +583,39 @@ func ValidatePluginConfig(ctx context.Context, c *PluginConfig) error {
 		}
 	}
 
+	// Validation for sandbox_image_pull_policy. An empty policy behaves
+	// as "IfNotPresent".
+	switch c.SandboxImagePullPolicy {
+	case "", SandboxImagePullPolicyAlways, SandboxImagePullPolicyIfNotPresent, SandboxImagePullPolicyNever:
+	default:
+		return errors.Errorf("invalid `sandbox_image_pull_policy` %q", c.SandboxImagePullPolicy)
+	}
+
+	// Validation for process_args_policy. An empty policy behaves as
+	// "replace".
+	switch c.ProcessArgsPolicy {
+	case "", ProcessArgsPolicyReplace, ProcessArgsPolicyAppend:
+	default:
+		return errors.Errorf("invalid `process_args_policy` %q", c.ProcessArgsPolicy)
+	}
+
+	// Validation for oci_hooks.
+	for _, hook := range c.OCIHooks {
+		switch hook.Phase {
+		case "prestart", "poststart", "poststop":
+		default:
+			return errors.Errorf("invalid oci hook phase %q", hook.Phase)
+		}
+		if _, err := os.Stat(hook.Path); err != nil {
+			return errors.Wrapf(err, "invalid oci hook path %q", hook.Path)
+		}
+	}
+
+	// Validation for stats_collect_jitter.
+	if c.StatsCollectJitter < 0 || c.StatsCollectJitter >= 1 {
+		return errors.Errorf("invalid `stats_collect_jitter` %v: must be in [0, 1)", c.StatsCollectJitter)
+	}
+
 	// Validation for deprecated auths options and mapping it to configs.
 	if len(c.Registry.Auths) != 0 {
 		if c.Registry.Configs == nil {
@@ -369,11 +638,33 @@ func ValidatePluginConfig(ctx context.Context, c *PluginConfig) error {
 		log.G(ctx).Warning("`auths` is deprecated, please use registry`configs` instead")
 	}
 
+	// Validation for stream_slow_consumer_policy. An empty policy behaves
+	// as "drop".
+	switch c.StreamSlowConsumerPolicy {
+	case "", string(ioutil.SlowConsumerDrop), string(ioutil.SlowConsumerDisconnect):
+	default:
+		return errors.Errorf("invalid `stream_slow_consumer_policy` %q", c.StreamSlowConsumerPolicy)
+	}
+
 	// Validation for stream_idle_timeout
 	if c.StreamIdleTimeout != "" {
 		if _, err := time.ParseDuration(c.StreamIdleTimeout); err != nil {
 			return errors.Wrap(err, "invalid stream idle timeout")
 		}
 	}
+
+	// Validation for shutdown_timeout
+	if c.ShutdownTimeout != "" {
+		if _, err := time.ParseDuration(c.ShutdownTimeout); err != nil {
+			return errors.Wrap(err, "invalid shutdown timeout")
+		}
+	}
+
+	// Validation for network_teardown_timeout
+	if c.NetworkTeardownTimeout != "" {
+		if _, err := time.ParseDuration(c.NetworkTeardownTimeout); err != nil {
+			return errors.Wrap(err, "invalid network teardown timeout")
+		}
+	}
 	return nil
 }
@@ -57,6 +57,7 @@ func DefaultConfig() PluginConfig {
 			TLSCertFile: "",
 		},
 		SandboxImage:            "k8s.gcr.io/pause:3.2",
+		SandboxImagePullPolicy:  SandboxImagePullPolicyIfNotPresent,
 		StatsCollectPeriod:      10,
 		SystemdCgroup:           false,
 		MaxContainerLogLineSize: 16 * 1024,
@@ -67,7 +68,10 @@ func DefaultConfig() PluginConfig {
 				},
 			},
 		},
+		ProcessArgsPolicy:                ProcessArgsPolicyReplace,
+		ApparmorProfilesDir:              "/etc/apparmor.d",
 		MaxConcurrentDownloads:           3,
+		MaxConcurrentLoads:               1,
 		DisableProcMount:                 false,
 		TolerateMissingHugetlbController: true,
 		DisableHugetlbController:         true,
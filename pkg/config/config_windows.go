@@ -55,6 +55,7 @@ func DefaultConfig() PluginConfig {
 			TLSCertFile: "",
 		},
 		SandboxImage:            "mcr.microsoft.com/oss/kubernetes/pause:1.4.0",
+		SandboxImagePullPolicy:  SandboxImagePullPolicyIfNotPresent,
 		StatsCollectPeriod:      10,
 		MaxContainerLogLineSize: 16 * 1024,
 		Registry: Registry{
@@ -64,7 +65,9 @@ func DefaultConfig() PluginConfig {
 				},
 			},
 		},
+		ProcessArgsPolicy:         ProcessArgsPolicyReplace,
 		MaxConcurrentDownloads:    3,
+		MaxConcurrentLoads:        1,
 		IgnoreImageDefinedVolumes: false,
 		// TODO(windows): Add platform specific config, so that most common defaults can be shared.
 	}
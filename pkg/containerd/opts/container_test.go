@@ -0,0 +1,55 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package opts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyExistingContents(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "copy-existing-contents-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// Fake image content at a volume path, including a nested directory.
+	src := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "subdir"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(src, "test-file"), []byte("test-content"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(src, "subdir", "nested-file"), []byte("nested-content"), 0600))
+
+	t.Logf("image content should be copied into an empty volume directory")
+	dst := filepath.Join(tmpDir, "dst")
+	require.NoError(t, os.MkdirAll(dst, 0755))
+	require.NoError(t, copyExistingContents(src, dst))
+	content, err := ioutil.ReadFile(filepath.Join(dst, "test-file"))
+	require.NoError(t, err)
+	assert.Equal(t, "test-content", string(content))
+	content, err = ioutil.ReadFile(filepath.Join(dst, "subdir", "nested-file"))
+	require.NoError(t, err)
+	assert.Equal(t, "nested-content", string(content))
+
+	t.Logf("a volume directory with existing content should be rejected")
+	err = copyExistingContents(src, dst)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not initially empty")
+}
@@ -29,6 +29,8 @@ import (
 	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+
+	criconfig "github.com/containerd/cri/pkg/config"
 )
 
 // DefaultSandboxCPUshares is default cpu shares for sandbox container.
@@ -52,15 +54,21 @@ func WithoutRoot(ctx context.Context, client oci.Client, c *containers.Container
 	return nil
 }
 
-// WithProcessArgs sets the process args on the spec based on the image and runtime config
-func WithProcessArgs(config *runtime.ContainerConfig, image *imagespec.ImageConfig) oci.SpecOpts {
+// WithProcessArgs sets the process args on the spec based on the image and
+// runtime config. The overall shape is migrated from moby's command override
+// behavior (https://github.com/moby/moby/blob/master/daemon/commit.go): an
+// explicitly given command replaces the image entrypoint and drops the image
+// cmd. How args given without a command interact with the image cmd is
+// controlled by argsPolicy, see `process_args_policy` in the plugin config.
+func WithProcessArgs(config *runtime.ContainerConfig, image *imagespec.ImageConfig, argsPolicy string) oci.SpecOpts {
 	return func(ctx context.Context, client oci.Client, c *containers.Container, s *runtimespec.Spec) (err error) {
 		command, args := config.GetCommand(), config.GetArgs()
-		// The following logic is migrated from https://github.com/moby/moby/blob/master/daemon/commit.go
-		// TODO(random-liu): Clearly define the commands overwrite behavior.
 		if len(command) == 0 {
-			// Copy array to avoid data race.
-			if len(args) == 0 {
+			if argsPolicy == criconfig.ProcessArgsPolicyAppend {
+				// Keep the image cmd and append the args after it.
+				args = append(append([]string{}, image.Cmd...), args...)
+			} else if len(args) == 0 {
+				// Copy array to avoid data race.
 				args = append([]string{}, image.Cmd...)
 			}
 			if command == nil {
@@ -101,6 +109,26 @@ func (m orderedMounts) parts(i int) int {
 	return strings.Count(filepath.Clean(m[i].ContainerPath), string(os.PathSeparator))
 }
 
+// WithOCIHook appends an OCI hook of the given phase to the spec.
+func WithOCIHook(phase string, hook runtimespec.Hook) oci.SpecOpts {
+	return func(ctx context.Context, client oci.Client, c *containers.Container, s *runtimespec.Spec) error {
+		if s.Hooks == nil {
+			s.Hooks = &runtimespec.Hooks{}
+		}
+		switch phase {
+		case "prestart":
+			s.Hooks.Prestart = append(s.Hooks.Prestart, hook)
+		case "poststart":
+			s.Hooks.Poststart = append(s.Hooks.Poststart, hook)
+		case "poststop":
+			s.Hooks.Poststop = append(s.Hooks.Poststop, hook)
+		default:
+			return errors.Errorf("unknown hook phase %q", phase)
+		}
+		return nil
+	}
+}
+
 // WithAnnotation sets the provided annotation
 func WithAnnotation(k, v string) oci.SpecOpts {
 	return func(ctx context.Context, client oci.Client, c *containers.Container, s *runtimespec.Spec) error {
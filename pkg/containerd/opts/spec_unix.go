@@ -34,6 +34,7 @@ import (
 	"github.com/containerd/containerd/log"
 	"github.com/containerd/containerd/mount"
 	"github.com/containerd/containerd/oci"
+	"github.com/containerd/continuity/fs"
 	"github.com/opencontainers/runc/libcontainer/devices"
 	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/opencontainers/selinux/go-selinux/label"
@@ -42,6 +43,7 @@ import (
 	"golang.org/x/sys/unix"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
+	"github.com/containerd/cri/pkg/annotations"
 	osinterface "github.com/containerd/cri/pkg/os"
 	"github.com/containerd/cri/pkg/util"
 )
@@ -95,6 +97,29 @@ func WithoutRunMount(_ context.Context, _ oci.Client, c *containers.Container, s
 	return nil
 }
 
+// WithRunTmpfs replaces the `/run` mount inside the spec with a tmpfs
+// mount of the given size. The `tmpcopyup` option makes the runtime copy
+// the image content under /run into the tmpfs, so images shipping files
+// there keep working. An empty size keeps the kernel default.
+func WithRunTmpfs(size string) oci.SpecOpts {
+	return func(ctx context.Context, client oci.Client, c *containers.Container, s *runtimespec.Spec) error {
+		if err := WithoutRunMount(ctx, client, c, s); err != nil {
+			return err
+		}
+		options := []string{"nosuid", "nodev", "mode=755", "tmpcopyup"}
+		if size != "" {
+			options = append(options, "size="+size)
+		}
+		s.Mounts = append(s.Mounts, runtimespec.Mount{
+			Destination: "/run",
+			Type:        "tmpfs",
+			Source:      "tmpfs",
+			Options:     options,
+		})
+		return nil
+	}
+}
+
 // WithoutDefaultSecuritySettings removes the default security settings generated on a spec
 func WithoutDefaultSecuritySettings(_ context.Context, _ oci.Client, c *containers.Container, s *runtimespec.Spec) error {
 	if s.Process == nil {
@@ -110,8 +135,37 @@ func WithoutDefaultSecuritySettings(_ context.Context, _ oci.Client, c *containe
 	return nil
 }
 
-// WithMounts sorts and adds runtime and CRI mounts to the spec
-func WithMounts(osi osinterface.OS, config *runtime.ContainerConfig, extra []*runtime.Mount, mountLabel string) oci.SpecOpts {
+// relabelFunc relabels a bind mount source with the mount label. It may
+// be overridden in unit tests.
+var relabelFunc = label.Relabel
+
+// parseRelabelModes parses the selinux relabel modes annotation into a
+// map keyed by the clean container path.
+func parseRelabelModes(value string) (map[string]string, error) {
+	modes := make(map[string]string)
+	if value == "" {
+		return modes, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid selinux relabel mode %q", pair)
+		}
+		switch parts[1] {
+		case "z", "Z", "skip":
+		default:
+			return nil, errors.Errorf("invalid selinux relabel mode %q for %q", parts[1], parts[0])
+		}
+		modes[filepath.Clean(parts[0])] = parts[1]
+	}
+	return modes, nil
+}
+
+// WithMounts sorts and adds runtime and CRI mounts to the spec. When
+// forceReadonlyMounts is set and the container requests a read-only
+// rootfs, bind mounts are mounted read-only as well, matching docker,
+// unless the mount is listed in the writable mounts annotation.
+func WithMounts(osi osinterface.OS, config *runtime.ContainerConfig, extra []*runtime.Mount, mountLabel string, forceReadonlyMounts bool) oci.SpecOpts {
 	return func(ctx context.Context, client oci.Client, _ *containers.Container, s *runtimespec.Spec) (err error) {
 		// mergeMounts merge CRI mounts with extra mounts. If a mount destination
 		// is mounted by both a CRI mount and an extra mount, the CRI mount will
@@ -120,6 +174,17 @@ func WithMounts(osi osinterface.OS, config *runtime.ContainerConfig, extra []*ru
 			criMounts = config.GetMounts()
 			mounts    = append([]*runtime.Mount{}, criMounts...)
 		)
+		relabelModes, err := parseRelabelModes(config.GetAnnotations()[annotations.SelinuxRelabelModes])
+		if err != nil {
+			return err
+		}
+		forceReadonly := forceReadonlyMounts && config.GetLinux().GetSecurityContext().GetReadonlyRootfs()
+		writableMounts := make(map[string]struct{})
+		if v := config.GetAnnotations()[annotations.WritableMounts]; v != "" {
+			for _, p := range strings.Split(v, ",") {
+				writableMounts[filepath.Clean(p)] = struct{}{}
+			}
+		}
 		// Copy all mounts from extra mounts, except for mounts overridden by CRI.
 		for _, e := range extra {
 			found := false
@@ -222,15 +287,29 @@ func WithMounts(osi osinterface.OS, config *runtime.ContainerConfig, extra []*ru
 
 			// NOTE(random-liu): we don't change all mounts to `ro` when root filesystem
 			// is readonly. This is different from docker's behavior, but make more sense.
-			if mount.GetReadonly() {
+			// Matching docker is available behind forceReadonlyMounts, with a
+			// per-mount opt out via the writable mounts annotation.
+			_, writable := writableMounts[filepath.Clean(dst)]
+			if mount.GetReadonly() || (forceReadonly && !writable) {
 				options = append(options, "ro")
 			} else {
 				options = append(options, "rw")
 			}
 
 			if mount.GetSelinuxRelabel() {
-				if err := label.Relabel(src, mountLabel, false); err != nil && err != unix.ENOTSUP {
-					return errors.Wrapf(err, "relabel %q with %q failed", src, mountLabel)
+				switch relabelModes[filepath.Clean(dst)] {
+				case "skip":
+					// Recursively relabeling a huge volume can block
+					// container creation for a long time, allow opting
+					// out per mount.
+				case "z":
+					if err := relabelFunc(src, mountLabel, true); err != nil && err != unix.ENOTSUP {
+						return errors.Wrapf(err, "relabel %q with %q failed", src, mountLabel)
+					}
+				default:
+					if err := relabelFunc(src, mountLabel, false); err != nil && err != unix.ENOTSUP {
+						return errors.Wrapf(err, "relabel %q with %q failed", src, mountLabel)
+					}
 				}
 			}
 			s.Mounts = append(s.Mounts, runtimespec.Mount{
@@ -290,8 +369,32 @@ func addDevice(s *runtimespec.Spec, rd runtimespec.LinuxDevice) {
 	s.Linux.Devices = append(s.Linux.Devices, rd)
 }
 
-// WithDevices sets the provided devices onto the container spec
-func WithDevices(osi osinterface.OS, config *runtime.ContainerConfig) oci.SpecOpts {
+// validateDevicePermissions checks that the device permission string is a
+// non-empty combination of "r", "w" and "m" without duplicates.
+func validateDevicePermissions(permissions string) error {
+	if permissions == "" {
+		return errors.New("device permissions can not be empty")
+	}
+	seen := make(map[rune]bool)
+	for _, p := range permissions {
+		switch p {
+		case 'r', 'w', 'm':
+			if seen[p] {
+				return errors.Errorf("duplicate device permission %q", string(p))
+			}
+			seen[p] = true
+		default:
+			return errors.Errorf("invalid device permission %q, supported permissions are \"r\", \"w\" and \"m\"", string(p))
+		}
+	}
+	return nil
+}
+
+// WithDevices sets the provided devices onto the container spec.
+// Devices with an invalid major/minor number are skipped with a warning.
+// A non-positive maxDevices means there is no limit on the number of
+// devices which can be exposed.
+func WithDevices(osi osinterface.OS, config *runtime.ContainerConfig, maxDevices int) oci.SpecOpts {
 	return func(ctx context.Context, client oci.Client, c *containers.Container, s *runtimespec.Spec) (err error) {
 		if s.Linux == nil {
 			s.Linux = &runtimespec.Linux{}
@@ -299,7 +402,13 @@ func WithDevices(osi osinterface.OS, config *runtime.ContainerConfig) oci.SpecOp
 		if s.Linux.Resources == nil {
 			s.Linux.Resources = &runtimespec.LinuxResources{}
 		}
+		if maxDevices > 0 && len(config.GetDevices()) > maxDevices {
+			return errors.Errorf("at most %d devices may be exposed to a container, got %d", maxDevices, len(config.GetDevices()))
+		}
 		for _, device := range config.GetDevices() {
+			if err := validateDevicePermissions(device.Permissions); err != nil {
+				return errors.Wrapf(err, "invalid permissions for device %q", device.HostPath)
+			}
 			path, err := osi.ResolveSymbolicLink(device.HostPath)
 			if err != nil {
 				return err
@@ -308,6 +417,10 @@ func WithDevices(osi osinterface.OS, config *runtime.ContainerConfig) oci.SpecOp
 			if err != nil {
 				return err
 			}
+			if dev.Major < 0 || dev.Minor < 0 || (dev.Major == 0 && dev.Minor == 0) {
+				log.G(ctx).Warnf("Skipping device %q with invalid major/minor number %d:%d", device.HostPath, dev.Major, dev.Minor)
+				continue
+			}
 			rd := runtimespec.LinuxDevice{
 				Path:  device.ContainerPath,
 				Type:  string(dev.Type),
@@ -331,6 +444,103 @@ func WithDevices(osi osinterface.OS, config *runtime.ContainerConfig) oci.SpecOp
 	}
 }
 
+// WithDeviceCgroupRules appends the provided device cgroup rules onto the
+// container spec.
+func WithDeviceCgroupRules(rules []runtimespec.LinuxDeviceCgroup) oci.SpecOpts {
+	return func(ctx context.Context, client oci.Client, c *containers.Container, s *runtimespec.Spec) (err error) {
+		if len(rules) == 0 {
+			return nil
+		}
+		if s.Linux == nil {
+			s.Linux = &runtimespec.Linux{}
+		}
+		if s.Linux.Resources == nil {
+			s.Linux.Resources = &runtimespec.LinuxResources{}
+		}
+		s.Linux.Resources.Devices = append(s.Linux.Resources.Devices, rules...)
+		return nil
+	}
+}
+
+// WithWorkingDir sets the working directory of the container, and creates it
+// in the container rootfs when it does not exist, mirroring docker behavior.
+func WithWorkingDir(dir string) oci.SpecOpts {
+	return func(ctx context.Context, client oci.Client, c *containers.Container, s *runtimespec.Spec) (err error) {
+		if err := oci.WithProcessCwd(dir)(ctx, client, c, s); err != nil {
+			return err
+		}
+		if c.Snapshotter == "" && c.SnapshotKey == "" {
+			if s.Root == nil || s.Root.Path == "" {
+				// No rootfs to create the working directory in.
+				return nil
+			}
+			return mkdirInRootfs(s.Root.Path, dir)
+		}
+		if c.Snapshotter == "" {
+			return errors.New("no snapshotter set for container")
+		}
+		if c.SnapshotKey == "" {
+			return errors.New("rootfs snapshot not created for container")
+		}
+		snapshotter := client.SnapshotService(c.Snapshotter)
+		mounts, err := snapshotter.Mounts(ctx, c.SnapshotKey)
+		if err != nil {
+			return err
+		}
+		return mount.WithTempMount(ctx, mounts, func(root string) error {
+			return mkdirInRootfs(root, dir)
+		})
+	}
+}
+
+// mkdirInRootfs creates the directory inside the rootfs if it does not exist.
+func mkdirInRootfs(root, dir string) error {
+	path, err := fs.RootPath(root, dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve %q in rootfs", dir)
+	}
+	return os.MkdirAll(path, 0755)
+}
+
+// WithAllowlistedHostDevices is like oci.WithHostDevices, but only exposes
+// the host devices whose host path matches one of the given glob patterns.
+func WithAllowlistedHostDevices(patterns []string) oci.SpecOpts {
+	return func(ctx context.Context, client oci.Client, c *containers.Container, s *runtimespec.Spec) (err error) {
+		if s.Linux == nil {
+			s.Linux = &runtimespec.Linux{}
+		}
+		existing := len(s.Linux.Devices)
+		if err := oci.WithHostDevices(ctx, client, c, s); err != nil {
+			return err
+		}
+		allowed, err := filterHostDevices(s.Linux.Devices[existing:], patterns)
+		if err != nil {
+			return err
+		}
+		s.Linux.Devices = append(s.Linux.Devices[:existing], allowed...)
+		return nil
+	}
+}
+
+// filterHostDevices returns the devices whose path matches one of the given
+// glob patterns.
+func filterHostDevices(devs []runtimespec.LinuxDevice, patterns []string) ([]runtimespec.LinuxDevice, error) {
+	var allowed []runtimespec.LinuxDevice
+	for _, dev := range devs {
+		for _, pattern := range patterns {
+			matched, err := filepath.Match(pattern, dev.Path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid host device pattern %q", pattern)
+			}
+			if matched {
+				allowed = append(allowed, dev)
+				break
+			}
+		}
+	}
+	return allowed, nil
+}
+
 // WithCapabilities sets the provided capabilties from the security context
 func WithCapabilities(sc *runtime.LinuxContainerSecurityContext) oci.SpecOpts {
 	capabilities := sc.GetCapabilities()
@@ -371,6 +581,110 @@ func WithCapabilities(sc *runtime.LinuxContainerSecurityContext) oci.SpecOpts {
 	return oci.Compose(opts...)
 }
 
+// WithAmbientCapabilities places the capabilities explicitly added in
+// the security context into the ambient set as well, so that non-root
+// processes retain them. Every ambient capability must also be in the
+// permitted and inheritable sets. It must be applied after the uniform
+// capability handling.
+func WithAmbientCapabilities(sc *runtime.LinuxContainerSecurityContext) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *runtimespec.Spec) error {
+		var caps []string
+		for _, c := range sc.GetCapabilities().GetAddCapabilities() {
+			if strings.ToUpper(c) == "ALL" {
+				continue
+			}
+			caps = append(caps, "CAP_"+strings.ToUpper(c))
+		}
+		if len(caps) == 0 {
+			return nil
+		}
+		if s.Process == nil {
+			s.Process = &runtimespec.Process{}
+		}
+		if s.Process.Capabilities == nil {
+			s.Process.Capabilities = &runtimespec.LinuxCapabilities{}
+		}
+		cs := s.Process.Capabilities
+		for _, c := range caps {
+			if !util.InStringSlice(cs.Permitted, c) || !util.InStringSlice(cs.Inheritable, c) {
+				return errors.Errorf("ambient capability %q must be in both the permitted and inheritable sets", c)
+			}
+			if !util.InStringSlice(cs.Ambient, c) {
+				cs.Ambient = append(cs.Ambient, c)
+			}
+		}
+		return nil
+	}
+}
+
+// parseCapabilitySetDrops parses the capability set drops annotation
+// into per-set capability lists, with the `CAP_` prefix added.
+func parseCapabilitySetDrops(value string) (map[string][]string, error) {
+	drops := make(map[string][]string)
+	for _, group := range strings.Split(value, ";") {
+		parts := strings.SplitN(group, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid capability set drop %q", group)
+		}
+		switch parts[0] {
+		case "effective", "permitted", "inheritable", "bounding", "ambient":
+		default:
+			return nil, errors.Errorf("invalid capability set %q", parts[0])
+		}
+		for _, c := range strings.Split(parts[1], ",") {
+			drops[parts[0]] = append(drops[parts[0]], "CAP_"+strings.ToUpper(c))
+		}
+	}
+	return drops, nil
+}
+
+// WithCapabilitySetDrops drops capabilities from individual capability
+// sets only, leaving the other sets untouched. It must be applied after
+// the uniform capability handling, so that e.g. a capability can be
+// dropped from the bounding set while staying in the permitted set.
+func WithCapabilitySetDrops(value string) oci.SpecOpts {
+	return func(_ context.Context, _ oci.Client, _ *containers.Container, s *runtimespec.Spec) error {
+		drops, err := parseCapabilitySetDrops(value)
+		if err != nil {
+			return err
+		}
+		if s.Process == nil {
+			s.Process = &runtimespec.Process{}
+		}
+		if s.Process.Capabilities == nil {
+			s.Process.Capabilities = &runtimespec.LinuxCapabilities{}
+		}
+		caps := s.Process.Capabilities
+		for set, toDrop := range drops {
+			switch set {
+			case "effective":
+				caps.Effective = dropCapabilities(caps.Effective, toDrop)
+			case "permitted":
+				caps.Permitted = dropCapabilities(caps.Permitted, toDrop)
+			case "inheritable":
+				caps.Inheritable = dropCapabilities(caps.Inheritable, toDrop)
+			case "bounding":
+				caps.Bounding = dropCapabilities(caps.Bounding, toDrop)
+			case "ambient":
+				caps.Ambient = dropCapabilities(caps.Ambient, toDrop)
+			}
+		}
+		return nil
+	}
+}
+
+// dropCapabilities removes the given capabilities from a capability list.
+func dropCapabilities(current, toDrop []string) []string {
+	var caps []string
+	for _, c := range current {
+		if util.InStringSlice(toDrop, c) {
+			continue
+		}
+		caps = append(caps, c)
+	}
+	return caps
+}
+
 // WithoutAmbientCaps removes the ambient caps from the spec
 func WithoutAmbientCaps(_ context.Context, _ oci.Client, c *containers.Container, s *runtimespec.Spec) error {
 	if s.Process == nil {
@@ -471,6 +785,78 @@ func WithResources(resources *runtime.LinuxContainerResources, tolerateMissingHu
 	}
 }
 
+// WithMemorySwapLimit sets the memory+swap limit of the container. It must
+// be applied after the memory limit is set, because a swap limit smaller
+// than the memory limit is inconsistent and rejected here.
+func WithMemorySwapLimit(swap int64) oci.SpecOpts {
+	return func(ctx context.Context, client oci.Client, c *containers.Container, s *runtimespec.Spec) error {
+		if s.Linux == nil {
+			s.Linux = &runtimespec.Linux{}
+		}
+		if s.Linux.Resources == nil {
+			s.Linux.Resources = &runtimespec.LinuxResources{}
+		}
+		if s.Linux.Resources.Memory == nil {
+			s.Linux.Resources.Memory = &runtimespec.LinuxMemory{}
+		}
+		if limit := s.Linux.Resources.Memory.Limit; limit != nil && swap < *limit {
+			return errors.Errorf("memory swap limit %d is smaller than memory limit %d", swap, *limit)
+		}
+		s.Linux.Resources.Memory.Swap = &swap
+		return nil
+	}
+}
+
+// WithMemoryReservation sets the memory soft limit of the container. It must
+// be applied after the memory limit is set, because a reservation exceeding
+// the memory limit is inconsistent and rejected here.
+func WithMemoryReservation(reservation int64) oci.SpecOpts {
+	return func(ctx context.Context, client oci.Client, c *containers.Container, s *runtimespec.Spec) error {
+		if s.Linux == nil {
+			s.Linux = &runtimespec.Linux{}
+		}
+		if s.Linux.Resources == nil {
+			s.Linux.Resources = &runtimespec.LinuxResources{}
+		}
+		if s.Linux.Resources.Memory == nil {
+			s.Linux.Resources.Memory = &runtimespec.LinuxMemory{}
+		}
+		if limit := s.Linux.Resources.Memory.Limit; limit != nil && reservation > *limit {
+			return errors.Errorf("memory reservation %d is larger than memory limit %d", reservation, *limit)
+		}
+		s.Linux.Resources.Memory.Reservation = &reservation
+		return nil
+	}
+}
+
+// WithCPURealtime sets the CPU realtime runtime and period of the container,
+// mapped to cpu.rt_runtime_us and cpu.rt_period_us. A runtime exceeding the
+// period is inconsistent and rejected here. A zero value leaves the
+// corresponding field unset.
+func WithCPURealtime(runtime int64, period uint64) oci.SpecOpts {
+	return func(ctx context.Context, client oci.Client, c *containers.Container, s *runtimespec.Spec) error {
+		if period != 0 && runtime > int64(period) {
+			return errors.Errorf("CPU realtime runtime %d is larger than realtime period %d", runtime, period)
+		}
+		if s.Linux == nil {
+			s.Linux = &runtimespec.Linux{}
+		}
+		if s.Linux.Resources == nil {
+			s.Linux.Resources = &runtimespec.LinuxResources{}
+		}
+		if s.Linux.Resources.CPU == nil {
+			s.Linux.Resources.CPU = &runtimespec.LinuxCPU{}
+		}
+		if runtime != 0 {
+			s.Linux.Resources.CPU.RealtimeRuntime = &runtime
+		}
+		if period != 0 {
+			s.Linux.Resources.CPU.RealtimePeriod = &period
+		}
+		return nil
+	}
+}
+
 var (
 	supportsHugetlbOnce sync.Once
 	supportsHugetlb     bool
@@ -622,12 +1008,28 @@ func WithPodNamespaces(config *runtime.LinuxContainerSecurityContext, pid uint32
 		oci.WithLinuxNamespace(runtimespec.LinuxNamespace{Type: runtimespec.IPCNamespace, Path: GetIPCNamespace(pid)}),
 		oci.WithLinuxNamespace(runtimespec.LinuxNamespace{Type: runtimespec.UTSNamespace, Path: GetUTSNamespace(pid)}),
 	}
-	if namespaces.GetPid() != runtime.NamespaceMode_CONTAINER {
+	switch namespaces.GetPid() {
+	case runtime.NamespaceMode_NODE:
+		// The sandbox may itself be in the host pid namespace, but the
+		// container should use the host namespace directly instead of
+		// joining the sandbox's namespace by path.
+		opts = append(opts, WithoutNamespace(runtimespec.PIDNamespace))
+	case runtime.NamespaceMode_POD:
 		opts = append(opts, oci.WithLinuxNamespace(runtimespec.LinuxNamespace{Type: runtimespec.PIDNamespace, Path: GetPIDNamespace(pid)}))
 	}
 	return oci.Compose(opts...)
 }
 
+// WithTargetNamespaces sets the container to join the pid, network and ipc
+// namespaces of the target container task.
+func WithTargetNamespaces(pid uint32) oci.SpecOpts {
+	return oci.Compose(
+		oci.WithLinuxNamespace(runtimespec.LinuxNamespace{Type: runtimespec.PIDNamespace, Path: GetPIDNamespace(pid)}),
+		oci.WithLinuxNamespace(runtimespec.LinuxNamespace{Type: runtimespec.NetworkNamespace, Path: GetNetworkNamespace(pid)}),
+		oci.WithLinuxNamespace(runtimespec.LinuxNamespace{Type: runtimespec.IPCNamespace, Path: GetIPCNamespace(pid)}),
+	)
+}
+
 // WithDefaultSandboxShares sets the default sandbox CPU shares
 func WithDefaultSandboxShares(ctx context.Context, client oci.Client, c *containers.Container, s *runtimespec.Spec) error {
 	if s.Linux == nil {
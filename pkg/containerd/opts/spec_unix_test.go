@@ -19,10 +19,21 @@
 package opts
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/containerd/containerd/containers"
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+
+	"github.com/containerd/cri/pkg/annotations"
+	ostesting "github.com/containerd/cri/pkg/os/testing"
 )
 
 func TestMergeGids(t *testing.T) {
@@ -31,6 +42,85 @@ func TestMergeGids(t *testing.T) {
 	assert.Equal(t, []uint32{1, 2, 3, 4}, mergeGids(gids1, gids2))
 }
 
+func TestValidateDevicePermissions(t *testing.T) {
+	for desc, test := range map[string]struct {
+		permissions string
+		expectErr   bool
+	}{
+		"should reject empty permissions": {
+			permissions: "",
+			expectErr:   true,
+		},
+		"should reject unsupported permission": {
+			permissions: "rwx",
+			expectErr:   true,
+		},
+		"should reject duplicate permission": {
+			permissions: "rr",
+			expectErr:   true,
+		},
+		"should accept single permission": {
+			permissions: "r",
+		},
+		"should accept all permissions": {
+			permissions: "rwm",
+		},
+		"should accept permissions in any order": {
+			permissions: "mrw",
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		err := validateDevicePermissions(test.permissions)
+		if test.expectErr {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestWithDevices(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("skipping test that requires root")
+	}
+	dir, err := ioutil.TempDir("", "test-with-devices")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// Create a char device with invalid major/minor number 0/0.
+	invalidDevice := filepath.Join(dir, "invalid")
+	require.NoError(t, unix.Mknod(invalidDevice, unix.S_IFCHR|0666, 0))
+
+	newConfig := func(paths ...string) *runtime.ContainerConfig {
+		config := &runtime.ContainerConfig{}
+		for _, p := range paths {
+			config.Devices = append(config.Devices, &runtime.Device{
+				ContainerPath: p,
+				HostPath:      p,
+				Permissions:   "rwm",
+			})
+		}
+		return config
+	}
+
+	t.Logf("device with invalid major/minor number should be skipped")
+	spec := &runtimespec.Spec{}
+	err = WithDevices(&ostesting.FakeOS{}, newConfig("/dev/null", invalidDevice), 0)(context.Background(), nil, nil, spec)
+	require.NoError(t, err)
+	require.Len(t, spec.Linux.Devices, 1)
+	assert.Equal(t, "/dev/null", spec.Linux.Devices[0].Path)
+
+	t.Logf("device count limit should be enforced")
+	spec = &runtimespec.Spec{}
+	err = WithDevices(&ostesting.FakeOS{}, newConfig("/dev/null", "/dev/zero"), 1)(context.Background(), nil, nil, spec)
+	assert.Error(t, err)
+
+	t.Logf("devices within the count limit should be added")
+	spec = &runtimespec.Spec{}
+	err = WithDevices(&ostesting.FakeOS{}, newConfig("/dev/null", "/dev/zero"), 2)(context.Background(), nil, nil, spec)
+	require.NoError(t, err)
+	assert.Len(t, spec.Linux.Devices, 2)
+}
+
 func TestRestrictOOMScoreAdj(t *testing.T) {
 	current, err := getCurrentOOMScoreAdj()
 	require.NoError(t, err)
@@ -47,3 +137,251 @@ func TestRestrictOOMScoreAdj(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, got, current+1)
 }
+
+func TestFilterHostDevices(t *testing.T) {
+	devs := []runtimespec.LinuxDevice{
+		{Path: "/dev/null"},
+		{Path: "/dev/zero"},
+		{Path: "/dev/nvidia0"},
+		{Path: "/dev/nvidia1"},
+	}
+	for desc, test := range map[string]struct {
+		patterns  []string
+		expected  []string
+		expectErr bool
+	}{
+		"exact match should only keep the matched device": {
+			patterns: []string{"/dev/null"},
+			expected: []string{"/dev/null"},
+		},
+		"glob pattern should keep all matched devices": {
+			patterns: []string{"/dev/nvidia*"},
+			expected: []string{"/dev/nvidia0", "/dev/nvidia1"},
+		},
+		"multiple patterns should be unioned": {
+			patterns: []string{"/dev/null", "/dev/nvidia*"},
+			expected: []string{"/dev/null", "/dev/nvidia0", "/dev/nvidia1"},
+		},
+		"no matching pattern should keep no device": {
+			patterns: []string{"/dev/fuse"},
+		},
+		"invalid pattern should return error": {
+			patterns:  []string{"/dev/["},
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		allowed, err := filterHostDevices(devs, test.patterns)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		var paths []string
+		for _, dev := range allowed {
+			paths = append(paths, dev.Path)
+		}
+		assert.Equal(t, test.expected, paths)
+	}
+}
+
+func TestWithWorkingDir(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "test-with-working-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(rootfs)
+
+	t.Logf("working directory should be created in the rootfs and set in the spec")
+	spec := &runtimespec.Spec{Root: &runtimespec.Root{Path: rootfs}}
+	err = WithWorkingDir("/a/b/c")(context.Background(), nil, &containers.Container{}, spec)
+	require.NoError(t, err)
+	assert.Equal(t, "/a/b/c", spec.Process.Cwd)
+	st, err := os.Stat(filepath.Join(rootfs, "a", "b", "c"))
+	require.NoError(t, err)
+	assert.True(t, st.IsDir())
+
+	t.Logf("an existing working directory should be left as is")
+	err = WithWorkingDir("/a/b/c")(context.Background(), nil, &containers.Container{}, spec)
+	assert.NoError(t, err)
+
+	t.Logf("missing rootfs should only set the working directory in the spec")
+	spec = &runtimespec.Spec{}
+	err = WithWorkingDir("/a/b/c")(context.Background(), nil, &containers.Container{}, spec)
+	require.NoError(t, err)
+	assert.Equal(t, "/a/b/c", spec.Process.Cwd)
+}
+
+func TestWithMountsSelinuxRelabelModes(t *testing.T) {
+	type relabelCall struct {
+		path   string
+		shared bool
+	}
+	var calls []relabelCall
+	oldRelabelFunc := relabelFunc
+	relabelFunc = func(path, fileLabel string, shared bool) error {
+		calls = append(calls, relabelCall{path: path, shared: shared})
+		return nil
+	}
+	defer func() { relabelFunc = oldRelabelFunc }()
+
+	config := &runtime.ContainerConfig{
+		Annotations: map[string]string{
+			annotations.SelinuxRelabelModes: "/shared=z,/skipped=skip",
+		},
+		Mounts: []*runtime.Mount{
+			{ContainerPath: "/shared", HostPath: "/host-shared", SelinuxRelabel: true},
+			{ContainerPath: "/private", HostPath: "/host-private", SelinuxRelabel: true},
+			{ContainerPath: "/skipped", HostPath: "/host-skipped", SelinuxRelabel: true},
+		},
+	}
+	spec := &runtimespec.Spec{}
+	err := WithMounts(ostesting.NewFakeOS(), config, nil, "test-label", false)(context.Background(), nil, nil, spec)
+	require.NoError(t, err)
+
+	t.Logf("relabel should use the annotated sharing mode and skip opted out mounts")
+	assert.ElementsMatch(t, []relabelCall{
+		{path: "/host-shared", shared: true},
+		{path: "/host-private", shared: false},
+	}, calls)
+
+	t.Logf("an invalid relabel mode should be rejected")
+	config.Annotations[annotations.SelinuxRelabelModes] = "/shared=x"
+	err = WithMounts(ostesting.NewFakeOS(), config, nil, "test-label", false)(context.Background(), nil, nil, &runtimespec.Spec{})
+	assert.Error(t, err)
+}
+
+func TestWithMountsForceReadonly(t *testing.T) {
+	newConfig := func(readonlyRootfs bool, annotationsMap map[string]string) *runtime.ContainerConfig {
+		return &runtime.ContainerConfig{
+			Annotations: annotationsMap,
+			Mounts: []*runtime.Mount{
+				{ContainerPath: "/data", HostPath: "/host-data"},
+				{ContainerPath: "/scratch", HostPath: "/host-scratch"},
+			},
+			Linux: &runtime.LinuxContainerConfig{
+				SecurityContext: &runtime.LinuxContainerSecurityContext{
+					ReadonlyRootfs: readonlyRootfs,
+				},
+			},
+		}
+	}
+	mountOptions := func(s *runtimespec.Spec, dst string) []string {
+		for _, m := range s.Mounts {
+			if m.Destination == dst {
+				return m.Options
+			}
+		}
+		t.Fatalf("mount %q not found", dst)
+		return nil
+	}
+	for desc, test := range map[string]struct {
+		config        *runtime.ContainerConfig
+		forceReadonly bool
+		expectedData  string
+	}{
+		"mounts should stay writable without the option": {
+			config:       newConfig(true, nil),
+			expectedData: "rw",
+		},
+		"mounts should stay writable when rootfs is writable": {
+			config:        newConfig(false, nil),
+			forceReadonly: true,
+			expectedData:  "rw",
+		},
+		"mounts should become read-only for a read-only rootfs": {
+			config:        newConfig(true, nil),
+			forceReadonly: true,
+			expectedData:  "ro",
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		spec := &runtimespec.Spec{}
+		err := WithMounts(ostesting.NewFakeOS(), test.config, nil, "", test.forceReadonly)(context.Background(), nil, nil, spec)
+		require.NoError(t, err)
+		assert.Contains(t, mountOptions(spec, "/data"), test.expectedData)
+	}
+
+	t.Logf("an annotated mount should keep write access")
+	config := newConfig(true, map[string]string{
+		annotations.WritableMounts: "/scratch",
+	})
+	spec := &runtimespec.Spec{}
+	err := WithMounts(ostesting.NewFakeOS(), config, nil, "", true)(context.Background(), nil, nil, spec)
+	require.NoError(t, err)
+	assert.Contains(t, mountOptions(spec, "/data"), "ro")
+	assert.Contains(t, mountOptions(spec, "/scratch"), "rw")
+}
+
+func TestWithCapabilitySetDrops(t *testing.T) {
+	fullCaps := func() []string {
+		return []string{"CAP_CHOWN", "CAP_NET_RAW", "CAP_SYS_TIME"}
+	}
+	spec := &runtimespec.Spec{
+		Process: &runtimespec.Process{
+			Capabilities: &runtimespec.LinuxCapabilities{
+				Effective:   fullCaps(),
+				Permitted:   fullCaps(),
+				Inheritable: fullCaps(),
+				Bounding:    fullCaps(),
+				Ambient:     fullCaps(),
+			},
+		},
+	}
+	err := WithCapabilitySetDrops("bounding=NET_RAW;ambient=sys_time,net_raw")(context.Background(), nil, nil, spec)
+	require.NoError(t, err)
+
+	caps := spec.Process.Capabilities
+	t.Logf("only the listed sets should lose the dropped capabilities")
+	assert.Equal(t, []string{"CAP_CHOWN", "CAP_SYS_TIME"}, caps.Bounding)
+	assert.Equal(t, []string{"CAP_CHOWN"}, caps.Ambient)
+	t.Logf("the other sets should keep the capabilities")
+	assert.Equal(t, fullCaps(), caps.Effective)
+	assert.Equal(t, fullCaps(), caps.Permitted)
+	assert.Equal(t, fullCaps(), caps.Inheritable)
+
+	t.Logf("an invalid capability set should be rejected")
+	err = WithCapabilitySetDrops("invalid=NET_RAW")(context.Background(), nil, nil, spec)
+	assert.Error(t, err)
+	t.Logf("a malformed group should be rejected")
+	err = WithCapabilitySetDrops("bounding")(context.Background(), nil, nil, spec)
+	assert.Error(t, err)
+}
+
+func TestWithAmbientCapabilities(t *testing.T) {
+	newSpec := func(permitted, inheritable []string) *runtimespec.Spec {
+		return &runtimespec.Spec{
+			Process: &runtimespec.Process{
+				Capabilities: &runtimespec.LinuxCapabilities{
+					Permitted:   permitted,
+					Inheritable: inheritable,
+				},
+			},
+		}
+	}
+	sc := &runtime.LinuxContainerSecurityContext{
+		Capabilities: &runtime.Capability{
+			AddCapabilities: []string{"net_raw"},
+		},
+	}
+
+	t.Logf("added capabilities should be placed in the ambient set")
+	spec := newSpec([]string{"CAP_NET_RAW"}, []string{"CAP_NET_RAW"})
+	err := WithAmbientCapabilities(sc)(context.Background(), nil, nil, spec)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CAP_NET_RAW"}, spec.Process.Capabilities.Ambient)
+
+	t.Logf("an ambient capability missing from the permitted set should error")
+	spec = newSpec(nil, []string{"CAP_NET_RAW"})
+	err = WithAmbientCapabilities(sc)(context.Background(), nil, nil, spec)
+	assert.Error(t, err)
+
+	t.Logf("an ambient capability missing from the inheritable set should error")
+	spec = newSpec([]string{"CAP_NET_RAW"}, nil)
+	err = WithAmbientCapabilities(sc)(context.Background(), nil, nil, spec)
+	assert.Error(t, err)
+
+	t.Logf("no added capabilities should be a no-op")
+	spec = newSpec(nil, nil)
+	err = WithAmbientCapabilities(&runtime.LinuxContainerSecurityContext{})(context.Background(), nil, nil, spec)
+	require.NoError(t, err)
+	assert.Empty(t, spec.Process.Capabilities.Ambient)
+}
@@ -0,0 +1,102 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package ioutil
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// SlowConsumerPolicy selects how a buffered writer handles a consumer
+// which cannot keep up with the incoming writes.
+type SlowConsumerPolicy string
+
+const (
+	// SlowConsumerDrop silently discards writes while the queue is full.
+	SlowConsumerDrop SlowConsumerPolicy = "drop"
+	// SlowConsumerDisconnect fails the write while the queue is full, so
+	// that the caller closes and removes the writer.
+	SlowConsumerDisconnect SlowConsumerPolicy = "disconnect"
+)
+
+// bufferedWriteCloser decouples the writer from its consumer with a
+// bounded queue drained by a separate goroutine, so that one slow
+// consumer does not block the producer.
+type bufferedWriteCloser struct {
+	wc     io.WriteCloser
+	policy SlowConsumerPolicy
+
+	mu     sync.Mutex
+	queue  chan []byte
+	closed bool
+}
+
+// NewBufferedWriteCloser creates a write closer which buffers up to
+// queueSize writes to wc, applying the slow consumer policy when the
+// queue is full. The underlying writer is closed after the queue is
+// drained.
+func NewBufferedWriteCloser(wc io.WriteCloser, queueSize int, policy SlowConsumerPolicy) io.WriteCloser {
+	b := &bufferedWriteCloser{
+		wc:     wc,
+		policy: policy,
+		queue:  make(chan []byte, queueSize),
+	}
+	go func() {
+		for p := range b.queue {
+			// Keep draining on error so that Close is not blocked by
+			// pending writes; the error surfaces on Close of wc.
+			b.wc.Write(p) // nolint: errcheck
+		}
+		b.wc.Close()
+	}()
+	return b
+}
+
+// Write queues the data for the consumer. It never blocks; when the
+// queue is full the write is dropped or rejected per the policy.
+func (b *bufferedWriteCloser) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, errors.New("write to closed buffered writer")
+	}
+	q := make([]byte, len(p))
+	copy(q, p)
+	select {
+	case b.queue <- q:
+		return len(p), nil
+	default:
+	}
+	if b.policy == SlowConsumerDisconnect {
+		return 0, errors.New("slow consumer: write queue is full")
+	}
+	return len(p), nil
+}
+
+// Close stops accepting writes. The underlying writer is closed by the
+// drain goroutine once the queued writes are flushed.
+func (b *bufferedWriteCloser) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	close(b.queue)
+	return nil
+}
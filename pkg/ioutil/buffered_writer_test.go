@@ -0,0 +1,140 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package ioutil
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingWriteCloser records the written data and signals close.
+type recordingWriteCloser struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	closed chan struct{}
+	// block makes every write wait until the writer is unblocked.
+	block chan struct{}
+}
+
+func newRecordingWriteCloser(block bool) *recordingWriteCloser {
+	w := &recordingWriteCloser{closed: make(chan struct{})}
+	w.block = make(chan struct{})
+	if !block {
+		close(w.block)
+	}
+	return w
+}
+
+func (w *recordingWriteCloser) Write(p []byte) (int, error) {
+	<-w.block
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *recordingWriteCloser) Close() error {
+	select {
+	case <-w.closed:
+	default:
+		close(w.closed)
+	}
+	return nil
+}
+
+func (w *recordingWriteCloser) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestBufferedWriteCloserFlush(t *testing.T) {
+	dst := newRecordingWriteCloser(false)
+	w := NewBufferedWriteCloser(dst, 10, SlowConsumerDrop)
+	for i := 0; i < 3; i++ {
+		n, err := w.Write([]byte(fmt.Sprintf("line %d\n", i)))
+		require.NoError(t, err)
+		assert.Equal(t, 7, n)
+	}
+	require.NoError(t, w.Close())
+	select {
+	case <-dst.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("underlying writer was not closed after flush")
+	}
+	assert.Equal(t, "line 0\nline 1\nline 2\n", dst.String())
+}
+
+func TestWriterGroupWithSlowConsumer(t *testing.T) {
+	for desc, test := range map[string]struct {
+		policy      SlowConsumerPolicy
+		expectInErr bool
+	}{
+		"drop policy should keep the slow writer and discard overflow": {
+			policy: SlowConsumerDrop,
+		},
+		"disconnect policy should remove the slow writer from the group": {
+			policy:      SlowConsumerDisconnect,
+			expectInErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		group := NewWriterGroup()
+		fast := newRecordingWriteCloser(false)
+		slow := newRecordingWriteCloser(true)
+		group.Add("fast", fast)
+		group.Add("slow", NewBufferedWriteCloser(slow, 1, test.policy))
+
+		var sawOverflow bool
+		expected := new(bytes.Buffer)
+		for i := 0; i < 10; i++ {
+			data := []byte(fmt.Sprintf("line %d\n", i))
+			expected.Write(data)
+			group.Write(data) // nolint: errcheck
+			// The group removes the writer once a write overflows with
+			// the disconnect policy.
+			if group.Get("slow") == nil {
+				sawOverflow = true
+			}
+		}
+
+		t.Logf("the fast writer should receive everything")
+		assert.Equal(t, expected.String(), fast.String())
+
+		assert.Equal(t, test.expectInErr, sawOverflow)
+		if test.policy == SlowConsumerDrop {
+			assert.NotNil(t, group.Get("slow"))
+		}
+
+		// Unblock the slow writer and make sure it only saw a subset.
+		close(slow.block)
+		group.Close()
+		select {
+		case <-slow.closed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("slow writer was not closed")
+		}
+		got := strings.Count(slow.String(), "\n")
+		assert.True(t, got < 10, "slow writer should have missed writes, got %d", got)
+	}
+}
@@ -59,6 +59,23 @@ func (g *WriterGroup) Get(key string) io.WriteCloser {
 	return g.writers[key]
 }
 
+// Swap atomically replaces the writer for the key and returns the old
+// writer, or nil if there was none. The old writer is not closed; the
+// caller should close it after the swap, so that no write in between is
+// lost. If the writer group is closed, the new writer is closed
+// immediately and nil is returned.
+func (g *WriterGroup) Swap(key string, w io.WriteCloser) io.WriteCloser {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		w.Close()
+		return nil
+	}
+	old := g.writers[key]
+	g.writers[key] = w
+	return old
+}
+
 // Remove removes a writer from the group.
 func (g *WriterGroup) Remove(key string) {
 	g.mu.Lock()
@@ -95,6 +95,30 @@ func TestAddGetRemoveWriter(t *testing.T) {
 	wg.Close()
 }
 
+func TestSwapWriter(t *testing.T) {
+	wg := NewWriterGroup()
+	wc1, wc2 := &writeCloser{}, &writeCloser{}
+	key := "test-key"
+
+	assert.Nil(t, wg.Swap(key, wc1))
+	_, err := wg.Write([]byte("test data 1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test data 1", wc1.buf.String())
+
+	old := wg.Swap(key, wc2)
+	assert.Equal(t, wc1, old)
+	assert.False(t, wc1.closed, "swap should not close the old writer")
+	_, err = wg.Write([]byte("test data 2"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test data 1", wc1.buf.String())
+	assert.Equal(t, "test data 2", wc2.buf.String())
+
+	wg.Close()
+	newWC := &writeCloser{}
+	assert.Nil(t, wg.Swap(key, newWC))
+	assert.True(t, newWC.closed, "swap on a closed group should close the new writer")
+}
+
 func TestReplaceWriter(t *testing.T) {
 	wg := NewWriterGroup()
 	wc1, wc2 := &writeCloser{}, &writeCloser{}
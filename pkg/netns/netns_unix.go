@@ -48,7 +48,8 @@ import (
 	osinterface "github.com/containerd/cri/pkg/os"
 )
 
-const nsRunDir = "/var/run/netns"
+// NSRunDir is the directory under which cri creates network namespaces.
+const NSRunDir = "/var/run/netns"
 
 // Some of the following functions are migrated from
 // https://github.com/containernetworking/plugins/blob/master/pkg/testutils/netns_linux.go
@@ -64,13 +65,13 @@ func newNS() (nsPath string, err error) {
 	// Create the directory for mounting network namespaces
 	// This needs to be a shared mountpoint in case it is mounted in to
 	// other namespaces (containers)
-	if err := os.MkdirAll(nsRunDir, 0755); err != nil {
+	if err := os.MkdirAll(NSRunDir, 0755); err != nil {
 		return "", err
 	}
 
 	// create an empty file at the mount point
 	nsName := fmt.Sprintf("cni-%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
-	nsPath = path.Join(nsRunDir, nsName)
+	nsPath = path.Join(NSRunDir, nsName)
 	mountPointFd, err := os.Create(nsPath)
 	if err != nil {
 		return "", err
@@ -161,6 +162,9 @@ func getCurrentThreadNetNSPath() string {
 // NetNS holds network namespace.
 type NetNS struct {
 	path string
+	// external indicates that the network namespace is owned by someone
+	// else, e.g. pre-created by an orchestrator, and must not be removed.
+	external bool
 }
 
 // NewNetNS creates a network namespace.
@@ -177,9 +181,25 @@ func LoadNetNS(path string) *NetNS {
 	return &NetNS{path: path}
 }
 
+// LoadExternalNetNS loads a pre-created network namespace at the given path
+// after validating that the path is an existing network namespace. The
+// returned netns is not owned, Remove never unmounts or deletes the path.
+func LoadExternalNetNS(path string) (*NetNS, error) {
+	ns, err := cnins.GetNS(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid netns path %q", path)
+	}
+	ns.Close() // nolint: errcheck
+	return &NetNS{path: path, external: true}, nil
+}
+
 // Remove removes network namepace. Remove is idempotent, meaning it might
-// be invoked multiple times and provides consistent result.
+// be invoked multiple times and provides consistent result. Remove is a
+// no-op for an externally managed network namespace.
 func (n *NetNS) Remove() error {
+	if n.external {
+		return nil
+	}
 	return unmountNS(n.path)
 }
 
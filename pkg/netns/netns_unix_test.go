@@ -0,0 +1,51 @@
+// +build !windows
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package netns
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadExternalNetNS(t *testing.T) {
+	// The net namespace of the current process is a valid netns path
+	// which is not managed by cri.
+	path := "/proc/self/ns/net"
+	ns, err := LoadExternalNetNS(path)
+	require.NoError(t, err)
+	assert.Equal(t, path, ns.GetPath())
+
+	// Removing an externally managed netns must not touch the path.
+	assert.NoError(t, ns.Remove())
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+}
+
+func TestLoadExternalNetNSInvalidPath(t *testing.T) {
+	for _, path := range []string{
+		"/dev/null",
+		"/not/existent/path",
+	} {
+		_, err := LoadExternalNetNS(path)
+		assert.Error(t, err, "path %q", path)
+	}
+}
@@ -23,6 +23,9 @@ import "github.com/Microsoft/hcsshim/hcn"
 // NetNS holds network namespace for sandbox
 type NetNS struct {
 	path string
+	// external indicates that the network namespace is owned by someone
+	// else, e.g. pre-created by an orchestrator, and must not be removed.
+	external bool
 }
 
 // NewNetNS creates a network namespace for the sandbox
@@ -41,9 +44,23 @@ func LoadNetNS(path string) *NetNS {
 	return &NetNS{path: path}
 }
 
+// LoadExternalNetNS loads a pre-created network namespace with the given id
+// after validating that the namespace exists. The returned netns is not
+// owned, Remove never deletes the namespace.
+func LoadExternalNetNS(path string) (*NetNS, error) {
+	if _, err := hcn.GetNamespaceByID(path); err != nil {
+		return nil, err
+	}
+	return &NetNS{path: path, external: true}, nil
+}
+
 // Remove removes network namepace if it exists and not closed. Remove is idempotent,
-// meaning it might be invoked multiple times and provides consistent result.
+// meaning it might be invoked multiple times and provides consistent result. Remove
+// is a no-op for an externally managed network namespace.
 func (n *NetNS) Remove() error {
+	if n.external {
+		return nil
+	}
 	hcnNamespace, err := hcn.GetNamespaceByID(n.path)
 	if err != nil {
 		if hcn.IsNotFoundError(err) {
@@ -28,8 +28,10 @@ import (
 // during tests.
 type OS interface {
 	MkdirAll(path string, perm os.FileMode) error
+	Chown(name string, uid, gid int) error
 	RemoveAll(path string) error
 	Stat(name string) (os.FileInfo, error)
+	ReadDir(dirname string) ([]os.FileInfo, error)
 	ResolveSymbolicLink(name string) (string, error)
 	FollowSymlinkInScope(path, scope string) (string, error)
 	CopyFile(src, dest string, perm os.FileMode) error
@@ -45,6 +47,11 @@ func (RealOS) MkdirAll(path string, perm os.FileMode) error {
 	return os.MkdirAll(path, perm)
 }
 
+// Chown will call os.Chown to change the ownership of the given file.
+func (RealOS) Chown(name string, uid, gid int) error {
+	return os.Chown(name, uid, gid)
+}
+
 // RemoveAll will call os.RemoveAll to remove the path and its children.
 func (RealOS) RemoveAll(path string) error {
 	return os.RemoveAll(path)
@@ -55,6 +62,11 @@ func (RealOS) Stat(name string) (os.FileInfo, error) {
 	return os.Stat(name)
 }
 
+// ReadDir will call ioutil.ReadDir to list the directory entries.
+func (RealOS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dirname)
+}
+
 // FollowSymlinkInScope will call symlink.FollowSymlinkInScope.
 func (RealOS) FollowSymlinkInScope(path, scope string) (string, error) {
 	return symlink.FollowSymlinkInScope(path, scope)
@@ -39,8 +39,10 @@ type CalledDetail struct {
 type FakeOS struct {
 	sync.Mutex
 	MkdirAllFn             func(string, os.FileMode) error
+	ChownFn                func(string, int, int) error
 	RemoveAllFn            func(string) error
 	StatFn                 func(string) (os.FileInfo, error)
+	ReadDirFn              func(string) ([]os.FileInfo, error)
 	ResolveSymbolicLinkFn  func(string) (string, error)
 	FollowSymlinkInScopeFn func(string, string) (string, error)
 	CopyFileFn             func(string, string, os.FileMode) error
@@ -123,6 +125,19 @@ func (f *FakeOS) MkdirAll(path string, perm os.FileMode) error {
 	return nil
 }
 
+// Chown is a fake call that invokes ChownFn or just returns nil.
+func (f *FakeOS) Chown(name string, uid, gid int) error {
+	f.appendCalls("Chown", name, uid, gid)
+	if err := f.getError("Chown"); err != nil {
+		return err
+	}
+
+	if f.ChownFn != nil {
+		return f.ChownFn(name, uid, gid)
+	}
+	return nil
+}
+
 // RemoveAll is a fake call that invokes RemoveAllFn or just returns nil.
 func (f *FakeOS) RemoveAll(path string) error {
 	f.appendCalls("RemoveAll", path)
@@ -149,6 +164,19 @@ func (f *FakeOS) Stat(name string) (os.FileInfo, error) {
 	return nil, nil
 }
 
+// ReadDir is a fake call that invokes ReadDirFn or just returns nil.
+func (f *FakeOS) ReadDir(dirname string) ([]os.FileInfo, error) {
+	f.appendCalls("ReadDir", dirname)
+	if err := f.getError("ReadDir"); err != nil {
+		return nil, err
+	}
+
+	if f.ReadDirFn != nil {
+		return f.ReadDirFn(dirname)
+	}
+	return nil, nil
+}
+
 // ResolveSymbolicLink is a fake call that invokes ResolveSymbolicLinkFn or returns its input
 func (f *FakeOS) ResolveSymbolicLink(path string) (string, error) {
 	f.appendCalls("ResolveSymbolicLink", path)
@@ -52,3 +52,23 @@ func TestRegistrar(t *testing.T) {
 	t.Logf("should be able to reserve same name/key name<->key")
 	assert.NoError(r.Reserve("same-name-id", "same-name-id"))
 }
+
+func TestGetKeyByName(t *testing.T) {
+	r := NewRegistrar()
+	assert := assertlib.New(t)
+
+	t.Logf("should not find a key for an unreserved name")
+	_, ok := r.GetKeyByName("test-name")
+	assert.False(ok)
+
+	t.Logf("should find the key for a reserved name")
+	assert.NoError(r.Reserve("test-name", "test-id"))
+	key, ok := r.GetKeyByName("test-name")
+	assert.True(ok)
+	assert.Equal("test-id", key)
+
+	t.Logf("should not find the key after release")
+	r.ReleaseByName("test-name")
+	_, ok = r.GetKeyByName("test-name")
+	assert.False(ok)
+}
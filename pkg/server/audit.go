@@ -0,0 +1,89 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDMetadataKey is the gRPC metadata key carrying the caller provided
+// request id included in audit records.
+const requestIDMetadataKey = "x-request-id"
+
+// auditRecord is a single structured record emitted for a mutating CRI call
+// when audit logging is enabled.
+type auditRecord struct {
+	// RequestID is the caller provided request id, if any.
+	RequestID string `json:"requestID,omitempty"`
+	// Operation is the CRI operation name.
+	Operation string `json:"operation"`
+	// Target is the id of the object the operation applies to.
+	Target string `json:"target,omitempty"`
+	// Error is the error message when the operation failed.
+	Error string `json:"error,omitempty"`
+	// Duration is how long the operation took.
+	Duration time.Duration `json:"duration"`
+}
+
+// auditor emits one structured audit record per mutating CRI call.
+type auditor struct {
+	// emit publishes an audit record. It is swappable for testing.
+	emit func(*auditRecord)
+}
+
+// newAuditor creates an auditor which logs audit records as structured
+// logrus entries.
+func newAuditor() *auditor {
+	return &auditor{
+		emit: func(r *auditRecord) {
+			logrus.WithFields(logrus.Fields{
+				"audit":     true,
+				"requestID": r.RequestID,
+				"operation": r.Operation,
+				"target":    r.Target,
+				"error":     r.Error,
+				"duration":  r.Duration,
+			}).Info("CRI audit")
+		},
+	}
+}
+
+// record emits a single audit record for a mutating operation. It is a no-op
+// when audit logging is disabled, i.e. the auditor is nil.
+func (a *auditor) record(ctx context.Context, operation, target string, start time.Time, err error) {
+	if a == nil {
+		return
+	}
+	r := &auditRecord{
+		Operation: operation,
+		Target:    target,
+		Duration:  time.Since(start),
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDMetadataKey); len(ids) != 0 {
+			r.RequestID = ids[0]
+		}
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	a.emit(r)
+}
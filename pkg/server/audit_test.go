@@ -0,0 +1,142 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+
+	"github.com/containerd/cri/pkg/atomic"
+)
+
+func TestAuditMutatingCalls(t *testing.T) {
+	c := newTestCRIService()
+	c.initialized = atomic.NewBool(true)
+	var records []*auditRecord
+	in := &instrumentedService{
+		c: c,
+		auditor: &auditor{emit: func(r *auditRecord) {
+			records = append(records, r)
+		}},
+	}
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(requestIDMetadataKey, "test-request-id"))
+	for desc, test := range map[string]struct {
+		call      func() error
+		operation string
+		target    string
+	}{
+		"RunPodSandbox": {
+			call: func() error {
+				_, err := in.RunPodSandbox(ctx, &runtime.RunPodSandboxRequest{})
+				return err
+			},
+			operation: "RunPodSandbox",
+		},
+		"StopPodSandbox": {
+			call: func() error {
+				_, err := in.StopPodSandbox(ctx, &runtime.StopPodSandboxRequest{PodSandboxId: "sandbox-id"})
+				return err
+			},
+			operation: "StopPodSandbox",
+			target:    "sandbox-id",
+		},
+		"RemovePodSandbox": {
+			call: func() error {
+				_, err := in.RemovePodSandbox(ctx, &runtime.RemovePodSandboxRequest{PodSandboxId: "sandbox-id"})
+				return err
+			},
+			operation: "RemovePodSandbox",
+			target:    "sandbox-id",
+		},
+		"CreateContainer": {
+			call: func() error {
+				_, err := in.CreateContainer(ctx, &runtime.CreateContainerRequest{PodSandboxId: "sandbox-id"})
+				return err
+			},
+			operation: "CreateContainer",
+		},
+		"StartContainer": {
+			call: func() error {
+				_, err := in.StartContainer(ctx, &runtime.StartContainerRequest{ContainerId: "container-id"})
+				return err
+			},
+			operation: "StartContainer",
+			target:    "container-id",
+		},
+		"StopContainer": {
+			call: func() error {
+				_, err := in.StopContainer(ctx, &runtime.StopContainerRequest{ContainerId: "container-id"})
+				return err
+			},
+			operation: "StopContainer",
+			target:    "container-id",
+		},
+		"RemoveContainer": {
+			call: func() error {
+				_, err := in.RemoveContainer(ctx, &runtime.RemoveContainerRequest{ContainerId: "container-id"})
+				return err
+			},
+			operation: "RemoveContainer",
+			target:    "container-id",
+		},
+		"UpdateContainerResources": {
+			call: func() error {
+				_, err := in.UpdateContainerResources(ctx, &runtime.UpdateContainerResourcesRequest{ContainerId: "container-id"})
+				return err
+			},
+			operation: "UpdateContainerResources",
+			target:    "container-id",
+		},
+		"RemoveImage": {
+			call: func() error {
+				_, err := in.RemoveImage(ctx, &runtime.RemoveImageRequest{Image: &runtime.ImageSpec{Image: "image-ref"}})
+				return err
+			},
+			operation: "RemoveImage",
+			target:    "image-ref",
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		records = nil
+		err := test.call()
+		require.Len(t, records, 1, "exactly one audit record should be emitted")
+		record := records[0]
+		assert.Equal(t, "test-request-id", record.RequestID)
+		assert.Equal(t, test.operation, record.Operation)
+		assert.Equal(t, test.target, record.Target)
+		if err != nil {
+			assert.NotEmpty(t, record.Error)
+		} else {
+			assert.Empty(t, record.Error)
+		}
+	}
+}
+
+func TestAuditDisabled(t *testing.T) {
+	c := newTestCRIService()
+	c.initialized = atomic.NewBool(true)
+	in := &instrumentedService{c: c}
+	// The nil auditor should be a no-op instead of panicking.
+	_, err := in.StopContainer(context.Background(), &runtime.StopContainerRequest{ContainerId: "container-id"})
+	assert.Error(t, err)
+}
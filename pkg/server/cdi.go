@@ -0,0 +1,217 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// cdiAnnotationPrefix is the prefix of container annotations requesting
+// CDI (Container Device Interface) device injection. The annotation value
+// is a comma-separated list of qualified device names, e.g.
+// "vendor.example.com/gpu=gpu0".
+const cdiAnnotationPrefix = "cdi.k8s.io/"
+
+// cdiSpec is a CDI spec file describing the devices of one device kind.
+type cdiSpec struct {
+	Version string      `json:"cdiVersion"`
+	Kind    string      `json:"kind"`
+	Devices []cdiDevice `json:"devices"`
+}
+
+// cdiDevice is a single device entry of a CDI spec.
+type cdiDevice struct {
+	Name           string            `json:"name"`
+	ContainerEdits cdiContainerEdits `json:"containerEdits"`
+}
+
+// cdiContainerEdits are the OCI spec edits a CDI device requires.
+type cdiContainerEdits struct {
+	Env         []string        `json:"env"`
+	DeviceNodes []cdiDeviceNode `json:"deviceNodes"`
+	Mounts      []cdiMount      `json:"mounts"`
+}
+
+// cdiDeviceNode is a device node injected by a CDI device.
+type cdiDeviceNode struct {
+	Path        string `json:"path"`
+	Type        string `json:"type"`
+	Major       int64  `json:"major"`
+	Minor       int64  `json:"minor"`
+	Permissions string `json:"permissions"`
+}
+
+// cdiMount is a mount injected by a CDI device.
+type cdiMount struct {
+	HostPath      string   `json:"hostPath"`
+	ContainerPath string   `json:"containerPath"`
+	Options       []string `json:"options"`
+}
+
+// cdiDevicesFromAnnotations returns the qualified CDI device names requested
+// by the container annotations.
+func cdiDevicesFromAnnotations(annotations map[string]string) []string {
+	var devices []string
+	for key, value := range annotations {
+		if !strings.HasPrefix(key, cdiAnnotationPrefix) {
+			continue
+		}
+		for _, device := range strings.Split(value, ",") {
+			if device = strings.TrimSpace(device); device != "" {
+				devices = append(devices, device)
+			}
+		}
+	}
+	return devices
+}
+
+// cdiSpecOpts resolves the CDI device annotations of the container against
+// the CDI spec files on disk, and returns spec options merging the device
+// nodes, mounts and env of the resolved devices into the OCI spec. An
+// unresolvable device is an error, so that a container never silently runs
+// without a requested device.
+func (c *criService) cdiSpecOpts(config *runtime.ContainerConfig) ([]oci.SpecOpts, error) {
+	devices := cdiDevicesFromAnnotations(config.GetAnnotations())
+	if len(devices) == 0 {
+		return nil, nil
+	}
+	specs := loadCDISpecs(c.config.CDISpecDirs)
+	var specOpts []oci.SpecOpts
+	for _, device := range devices {
+		parts := strings.SplitN(device, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid CDI device name %q", device)
+		}
+		kind, name := parts[0], parts[1]
+		edits, err := resolveCDIDevice(specs, kind, name)
+		if err != nil {
+			return nil, err
+		}
+		specOpts = append(specOpts, withCDIEdits(edits))
+	}
+	return specOpts, nil
+}
+
+// loadCDISpecs parses all CDI spec files found in the given directories.
+// Missing directories are ignored, and malformed files only log a warning,
+// so that one broken vendor file can not break all device injection.
+func loadCDISpecs(dirs []string) []cdiSpec {
+	var specs []cdiSpec
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logrus.WithError(err).Warnf("Failed to read CDI spec dir %q", dir)
+			}
+			continue
+		}
+		for _, file := range files {
+			if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+				continue
+			}
+			path := filepath.Join(dir, file.Name())
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				logrus.WithError(err).Warnf("Failed to read CDI spec %q", path)
+				continue
+			}
+			var spec cdiSpec
+			if err := json.Unmarshal(data, &spec); err != nil {
+				logrus.WithError(err).Warnf("Failed to parse CDI spec %q", path)
+				continue
+			}
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// resolveCDIDevice returns the container edits of the named device.
+func resolveCDIDevice(specs []cdiSpec, kind, name string) (cdiContainerEdits, error) {
+	for _, spec := range specs {
+		if spec.Kind != kind {
+			continue
+		}
+		for _, device := range spec.Devices {
+			if device.Name == name {
+				return device.ContainerEdits, nil
+			}
+		}
+	}
+	return cdiContainerEdits{}, errors.Errorf("unresolvable CDI device %q=%q: no matching device in CDI specs", kind, name)
+}
+
+// withCDIEdits merges the container edits of a CDI device into the spec.
+func withCDIEdits(edits cdiContainerEdits) oci.SpecOpts {
+	return func(ctx context.Context, client oci.Client, container *containers.Container, s *runtimespec.Spec) error {
+		if len(edits.Env) != 0 {
+			if s.Process == nil {
+				s.Process = &runtimespec.Process{}
+			}
+			s.Process.Env = append(s.Process.Env, edits.Env...)
+		}
+		for _, m := range edits.Mounts {
+			s.Mounts = append(s.Mounts, runtimespec.Mount{
+				Source:      m.HostPath,
+				Destination: m.ContainerPath,
+				Options:     m.Options,
+			})
+		}
+		if len(edits.DeviceNodes) == 0 {
+			return nil
+		}
+		if s.Linux == nil {
+			s.Linux = &runtimespec.Linux{}
+		}
+		if s.Linux.Resources == nil {
+			s.Linux.Resources = &runtimespec.LinuxResources{}
+		}
+		for _, d := range edits.DeviceNodes {
+			major, minor := d.Major, d.Minor
+			s.Linux.Devices = append(s.Linux.Devices, runtimespec.LinuxDevice{
+				Path:  d.Path,
+				Type:  d.Type,
+				Major: major,
+				Minor: minor,
+			})
+			access := d.Permissions
+			if access == "" {
+				access = "rwm"
+			}
+			s.Linux.Resources.Devices = append(s.Linux.Resources.Devices, runtimespec.LinuxDeviceCgroup{
+				Allow:  true,
+				Type:   d.Type,
+				Major:  &major,
+				Minor:  &minor,
+				Access: access,
+			})
+		}
+		return nil
+	}
+}
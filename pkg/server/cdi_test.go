@@ -0,0 +1,94 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const testCDISpec = `{
+  "cdiVersion": "0.3.0",
+  "kind": "vendor.example.com/gpu",
+  "devices": [
+    {
+      "name": "gpu0",
+      "containerEdits": {
+        "env": ["GPU_ID=0"],
+        "deviceNodes": [
+          {"path": "/dev/gpu0", "type": "c", "major": 240, "minor": 0}
+        ],
+        "mounts": [
+          {"hostPath": "/usr/lib/gpu", "containerPath": "/usr/lib/gpu", "options": ["ro", "rbind"]}
+        ]
+      }
+    }
+  ]
+}`
+
+func TestCDIDeviceInjection(t *testing.T) {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "test-cdi")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, "vendor.json"), []byte(testCDISpec), 0644))
+
+	c := newTestCRIService()
+	c.config.CDISpecDirs = []string{tempDir}
+
+	t.Logf("no CDI annotation should produce no spec options")
+	opts, err := c.cdiSpecOpts(&runtime.ContainerConfig{})
+	require.NoError(t, err)
+	assert.Empty(t, opts)
+
+	t.Logf("a known CDI device should inject its nodes, mounts and env")
+	config := &runtime.ContainerConfig{
+		Annotations: map[string]string{
+			cdiAnnotationPrefix + "gpus": "vendor.example.com/gpu=gpu0",
+		},
+	}
+	opts, err = c.cdiSpecOpts(config)
+	require.NoError(t, err)
+	require.Len(t, opts, 1)
+	spec := &runtimespec.Spec{}
+	require.NoError(t, opts[0](context.Background(), nil, nil, spec))
+	assert.Contains(t, spec.Process.Env, "GPU_ID=0")
+	require.Len(t, spec.Linux.Devices, 1)
+	assert.Equal(t, "/dev/gpu0", spec.Linux.Devices[0].Path)
+	assert.Equal(t, int64(240), spec.Linux.Devices[0].Major)
+	require.Len(t, spec.Linux.Resources.Devices, 1)
+	assert.Equal(t, "rwm", spec.Linux.Resources.Devices[0].Access)
+	require.Len(t, spec.Mounts, 1)
+	assert.Equal(t, "/usr/lib/gpu", spec.Mounts[0].Destination)
+
+	t.Logf("an unknown CDI device should error clearly")
+	config = &runtime.ContainerConfig{
+		Annotations: map[string]string{
+			cdiAnnotationPrefix + "gpus": "vendor.example.com/gpu=missing",
+		},
+	}
+	_, err = c.cdiSpecOpts(config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unresolvable CDI device")
+}
@@ -0,0 +1,48 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	criconfig "github.com/containerd/cri/pkg/config"
+)
+
+// reloadConfig applies the mutable subset of the plugin config to the running
+// service, so that config changes like registry mirrors or resource limits
+// can be picked up without recreating the service. Changes to immutable
+// fields are refused with a logged warning.
+func (c *criService) reloadConfig(newConfig criconfig.PluginConfig) error {
+	if newConfig.ContainerdConfig.Snapshotter != c.config.ContainerdConfig.Snapshotter {
+		logrus.Warnf("Refusing config reload, snapshotter is immutable and can not be changed from %q to %q",
+			c.config.ContainerdConfig.Snapshotter, newConfig.ContainerdConfig.Snapshotter)
+		return errors.New("snapshotter is immutable")
+	}
+	if newConfig.ContainerdConfig.DefaultRuntimeName != c.config.ContainerdConfig.DefaultRuntimeName {
+		logrus.Warnf("Refusing config reload, default runtime is immutable and can not be changed from %q to %q",
+			c.config.ContainerdConfig.DefaultRuntimeName, newConfig.ContainerdConfig.DefaultRuntimeName)
+		return errors.New("default runtime is immutable")
+	}
+	c.config.Registry = newConfig.Registry
+	c.config.MaxSandboxes = newConfig.MaxSandboxes
+	c.config.MaxContainers = newConfig.MaxContainers
+	c.config.MaxContainerDevices = newConfig.MaxContainerDevices
+	c.config.MaxConcurrentDownloads = newConfig.MaxConcurrentDownloads
+	logrus.Info("Reloaded mutable CRI config")
+	return nil
+}
@@ -0,0 +1,46 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	criconfig "github.com/containerd/cri/pkg/config"
+)
+
+func TestReloadConfig(t *testing.T) {
+	c := newTestCRIService()
+	c.config.ContainerdConfig.Snapshotter = "overlayfs"
+
+	t.Logf("a registry mirror change should be applied live")
+	newConfig := c.config.PluginConfig
+	newConfig.Registry.Mirrors = map[string]criconfig.Mirror{
+		"docker.io": {Endpoints: []string{"https://mirror.example.com"}},
+	}
+	require.NoError(t, c.reloadConfig(newConfig))
+	assert.Equal(t, []string{"https://mirror.example.com"},
+		c.config.Registry.Mirrors["docker.io"].Endpoints)
+
+	t.Logf("a snapshotter change should be refused")
+	newConfig = c.config.PluginConfig
+	newConfig.ContainerdConfig.Snapshotter = "btrfs"
+	assert.Error(t, c.reloadConfig(newConfig))
+	assert.Equal(t, "overlayfs", c.config.ContainerdConfig.Snapshotter)
+}
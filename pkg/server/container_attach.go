@@ -26,6 +26,7 @@ import (
 	"k8s.io/client-go/tools/remotecommand"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
+	cioutil "github.com/containerd/cri/pkg/ioutil"
 	cio "github.com/containerd/cri/pkg/server/io"
 )
 
@@ -68,6 +69,21 @@ func (c *criService) attachContainer(ctx context.Context, id string, stdin io.Re
 		}
 	})
 
+	// Buffer the output streams so that one slow attach consumer does not
+	// stall container output piping for everyone else.
+	if size := c.config.StreamWriteQueueSize; size > 0 {
+		policy := cioutil.SlowConsumerPolicy(c.config.StreamSlowConsumerPolicy)
+		if policy == "" {
+			policy = cioutil.SlowConsumerDrop
+		}
+		if stdout != nil {
+			stdout = cioutil.NewBufferedWriteCloser(stdout, size, policy)
+		}
+		if stderr != nil {
+			stderr = cioutil.NewBufferedWriteCloser(stderr, size, policy)
+		}
+	}
+
 	opts := cio.AttachOptions{
 		Stdin:     stdin,
 		Stdout:    stdout,
@@ -17,22 +17,32 @@
 package server
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/log"
 	"github.com/containerd/containerd/oci"
+	"github.com/containerd/containerd/snapshots"
 	"github.com/containerd/typeurl"
 	"github.com/davecgh/go-spew/spew"
+	"github.com/docker/go-units"
 	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
 	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
 	selinux "github.com/opencontainers/selinux/go-selinux"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
+	"github.com/containerd/cri/pkg/annotations"
 	customopts "github.com/containerd/cri/pkg/containerd/opts"
 	ctrdutil "github.com/containerd/cri/pkg/containerd/util"
 	cio "github.com/containerd/cri/pkg/server/io"
@@ -47,6 +57,13 @@ func init() {
 
 // CreateContainer creates a new container in the given PodSandbox.
 func (c *criService) CreateContainer(ctx context.Context, r *runtime.CreateContainerRequest) (_ *runtime.CreateContainerResponse, retErr error) {
+	defer c.trackOperation()()
+	if c.draining.IsSet() {
+		return nil, errors.Wrap(errdefs.ErrUnavailable, "server is draining, not accepting new containers")
+	}
+	if err := c.checkContainerLimit(); err != nil {
+		return nil, err
+	}
 	config := r.GetConfig()
 	log.G(ctx).Debugf("Container config %+v", config)
 	sandboxConfig := r.GetSandboxConfig()
@@ -55,22 +72,32 @@ func (c *criService) CreateContainer(ctx context.Context, r *runtime.CreateConta
 		return nil, errors.Wrapf(err, "failed to find sandbox id %q", r.GetPodSandboxId())
 	}
 	sandboxID := sandbox.ID
+
+	metadata := config.GetMetadata()
+	if metadata == nil {
+		return nil, errors.New("container config must include metadata")
+	}
+	containerName := metadata.Name
+	name := makeContainerName(metadata, sandboxConfig.GetMetadata())
+	// Kubelet may retry `CreateContainer` after a lost response even though
+	// the previous attempt actually succeeded and left the name reserved.
+	// Return the existing container instead of a name conflict error to keep
+	// the request idempotent.
+	if id, ok := c.getExistingContainerID(name); ok {
+		log.G(ctx).Infof("Container %q already exists with id %q, no-op for idempotent retry", name, id)
+		return &runtime.CreateContainerResponse{ContainerId: id}, nil
+	}
+
 	s, err := sandbox.Container.Task(ctx, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get sandbox container task")
 	}
 	sandboxPid := s.Pid()
 
-	// Generate unique id and name for the container and reserve the name.
+	// Generate unique id for the container and reserve the name.
 	// Reserve the container name to avoid concurrent `CreateContainer` request creating
 	// the same container.
 	id := util.GenerateID()
-	metadata := config.GetMetadata()
-	if metadata == nil {
-		return nil, errors.New("container config must include metadata")
-	}
-	containerName := metadata.Name
-	name := makeContainerName(metadata, sandboxConfig.GetMetadata())
 	log.G(ctx).Debugf("Generated id %q for container %q", id, name)
 	if err = c.containerNameIndex.Reserve(name, id); err != nil {
 		return nil, errors.Wrapf(err, "failed to reserve container name %q", name)
@@ -96,6 +123,10 @@ func (c *criService) CreateContainer(ctx context.Context, r *runtime.CreateConta
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to resolve image %q", config.GetImage().GetImage())
 	}
+	// Reject oversized images before preparing the snapshot.
+	if max := c.config.MaxImageSize; max > 0 && image.Size > max {
+		return nil, errors.Errorf("image %q size %d exceeds the size limit %d", image.ID, image.Size, max)
+	}
 	containerdImage, err := c.toContainerdImage(ctx, image)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to get image from containerd %q", image.ID)
@@ -141,12 +172,15 @@ func (c *criService) CreateContainer(ctx context.Context, r *runtime.CreateConta
 	if !c.config.IgnoreImageDefinedVolumes {
 		// Create container image volumes mounts.
 		volumeMounts = c.volumeMounts(containerRootDir, config.GetMounts(), &image.ImageSpec.Config)
+		if err := c.createImageVolumeDirs(volumeMounts, &image.ImageSpec.Config); err != nil {
+			return nil, errors.Wrap(err, "failed to create image volume directories")
+		}
 	} else if len(image.ImageSpec.Config.Volumes) != 0 {
 		log.G(ctx).Debugf("Ignoring volumes defined in image %v because IgnoreImageDefinedVolumes is set", image.ID)
 	}
 
 	// Generate container mounts.
-	mounts := c.containerMounts(sandboxID, config)
+	mounts := c.containerMounts(id, sandboxID, config)
 
 	ociRuntime, err := c.getSandboxRuntime(sandboxConfig, sandbox.Metadata.RuntimeHandler)
 	if err != nil {
@@ -174,15 +208,19 @@ func (c *criService) CreateContainer(ctx context.Context, r *runtime.CreateConta
 
 	log.G(ctx).Debugf("Container %q spec: %#+v", id, spew.NewFormatter(spec))
 
+	snapshotOpts, err := c.snapshotQuotaOpts(ctx, c.runtimeSnapshotter(ociRuntime), config)
+	if err != nil {
+		return nil, err
+	}
 	// Set snapshotter before any other options.
 	opts := []containerd.NewContainerOpts{
-		containerd.WithSnapshotter(c.config.ContainerdConfig.Snapshotter),
+		containerd.WithSnapshotter(c.runtimeSnapshotter(ociRuntime)),
 		// Prepare container rootfs. This is always writeable even if
 		// the container wants a readonly rootfs since we want to give
 		// the runtime (runc) a chance to modify (e.g. to create mount
 		// points corresponding to spec.Mounts) before making the
 		// rootfs readonly (requested by spec.Root.Readonly).
-		customopts.WithNewSnapshot(id, containerdImage),
+		customopts.WithNewSnapshot(id, containerdImage, snapshotOpts...),
 	}
 	if len(volumeMounts) > 0 {
 		mountMap := make(map[string]string)
@@ -204,8 +242,14 @@ func (c *criService) CreateContainer(ctx context.Context, r *runtime.CreateConta
 			sandboxConfig.GetLogDirectory(), config.GetLogPath())
 	}
 
-	containerIO, err := cio.NewContainerIO(id,
-		cio.WithNewFIFOs(volatileContainerRootDir, config.GetTty(), config.GetStdin()))
+	ioOpts := []cio.ContainerIOOpts{
+		cio.WithNewFIFOs(volatileContainerRootDir, config.GetTty(), config.GetStdin()),
+		cio.WithCopyBufferSize(c.config.StreamCopyBufferSize),
+	}
+	if config.GetAnnotations()[annotations.CombinedOutput] == "true" {
+		ioOpts = append(ioOpts, cio.WithCombinedOutput())
+	}
+	containerIO, err := cio.NewContainerIO(id, ioOpts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create container io")
 	}
@@ -234,7 +278,7 @@ func (c *criService) CreateContainer(ctx context.Context, r *runtime.CreateConta
 		containerd.WithContainerLabels(containerLabels),
 		containerd.WithContainerExtension(containerMetadataExtension, &meta))
 	var cntr containerd.Container
-	if cntr, err = c.client.NewContainer(ctx, id, opts...); err != nil {
+	if cntr, err = c.newContainerdContainer(ctx, id, opts...); err != nil {
 		return nil, errors.Wrap(err, "failed to create containerd container")
 	}
 	defer func() {
@@ -273,6 +317,172 @@ func (c *criService) CreateContainer(ctx context.Context, r *runtime.CreateConta
 	return &runtime.CreateContainerResponse{ContainerId: id}, nil
 }
 
+// DryRunContainerSpec generates the OCI runtime spec `CreateContainer`
+// would produce for the given request and returns it serialized as JSON,
+// without creating the container, its snapshot or any on-disk state. It is
+// exposed so that a debug endpoint can show the effect of the cri config
+// and the container annotations on the generated spec.
+func (c *criService) DryRunContainerSpec(ctx context.Context, r *runtime.CreateContainerRequest) ([]byte, error) {
+	config := r.GetConfig()
+	sandboxConfig := r.GetSandboxConfig()
+	sandbox, err := c.sandboxStore.Get(r.GetPodSandboxId())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find sandbox id %q", r.GetPodSandboxId())
+	}
+	metadata := config.GetMetadata()
+	if metadata == nil {
+		return nil, errors.New("container config must include metadata")
+	}
+	image, err := c.localResolve(config.GetImage().GetImage())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve image %q", config.GetImage().GetImage())
+	}
+	ociRuntime, err := c.getSandboxRuntime(sandboxConfig, sandbox.Metadata.RuntimeHandler)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get sandbox runtime")
+	}
+
+	// Generate a throwaway id for path construction inside the spec;
+	// nothing is created or reserved for it.
+	id := util.GenerateID()
+	var volumeMounts []*runtime.Mount
+	if !c.config.IgnoreImageDefinedVolumes {
+		volumeMounts = c.volumeMounts(c.getContainerRootDir(id), config.GetMounts(), &image.ImageSpec.Config)
+	}
+	mounts := c.containerMounts(id, sandbox.ID, config)
+
+	// Use the sandbox pid recorded in the sandbox store instead of asking
+	// containerd for the sandbox task.
+	spec, err := c.containerSpec(id, sandbox.ID, sandbox.Status.Get().Pid, sandbox.NetNSPath, metadata.Name,
+		config, sandboxConfig, &image.ImageSpec.Config, append(mounts, volumeMounts...), ociRuntime)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to generate container %q spec", id)
+	}
+	// Release the selinux label allocated during spec generation, the
+	// container is never created.
+	selinux.ReleaseLabel(spec.Process.SelinuxLabel)
+	return json.Marshal(spec)
+}
+
+// getExistingContainerID returns the id of an existing container with the
+// given name. It only returns an id when the name is reserved and the
+// container made it into the container store, i.e. a previous
+// `CreateContainer` with the same metadata fully succeeded. A reserved name
+// without a container in the store means a creation is still in flight and
+// is left to fail with a name conflict.
+func (c *criService) getExistingContainerID(name string) (string, bool) {
+	id, ok := c.containerNameIndex.GetKeyByName(name)
+	if !ok {
+		return "", false
+	}
+	if _, err := c.containerStore.Get(id); err != nil {
+		return "", false
+	}
+	return id, true
+}
+
+// newContainerdContainer creates the backing containerd container, going
+// through the injected creator when unit tests provide one.
+func (c *criService) newContainerdContainer(ctx context.Context, id string, opts ...containerd.NewContainerOpts) (containerd.Container, error) {
+	if c.createContainerdContainer != nil {
+		return c.createContainerdContainer(ctx, id, opts...)
+	}
+	return c.client.NewContainer(ctx, id, opts...)
+}
+
+// snapshotQuotaLabel is the snapshot label carrying the requested
+// writable-layer disk quota in bytes. Snapshotters which support quota
+// enforcement (e.g. overlay backed by project quotas) read it at snapshot
+// creation time.
+const snapshotQuotaLabel = "containerd.io/snapshot/cri.rootfs-quota"
+
+// quotaSnapshotters is the set of snapshotters known to enforce the
+// writable-layer quota label.
+var quotaSnapshotters = map[string]struct{}{
+	"overlayfs": {},
+}
+
+// snapshotQuotaOpts returns snapshot options applying the writable-layer
+// quota requested via the container annotation. The annotation is logged
+// and ignored when the configured snapshotter does not support quota
+// enforcement.
+func (c *criService) snapshotQuotaOpts(ctx context.Context, snapshotter string, config *runtime.ContainerConfig) ([]snapshots.Opt, error) {
+	quota := config.GetAnnotations()[annotations.RootfsQuota]
+	if quota == "" {
+		return nil, nil
+	}
+	size, err := units.RAMInBytes(quota)
+	if err != nil || size <= 0 {
+		return nil, errors.Errorf("invalid rootfs quota %q", quota)
+	}
+	if _, ok := quotaSnapshotters[snapshotter]; !ok {
+		log.G(ctx).Warnf("Snapshotter %q does not support rootfs quota, ignoring quota %q",
+			snapshotter, quota)
+		return nil, nil
+	}
+	return []snapshots.Opt{snapshots.WithLabels(map[string]string{
+		snapshotQuotaLabel: strconv.FormatInt(size, 10),
+	})}, nil
+}
+
+// ociHookSpecOpts returns spec options adding the configured OCI hooks
+// whose annotation filter matches the container, so that e.g. device setup
+// hooks only run for containers which opt in.
+func (c *criService) ociHookSpecOpts(config *runtime.ContainerConfig) []oci.SpecOpts {
+	var specOpts []oci.SpecOpts
+	for _, hook := range c.config.OCIHooks {
+		if hook.MatchAnnotation != "" {
+			if _, ok := config.GetAnnotations()[hook.MatchAnnotation]; !ok {
+				continue
+			}
+		}
+		h := runtimespec.Hook{
+			Path: hook.Path,
+			Args: hook.Args,
+		}
+		if hook.Timeout > 0 {
+			timeout := hook.Timeout
+			h.Timeout = &timeout
+		}
+		specOpts = append(specOpts, customopts.WithOCIHook(hook.Phase, h))
+	}
+	return specOpts
+}
+
+// loadExtraEnv reads KEY=VALUE lines from the configured extra env file.
+// The returned env is merged into the container env with the lowest
+// precedence, i.e. both image config and container config env override it.
+// A missing file is not an error, and other read failures only log a
+// warning, so that a bad node file can not break container creation.
+func (c *criService) loadExtraEnv() []string {
+	path := c.config.ExtraEnvFile
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.WithError(err).Warnf("Failed to read extra env file %q", path)
+		}
+		return nil
+	}
+	return parseEnvFile(data)
+}
+
+// parseEnvFile parses KEY=VALUE lines, skipping blank lines, comments and
+// malformed entries.
+func parseEnvFile(data []byte) []string {
+	var env []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || !strings.Contains(line, "=") {
+			continue
+		}
+		env = append(env, line)
+	}
+	return env
+}
+
 // volumeMounts sets up image volumes for container. Rely on the removal of container
 // root directory to do cleanup. Note that image volume will be skipped, if there is criMounts
 // specified with the same destination.
@@ -291,7 +501,10 @@ func (c *criService) volumeMounts(containerRootDir string, criMounts []*runtime.
 		}
 		volumeID := util.GenerateID()
 		src := filepath.Join(containerRootDir, "volumes", volumeID)
-		// addOCIBindMounts will create these volumes.
+		// createImageVolumeDirs creates these volumes with the image
+		// declared ownership, and they are relabeled with the mount
+		// label together with the other mounts when the spec is
+		// generated.
 		mounts = append(mounts, &runtime.Mount{
 			ContainerPath:  dst,
 			HostPath:       src,
@@ -301,6 +514,47 @@ func (c *criService) volumeMounts(containerRootDir string, criMounts []*runtime.
 	return mounts
 }
 
+// createImageVolumeDirs creates the host directories backing image volumes
+// with the ownership declared by the image user, so that the container user
+// can write to them. Only a numeric uid/gid can be applied, a named user can
+// not be resolved without the container rootfs.
+func (c *criService) createImageVolumeDirs(volumeMounts []*runtime.Mount, config *imagespec.ImageConfig) error {
+	uid, gid := parseImageVolumeOwnership(config.User)
+	for _, v := range volumeMounts {
+		if err := c.os.MkdirAll(v.HostPath, 0755); err != nil {
+			return errors.Wrapf(err, "failed to create image volume directory %q", v.HostPath)
+		}
+		if uid < 0 {
+			continue
+		}
+		if err := c.os.Chown(v.HostPath, uid, gid); err != nil {
+			return errors.Wrapf(err, "failed to chown image volume directory %q", v.HostPath)
+		}
+	}
+	return nil
+}
+
+// parseImageVolumeOwnership parses the numeric uid and gid from the image
+// user. It returns -1 for components which are absent or not numeric, which
+// leaves the corresponding ownership unchanged.
+func parseImageVolumeOwnership(user string) (int, int) {
+	if user == "" {
+		return -1, -1
+	}
+	parts := strings.SplitN(user, ":", 2)
+	uid, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return -1, -1
+	}
+	gid := -1
+	if len(parts) == 2 {
+		if g, err := strconv.Atoi(parts[1]); err == nil {
+			gid = g
+		}
+	}
+	return uid, gid
+}
+
 // runtimeSpec returns a default runtime spec used in cri-containerd.
 func (c *criService) runtimeSpec(id string, baseSpecFile string, opts ...oci.SpecOpts) (*runtimespec.Spec, error) {
 	// GenerateSpec needs namespace.
@@ -18,19 +18,34 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/containerd/containerd"
+	containerdio "github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/containers"
 	"github.com/containerd/containerd/oci"
+	"github.com/containerd/containerd/snapshots"
 	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
 	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
+	"github.com/containerd/cri/pkg/annotations"
 	"github.com/containerd/cri/pkg/config"
 	"github.com/containerd/cri/pkg/constants"
 	"github.com/containerd/cri/pkg/containerd/opts"
+	ostesting "github.com/containerd/cri/pkg/os/testing"
+	containerstore "github.com/containerd/cri/pkg/store/container"
+	imagestore "github.com/containerd/cri/pkg/store/image"
+	sandboxstore "github.com/containerd/cri/pkg/store/sandbox"
 )
 
 func checkMount(t *testing.T, mounts []runtimespec.Mount, src, dest, typ string,
@@ -142,6 +157,7 @@ func TestContainerSpecCommand(t *testing.T) {
 		criArgs         []string
 		imageEntrypoint []string
 		imageArgs       []string
+		argsPolicy      string
 		expected        []string
 		expectErr       bool
 	}{
@@ -179,6 +195,39 @@ func TestContainerSpecCommand(t *testing.T) {
 		"should return error if both entrypoint and args are empty": {
 			expectErr: true,
 		},
+		"append policy should use image entrypoint and args if nothing is specified": {
+			imageEntrypoint: []string{"c", "d"},
+			imageArgs:       []string{"e", "f"},
+			argsPolicy:      config.ProcessArgsPolicyAppend,
+			expected:        []string{"c", "d", "e", "f"},
+		},
+		"append policy should append cri args after image args": {
+			criArgs:         []string{"a", "b"},
+			imageEntrypoint: []string{"c", "d"},
+			imageArgs:       []string{"e", "f"},
+			argsPolicy:      config.ProcessArgsPolicyAppend,
+			expected:        []string{"c", "d", "e", "f", "a", "b"},
+		},
+		"append policy should still use cri entrypoint and args if they are specified": {
+			criEntrypoint:   []string{"a", "b"},
+			criArgs:         []string{"c", "d"},
+			imageEntrypoint: []string{"e", "f"},
+			imageArgs:       []string{"g", "h"},
+			argsPolicy:      config.ProcessArgsPolicyAppend,
+			expected:        []string{"a", "b", "c", "d"},
+		},
+		"append policy should use cri entrypoint if it's specified even if it's empty": {
+			criEntrypoint:   []string{},
+			criArgs:         []string{"a", "b"},
+			imageEntrypoint: []string{"c", "d"},
+			imageArgs:       []string{"e", "f"},
+			argsPolicy:      config.ProcessArgsPolicyAppend,
+			expected:        []string{"e", "f", "a", "b"},
+		},
+		"append policy should return error if everything is empty": {
+			argsPolicy: config.ProcessArgsPolicyAppend,
+			expectErr:  true,
+		},
 	} {
 
 		config, _, imageConfig, _ := getCreateContainerTestData()
@@ -188,7 +237,7 @@ func TestContainerSpecCommand(t *testing.T) {
 		imageConfig.Cmd = test.imageArgs
 
 		var spec runtimespec.Spec
-		err := opts.WithProcessArgs(config, imageConfig)(context.Background(), nil, nil, &spec)
+		err := opts.WithProcessArgs(config, imageConfig, test.argsPolicy)(context.Background(), nil, nil, &spec)
 		if test.expectErr {
 			assert.Error(t, err)
 			continue
@@ -269,6 +318,87 @@ func TestVolumeMounts(t *testing.T) {
 	}
 }
 
+func TestCreateImageVolumeDirs(t *testing.T) {
+	testContainerRootDir := "test-container-root"
+	imageConfig := &imagespec.ImageConfig{
+		User: "1000:1001",
+		Volumes: map[string]struct{}{
+			"/test-volume-1": {},
+			"/test-volume-2": {},
+		},
+	}
+	criMounts := []*runtime.Mount{
+		{
+			ContainerPath: "/test-volume-2",
+			HostPath:      "/test-hostpath-2",
+		},
+	}
+
+	c := newTestCRIService()
+	t.Logf("image volumes covered by a CRI mount should be skipped")
+	mounts := c.volumeMounts(testContainerRootDir, criMounts, imageConfig)
+	require.Len(t, mounts, 1)
+	assert.Equal(t, "/test-volume-1", mounts[0].ContainerPath)
+	t.Logf("image volumes should be relabeled with the mount label like other mounts")
+	assert.True(t, mounts[0].SelinuxRelabel)
+
+	t.Logf("image volume directory should be created with the image ownership")
+	require.NoError(t, c.createImageVolumeDirs(mounts, imageConfig))
+	calls := c.os.(*ostesting.FakeOS).GetCalls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, "MkdirAll", calls[0].Name)
+	assert.Equal(t, mounts[0].HostPath, calls[0].Arguments[0])
+	assert.Equal(t, "Chown", calls[1].Name)
+	assert.Equal(t, []interface{}{mounts[0].HostPath, 1000, 1001}, calls[1].Arguments)
+
+	t.Logf("a named image user should not chown the volume directory")
+	c = newTestCRIService()
+	imageConfig.User = "nginx"
+	require.NoError(t, c.createImageVolumeDirs(mounts, imageConfig))
+	calls = c.os.(*ostesting.FakeOS).GetCalls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, "MkdirAll", calls[0].Name)
+}
+
+func TestParseImageVolumeOwnership(t *testing.T) {
+	for desc, test := range map[string]struct {
+		user        string
+		expectedUID int
+		expectedGID int
+	}{
+		"empty user should not change ownership": {
+			user:        "",
+			expectedUID: -1,
+			expectedGID: -1,
+		},
+		"numeric uid should keep the group unchanged": {
+			user:        "1000",
+			expectedUID: 1000,
+			expectedGID: -1,
+		},
+		"numeric uid and gid should both be applied": {
+			user:        "1000:1001",
+			expectedUID: 1000,
+			expectedGID: 1001,
+		},
+		"named user can not be resolved": {
+			user:        "nginx",
+			expectedUID: -1,
+			expectedGID: -1,
+		},
+		"named group should keep the group unchanged": {
+			user:        "1000:users",
+			expectedUID: 1000,
+			expectedGID: -1,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		uid, gid := parseImageVolumeOwnership(test.user)
+		assert.Equal(t, test.expectedUID, uid)
+		assert.Equal(t, test.expectedGID, gid)
+	}
+}
+
 func TestContainerAnnotationPassthroughContainerSpec(t *testing.T) {
 	testID := "test-id"
 	testSandboxID := "sandbox-id"
@@ -384,6 +514,83 @@ func TestContainerAnnotationPassthroughContainerSpec(t *testing.T) {
 	}
 }
 
+func TestSnapshotQuotaOpts(t *testing.T) {
+	for desc, test := range map[string]struct {
+		snapshotter   string
+		quota         string
+		expectErr     bool
+		expectedLabel string
+	}{
+		"no quota annotation should return no options": {
+			snapshotter: "overlayfs",
+		},
+		"quota should be passed as a snapshot label when the snapshotter supports it": {
+			snapshotter:   "overlayfs",
+			quota:         "10MB",
+			expectedLabel: "10485760",
+		},
+		"quota should be ignored when the snapshotter does not support it": {
+			snapshotter: "native",
+			quota:       "10MB",
+		},
+		"invalid quota should return an error": {
+			snapshotter: "overlayfs",
+			quota:       "lots-of-disk",
+			expectErr:   true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIService()
+		containerConfig := &runtime.ContainerConfig{}
+		if test.quota != "" {
+			containerConfig.Annotations = map[string]string{
+				annotations.RootfsQuota: test.quota,
+			}
+		}
+		snapshotOpts, err := c.snapshotQuotaOpts(context.Background(), test.snapshotter, containerConfig)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		if test.expectedLabel == "" {
+			assert.Empty(t, snapshotOpts)
+			continue
+		}
+		require.Len(t, snapshotOpts, 1)
+		var info snapshots.Info
+		require.NoError(t, snapshotOpts[0](&info))
+		assert.Equal(t, test.expectedLabel, info.Labels[snapshotQuotaLabel])
+	}
+}
+
+func TestContainerSpecLabelAllowlist(t *testing.T) {
+	testID := "test-id"
+	testSandboxID := "sandbox-id"
+	testContainerName := "container-name"
+	testPid := uint32(1234)
+
+	c := newTestCRIService()
+	c.config.SpecLabelAllowlist = []string{"app", "team.*"}
+	containerConfig, sandboxConfig, imageConfig, specCheck := getCreateContainerTestData()
+	containerConfig.Labels = map[string]string{
+		"app":        "database",
+		"team.owner": "storage",
+		"secret":     "do-not-leak",
+	}
+
+	spec, err := c.containerSpec(testID, testSandboxID, testPid, "", testContainerName,
+		containerConfig, sandboxConfig, imageConfig, nil, config.Runtime{})
+	require.NoError(t, err)
+	assert.Equal(t, "database", spec.Annotations[annotations.LabelPrefix+"app"])
+	assert.Equal(t, "storage", spec.Annotations[annotations.LabelPrefix+"team.owner"])
+	_, ok := spec.Annotations[annotations.LabelPrefix+"secret"]
+	assert.False(t, ok, "labels outside the allowlist should not be propagated")
+	_, ok = spec.Annotations["secret"]
+	assert.False(t, ok, "labels should only appear with the namespaced prefix")
+	specCheck(t, testID, testSandboxID, testPid, spec)
+}
+
 func TestBaseRuntimeSpec(t *testing.T) {
 	c := newTestCRIService()
 	c.baseOCISpecs = map[string]*oci.Spec{
@@ -405,3 +612,322 @@ func TestBaseRuntimeSpec(t *testing.T) {
 
 	assert.Equal(t, filepath.Join("/", constants.K8sContainerdNamespace, "id1"), out.Linux.CgroupsPath)
 }
+
+func TestCreateContainerIdempotentRetry(t *testing.T) {
+	testSandboxID := "test-sandbox-id"
+	testContainerID := "test-container-id"
+	containerConfig, sandboxConfig, _, _ := getCreateContainerTestData()
+	c := newTestCRIService()
+
+	require.NoError(t, c.sandboxStore.Add(sandboxstore.NewSandbox(
+		sandboxstore.Metadata{
+			ID:     testSandboxID,
+			Name:   "test-sandbox-name",
+			Config: sandboxConfig,
+		},
+		sandboxstore.Status{State: sandboxstore.StateReady},
+	)))
+
+	name := makeContainerName(containerConfig.GetMetadata(), sandboxConfig.GetMetadata())
+
+	t.Logf("a reserved name without a container in the store should not be treated as an existing container")
+	require.NoError(t, c.containerNameIndex.Reserve(name, testContainerID))
+	_, ok := c.getExistingContainerID(name)
+	assert.False(t, ok)
+
+	t.Logf("a retry after a fully succeeded creation should return the existing container id")
+	container, err := containerstore.NewContainer(
+		containerstore.Metadata{
+			ID:        testContainerID,
+			Name:      name,
+			SandboxID: testSandboxID,
+			Config:    containerConfig,
+		},
+		containerstore.WithFakeStatus(containerstore.Status{CreatedAt: time.Now().UnixNano()}),
+	)
+	require.NoError(t, err)
+	require.NoError(t, c.containerStore.Add(container))
+	resp, err := c.CreateContainer(context.Background(), &runtime.CreateContainerRequest{
+		PodSandboxId:  testSandboxID,
+		Config:        containerConfig,
+		SandboxConfig: sandboxConfig,
+	})
+	assert.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, testContainerID, resp.GetContainerId())
+}
+
+// fakeCreateSandboxContainer is a fake sandbox container which supports just
+// enough of the containerd container interface for `CreateContainer`.
+type fakeCreateSandboxContainer struct {
+	containerd.Container
+	pid uint32
+}
+
+func (f *fakeCreateSandboxContainer) Task(context.Context, containerdio.Attach) (containerd.Task, error) {
+	return &fakeCreateSandboxTask{pid: f.pid}, nil
+}
+
+func (f *fakeCreateSandboxContainer) Info(context.Context, ...containerd.InfoOpts) (containers.Container, error) {
+	return containers.Container{Runtime: containers.RuntimeInfo{Name: "io.containerd.runc.v2"}}, nil
+}
+
+type fakeCreateSandboxTask struct {
+	containerd.Task
+	pid uint32
+}
+
+func (f *fakeCreateSandboxTask) Pid() uint32 {
+	return f.pid
+}
+
+// fakeCreatedContainer is a fake containerd container returned by the
+// injected container creator, recording whether it has been deleted.
+type fakeCreatedContainer struct {
+	containerd.Container
+	id      string
+	deleted bool
+}
+
+func (f *fakeCreatedContainer) ID() string { return f.id }
+
+func (f *fakeCreatedContainer) Delete(context.Context, ...containerd.DeleteOpts) error {
+	f.deleted = true
+	return nil
+}
+
+// newTestCRIServiceForCreate creates a fake criService able to run
+// `CreateContainer` end to end, backed by real root directories under the
+// returned temporary directory and the injected containerd client seams.
+func newTestCRIServiceForCreate(t *testing.T, sandboxID string, sandboxConfig *runtime.PodSandboxConfig,
+	imageRef string, imageConfig *imagespec.ImageConfig) (*criService, string) {
+	c := newTestCRIService()
+	tmpDir, err := ioutil.TempDir("", "create-container-test")
+	require.NoError(t, err)
+	c.config.RootDir = filepath.Join(tmpDir, "root")
+	c.config.StateDir = filepath.Join(tmpDir, "state")
+	c.config.ContainerdConfig.DefaultRuntimeName = "runc"
+	c.config.ContainerdConfig.Runtimes = map[string]config.Runtime{
+		"runc": {Type: "io.containerd.runc.v2"},
+	}
+	fakeOS := c.os.(*ostesting.FakeOS)
+	fakeOS.MkdirAllFn = os.MkdirAll
+	fakeOS.RemoveAllFn = os.RemoveAll
+	c.imageStore, err = imagestore.NewFakeStore([]imagestore.Image{{
+		ID:         imageRef,
+		References: []string{imageRef},
+		ImageSpec:  imagespec.Image{Config: *imageConfig},
+	}})
+	require.NoError(t, err)
+	// The image handle is only consumed by the snapshot preparation
+	// inside the injected container creator, which never applies it.
+	c.getContainerdImage = func(context.Context, string) (containerd.Image, error) {
+		return nil, nil
+	}
+	c.createContainerdContainer = func(_ context.Context, id string, _ ...containerd.NewContainerOpts) (containerd.Container, error) {
+		return &fakeCreatedContainer{id: id}, nil
+	}
+	sandbox := sandboxstore.NewSandbox(
+		sandboxstore.Metadata{
+			ID:     sandboxID,
+			Name:   "test-sandbox-" + sandboxID,
+			Config: sandboxConfig,
+		},
+		sandboxstore.Status{State: sandboxstore.StateReady},
+	)
+	sandbox.Container = &fakeCreateSandboxContainer{pid: 1234}
+	require.NoError(t, c.sandboxStore.Add(sandbox))
+	return c, tmpDir
+}
+
+func TestCreateContainerCleanupOnError(t *testing.T) {
+	testSandboxID := "test-sandbox-id-cleanup"
+
+	// assertCleanedUp verifies that neither container root directory has
+	// leftover per-container content and that the name reservation is
+	// released.
+	assertCleanedUp := func(t *testing.T, c *criService, name string) {
+		for _, dir := range []string{c.config.RootDir, c.config.StateDir} {
+			entries, err := ioutil.ReadDir(filepath.Join(dir, containersDir))
+			if err != nil {
+				// The directory may not exist at all, e.g. when the stage
+				// failed before anything was created under it.
+				continue
+			}
+			assert.Empty(t, entries, "leftover container directories in %q", dir)
+		}
+		_, ok := c.containerNameIndex.GetKeyByName(name)
+		assert.False(t, ok, "container name %q should be released", name)
+	}
+
+	for desc, test := range map[string]struct {
+		setup       func(t *testing.T, c *criService, containerConfig *runtime.ContainerConfig) func(t *testing.T)
+		expectedErr string
+	}{
+		"should clean up when snapshot options are invalid": {
+			setup: func(t *testing.T, c *criService, containerConfig *runtime.ContainerConfig) func(t *testing.T) {
+				c.config.ContainerdConfig.Snapshotter = "overlayfs"
+				containerConfig.Annotations[annotations.RootfsQuota] = "not-a-size"
+				return nil
+			},
+			expectedErr: "invalid rootfs quota",
+		},
+		"should clean up when container io creation fails": {
+			setup: func(t *testing.T, c *criService, containerConfig *runtime.ContainerConfig) func(t *testing.T) {
+				// Occupy the state dir with a regular file and pretend to
+				// create the volatile container root directory, so that
+				// fifo creation inside it fails.
+				stateDir := c.config.StateDir
+				require.NoError(t, ioutil.WriteFile(stateDir, []byte{}, 0644))
+				c.os.(*ostesting.FakeOS).MkdirAllFn = func(path string, perm os.FileMode) error {
+					if strings.HasPrefix(path, stateDir) {
+						return nil
+					}
+					return os.MkdirAll(path, perm)
+				}
+				return nil
+			},
+			expectedErr: "failed to create container io",
+		},
+		"should clean up when containerd container creation fails": {
+			setup: func(t *testing.T, c *criService, containerConfig *runtime.ContainerConfig) func(t *testing.T) {
+				c.createContainerdContainer = func(context.Context, string, ...containerd.NewContainerOpts) (containerd.Container, error) {
+					return nil, errors.New("injected create error")
+				}
+				return nil
+			},
+			expectedErr: "failed to create containerd container",
+		},
+		"should delete the containerd container when the store add fails": {
+			setup: func(t *testing.T, c *criService, containerConfig *runtime.ContainerConfig) func(t *testing.T) {
+				var created *fakeCreatedContainer
+				c.createContainerdContainer = func(_ context.Context, id string, _ ...containerd.NewContainerOpts) (containerd.Container, error) {
+					// Occupy the container id in the store, so that the
+					// following store add fails.
+					occupant, err := containerstore.NewContainer(
+						containerstore.Metadata{ID: id, Name: "occupant-" + id},
+						containerstore.WithFakeStatus(containerstore.Status{}),
+					)
+					require.NoError(t, err)
+					require.NoError(t, c.containerStore.Add(occupant))
+					created = &fakeCreatedContainer{id: id}
+					return created, nil
+				}
+				return func(t *testing.T) {
+					require.NotNil(t, created)
+					assert.True(t, created.deleted, "containerd container should be deleted")
+				}
+			},
+			expectedErr: "failed to add container",
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+		c, tmpDir := newTestCRIServiceForCreate(t, testSandboxID, sandboxConfig, containerConfig.GetImage().GetImage(), imageConfig)
+		// Creation must not get as far as the containerd container unless
+		// a test case injects its own creator.
+		c.createContainerdContainer = func(context.Context, string, ...containerd.NewContainerOpts) (containerd.Container, error) {
+			t.Fatalf("TestCase %q: containerd container should not be created", desc)
+			return nil, nil
+		}
+		check := test.setup(t, c, containerConfig)
+		resp, err := c.CreateContainer(context.Background(), &runtime.CreateContainerRequest{
+			PodSandboxId:  testSandboxID,
+			Config:        containerConfig,
+			SandboxConfig: sandboxConfig,
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), test.expectedErr)
+		assert.Nil(t, resp)
+		name := makeContainerName(containerConfig.GetMetadata(), sandboxConfig.GetMetadata())
+		assertCleanedUp(t, c, name)
+		if check != nil {
+			check(t)
+		}
+		os.RemoveAll(tmpDir)
+	}
+}
+
+func TestDryRunContainerSpec(t *testing.T) {
+	testSandboxID := "test-sandbox-id-dry-run"
+	containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+	c, tmpDir := newTestCRIServiceForCreate(t, testSandboxID, sandboxConfig, containerConfig.GetImage().GetImage(), imageConfig)
+	defer os.RemoveAll(tmpDir)
+	c.createContainerdContainer = func(context.Context, string, ...containerd.NewContainerOpts) (containerd.Container, error) {
+		t.Fatal("containerd container should not be created on dry-run")
+		return nil, nil
+	}
+
+	t.Logf("dry-run should return the generated spec")
+	specJSON, err := c.DryRunContainerSpec(context.Background(), &runtime.CreateContainerRequest{
+		PodSandboxId:  testSandboxID,
+		Config:        containerConfig,
+		SandboxConfig: sandboxConfig,
+	})
+	require.NoError(t, err)
+	spec := &runtimespec.Spec{}
+	require.NoError(t, json.Unmarshal(specJSON, spec))
+	require.NotNil(t, spec.Process)
+	assert.Equal(t, append(containerConfig.GetCommand(), containerConfig.GetArgs()...), spec.Process.Args)
+
+	t.Logf("dry-run should leave no container state behind")
+	for _, dir := range []string{c.config.RootDir, c.config.StateDir} {
+		entries, err := ioutil.ReadDir(filepath.Join(dir, containersDir))
+		if err == nil {
+			assert.Empty(t, entries, "leftover container directories in %q", dir)
+		}
+	}
+	assert.Empty(t, c.containerStore.List())
+	name := makeContainerName(containerConfig.GetMetadata(), sandboxConfig.GetMetadata())
+	_, ok := c.containerNameIndex.GetKeyByName(name)
+	assert.False(t, ok, "container name %q should not be reserved", name)
+}
+
+func TestCreateContainerMaxImageSize(t *testing.T) {
+	testSandboxID := "test-sandbox-id-image-size"
+
+	for desc, test := range map[string]struct {
+		imageSize    int64
+		maxImageSize int64
+		expectErr    bool
+	}{
+		"should create a container when no image size limit is set": {
+			imageSize: 400,
+		},
+		"should create a container from an image within the size limit": {
+			imageSize:    400,
+			maxImageSize: 500,
+		},
+		"should reject a container from an oversized image": {
+			imageSize:    600,
+			maxImageSize: 500,
+			expectErr:    true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+		c, tmpDir := newTestCRIServiceForCreate(t, testSandboxID, sandboxConfig, containerConfig.GetImage().GetImage(), imageConfig)
+		c.config.MaxImageSize = test.maxImageSize
+		image, err := c.imageStore.Get(containerConfig.GetImage().GetImage())
+		require.NoError(t, err)
+		image.Size = test.imageSize
+		c.imageStore, err = imagestore.NewFakeStore([]imagestore.Image{image})
+		require.NoError(t, err)
+		resp, err := c.CreateContainer(context.Background(), &runtime.CreateContainerRequest{
+			PodSandboxId:  testSandboxID,
+			Config:        containerConfig,
+			SandboxConfig: sandboxConfig,
+		})
+		if test.expectErr {
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "exceeds the size limit")
+			assert.Nil(t, resp)
+		} else {
+			require.NoError(t, err)
+			require.NotNil(t, resp)
+			_, err := c.containerStore.Get(resp.GetContainerId())
+			assert.NoError(t, err)
+		}
+		os.RemoveAll(tmpDir)
+	}
+}
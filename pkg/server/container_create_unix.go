@@ -22,6 +22,8 @@ import (
 	"bufio"
 	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -34,6 +36,7 @@ import (
 	selinux "github.com/opencontainers/selinux/go-selinux"
 	"github.com/opencontainers/selinux/go-selinux/label"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
 	"github.com/containerd/cri/pkg/annotations"
@@ -58,7 +61,7 @@ const (
 
 // containerMounts sets up necessary container system file mounts
 // including /dev/shm, /etc/hosts and /etc/resolv.conf.
-func (c *criService) containerMounts(sandboxID string, config *runtime.ContainerConfig) []*runtime.Mount {
+func (c *criService) containerMounts(id, sandboxID string, config *runtime.ContainerConfig) []*runtime.Mount {
 	var mounts []*runtime.Mount
 	securityContext := config.GetLinux().GetSecurityContext()
 	if !isInCRIMounts(etcHostname, config.GetMounts()) {
@@ -67,13 +70,30 @@ func (c *criService) containerMounts(sandboxID string, config *runtime.Container
 		// do not mount this in that case.
 		// TODO(random-liu): Remove the check and always mount this when
 		// containerd 1.1 and 1.2 are deprecated.
-		hostpath := c.getSandboxHostname(sandboxID)
-		if _, err := c.os.Stat(hostpath); err == nil {
+		if hostname := config.GetAnnotations()[annotations.ContainerHostname]; hostname != "" {
+			// The hostname override is written to a container specific file,
+			// so that the sandbox hostname file shared by the other containers
+			// in the pod is left untouched.
+			hostpath := filepath.Join(c.getContainerRootDir(id), "hostname")
+			// The write is best-effort so that the mount is computed the
+			// same way when the container root directory does not exist,
+			// e.g. for a dry run. A failed write surfaces when the
+			// container is started.
+			_ = c.os.WriteFile(hostpath, []byte(hostname+"\n"), 0644)
 			mounts = append(mounts, &runtime.Mount{
 				ContainerPath: etcHostname,
 				HostPath:      hostpath,
 				Readonly:      securityContext.GetReadonlyRootfs(),
 			})
+		} else {
+			hostpath := c.getSandboxHostname(sandboxID)
+			if _, err := c.os.Stat(hostpath); err == nil {
+				mounts = append(mounts, &runtime.Mount{
+					ContainerPath: etcHostname,
+					HostPath:      hostpath,
+					Readonly:      securityContext.GetReadonlyRootfs(),
+				})
+			}
 		}
 	}
 
@@ -114,19 +134,37 @@ func (c *criService) containerSpec(id string, sandboxID string, sandboxPid uint3
 	config *runtime.ContainerConfig, sandboxConfig *runtime.PodSandboxConfig, imageConfig *imagespec.ImageConfig,
 	extraMounts []*runtime.Mount, ociRuntime config.Runtime) (_ *runtimespec.Spec, retErr error) {
 
+	// Fill in per-runtime default resources for values the CRI request
+	// leaves unset. Explicit CRI resources always take precedence.
+	config = applyRuntimeDefaultResources(config, ociRuntime.DefaultResources)
+
+	// By default the /run mount is removed from the spec. When configured,
+	// mount a tmpfs with copy-up instead, for images expecting a writable
+	// /run.
+	runMountOpt := oci.SpecOpts(customopts.WithoutRunMount)
+	if c.config.EnableRunTmpfs {
+		runMountOpt = customopts.WithRunTmpfs(c.config.RunTmpfsSize)
+	}
+
 	specOpts := []oci.SpecOpts{
-		customopts.WithoutRunMount,
+		runMountOpt,
 		customopts.WithoutDefaultSecuritySettings,
 		customopts.WithRelativeRoot(relativeRootfsPath),
-		customopts.WithProcessArgs(config, imageConfig),
+		customopts.WithProcessArgs(config, imageConfig, c.config.ProcessArgsPolicy),
 		oci.WithDefaultPathEnv,
 		// this will be set based on the security context below
 		oci.WithNewPrivileges,
 	}
-	if config.GetWorkingDir() != "" {
-		specOpts = append(specOpts, oci.WithProcessCwd(config.GetWorkingDir()))
-	} else if imageConfig.WorkingDir != "" {
-		specOpts = append(specOpts, oci.WithProcessCwd(imageConfig.WorkingDir))
+	workingDir := config.GetWorkingDir()
+	if workingDir == "" {
+		workingDir = imageConfig.WorkingDir
+	}
+	if workingDir != "" {
+		if c.config.CreateWorkingDir {
+			specOpts = append(specOpts, customopts.WithWorkingDir(workingDir))
+		} else {
+			specOpts = append(specOpts, oci.WithProcessCwd(workingDir))
+		}
 	}
 
 	if config.GetTty() {
@@ -145,9 +183,9 @@ func (c *criService) containerSpec(id string, sandboxID string, sandboxPid uint3
 	}
 	specOpts = append(specOpts, oci.WithEnv([]string{hostnameEnv + "=" + hostname}))
 
-	// Apply envs from image config first, so that envs from container config
-	// can override them.
-	env := append([]string{}, imageConfig.Env...)
+	// Apply file-provided extra env first, then envs from image config, so
+	// that envs from container config can override both.
+	env := append(c.loadExtraEnv(), imageConfig.Env...)
 	for _, e := range config.GetEnvs() {
 		env = append(env, e.GetKey()+"="+e.GetValue())
 	}
@@ -178,7 +216,7 @@ func (c *criService) containerSpec(id string, sandboxID string, sandboxPid uint3
 		}
 	}()
 
-	specOpts = append(specOpts, customopts.WithMounts(c.os, config, extraMounts, mountLabel))
+	specOpts = append(specOpts, customopts.WithMounts(c.os, config, extraMounts, mountLabel, c.config.ForceMountsReadonly))
 
 	if !c.config.DisableProcMount {
 		// Apply masked paths if specified.
@@ -200,13 +238,33 @@ func (c *criService) containerSpec(id string, sandboxID string, sandboxPid uint3
 		}
 		specOpts = append(specOpts, oci.WithPrivileged)
 		if !ociRuntime.PrivilegedWithoutHostDevices {
-			specOpts = append(specOpts, oci.WithHostDevices, oci.WithAllDevicesAllowed)
+			if len(c.config.PrivilegedDeviceAllowlist) != 0 {
+				specOpts = append(specOpts, customopts.WithAllowlistedHostDevices(c.config.PrivilegedDeviceAllowlist), oci.WithAllDevicesAllowed)
+			} else {
+				specOpts = append(specOpts, oci.WithHostDevices, oci.WithAllDevicesAllowed)
+			}
 		} else {
 			// add requested devices by the config as host devices are not automatically added
-			specOpts = append(specOpts, customopts.WithDevices(c.os, config), customopts.WithCapabilities(securityContext))
+			specOpts = append(specOpts, customopts.WithDevices(c.os, config, c.config.MaxContainerDevices), customopts.WithCapabilities(securityContext))
 		}
 	} else { // not privileged
-		specOpts = append(specOpts, customopts.WithDevices(c.os, config), customopts.WithCapabilities(securityContext))
+		specOpts = append(specOpts, customopts.WithDevices(c.os, config, c.config.MaxContainerDevices), customopts.WithCapabilities(securityContext))
+	}
+
+	// When the pod requests it, also place explicitly added capabilities
+	// in the ambient set, so that non-root processes retain them.
+	if sandboxConfig.GetAnnotations()[annotations.AmbientCapabilities] == "true" {
+		specOpts = append(specOpts, customopts.WithAmbientCapabilities(securityContext))
+	}
+
+	// Per-set capability drops apply on top of the uniform capability
+	// handling above.
+	if v := config.GetAnnotations()[annotations.CapabilitySetDrops]; v != "" {
+		specOpts = append(specOpts, customopts.WithCapabilitySetDrops(v))
+	}
+
+	if len(c.config.DeviceCgroupRules) != 0 {
+		specOpts = append(specOpts, customopts.WithDeviceCgroupRules(toOCIDeviceCgroupRules(c.config.DeviceCgroupRules)))
 	}
 
 	// Clear all ambient capabilities. The implication of non-root + caps
@@ -231,13 +289,55 @@ func (c *criService) containerSpec(id string, sandboxID string, sandboxPid uint3
 		specOpts = append(specOpts, customopts.WithDisabledCgroups)
 	} else {
 		specOpts = append(specOpts, customopts.WithResources(config.GetLinux().GetResources(), c.config.TolerateMissingHugetlbController, c.config.DisableHugetlbController))
+		if v := config.GetAnnotations()[annotations.MemorySwapLimit]; v != "" {
+			swap, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid memory swap limit %q", v)
+			}
+			specOpts = append(specOpts, customopts.WithMemorySwapLimit(swap))
+		}
+		if v := config.GetAnnotations()[annotations.MemoryReservation]; v != "" {
+			reservation, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid memory reservation %q", v)
+			}
+			specOpts = append(specOpts, customopts.WithMemoryReservation(reservation))
+		}
+		rtRuntimeStr := config.GetAnnotations()[annotations.CPURealtimeRuntime]
+		rtPeriodStr := config.GetAnnotations()[annotations.CPURealtimePeriod]
+		if rtRuntimeStr != "" || rtPeriodStr != "" {
+			var (
+				rtRuntime int64
+				rtPeriod  uint64
+				err       error
+			)
+			if rtRuntimeStr != "" {
+				if rtRuntime, err = strconv.ParseInt(rtRuntimeStr, 10, 64); err != nil {
+					return nil, errors.Wrapf(err, "invalid CPU realtime runtime %q", rtRuntimeStr)
+				}
+			}
+			if rtPeriodStr != "" {
+				if rtPeriod, err = strconv.ParseUint(rtPeriodStr, 10, 64); err != nil {
+					return nil, errors.Wrapf(err, "invalid CPU realtime period %q", rtPeriodStr)
+				}
+			}
+			specOpts = append(specOpts, customopts.WithCPURealtime(rtRuntime, rtPeriod))
+		}
 		if sandboxConfig.GetLinux().GetCgroupParent() != "" {
-			cgroupsPath := getCgroupsPath(sandboxConfig.GetLinux().GetCgroupParent(), id)
+			cgroupsPath := getCgroupsPath(sandboxConfig.GetLinux().GetCgroupParent(), id, c.config.SystemdCgroup)
 			specOpts = append(specOpts, oci.WithCgroup(cgroupsPath))
 		}
 	}
 
 	supplementalGroups := securityContext.GetSupplementalGroups()
+	if defaults := c.config.DefaultSupplementalGroups; len(defaults) != 0 {
+		// Merge in the node default supplemental groups. The final list is
+		// de-duplicated and sorted by WithSupplementalGroups.
+		merged := make([]int64, 0, len(supplementalGroups)+len(defaults))
+		merged = append(merged, supplementalGroups...)
+		merged = append(merged, defaults...)
+		supplementalGroups = merged
+	}
 
 	for pKey, pValue := range getPassthroughAnnotations(sandboxConfig.Annotations,
 		ociRuntime.PodAnnotations) {
@@ -249,6 +349,24 @@ func (c *criService) containerSpec(id string, sandboxID string, sandboxPid uint3
 		specOpts = append(specOpts, customopts.WithAnnotation(pKey, pValue))
 	}
 
+	// Propagate allowlisted CRI labels into the OCI spec annotations with a
+	// namespaced prefix, so that OCI hooks and tools reading the spec can
+	// see them without leaking every label.
+	for lKey, lValue := range getPassthroughAnnotations(config.GetLabels(),
+		c.config.SpecLabelAllowlist) {
+		specOpts = append(specOpts, customopts.WithAnnotation(annotations.LabelPrefix+lKey, lValue))
+	}
+
+	// Apply configured OCI hooks for matching containers.
+	specOpts = append(specOpts, c.ociHookSpecOpts(config)...)
+
+	// Inject CDI devices requested by annotation.
+	cdiOpts, err := c.cdiSpecOpts(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resolve CDI devices")
+	}
+	specOpts = append(specOpts, cdiOpts...)
+
 	specOpts = append(specOpts,
 		customopts.WithOOMScoreAdj(config, c.config.RestrictOOMScoreAdj),
 		customopts.WithPodNamespaces(securityContext, sandboxPid),
@@ -257,6 +375,30 @@ func (c *criService) containerSpec(id string, sandboxID string, sandboxPid uint3
 		customopts.WithAnnotation(annotations.SandboxID, sandboxID),
 		customopts.WithAnnotation(annotations.ContainerName, containerName),
 	)
+
+	// A container-specific hostname can only take effect when the container
+	// does not share the UTS namespace with the sandbox, so give the
+	// container its own UTS namespace. When the pod runs in the host UTS
+	// namespace, the override would change the node hostname, so reject it.
+	if hostname := config.GetAnnotations()[annotations.ContainerHostname]; hostname != "" {
+		if securityContext.GetNamespaceOptions().GetNetwork() == runtime.NamespaceMode_NODE {
+			return nil, errors.Errorf("container hostname %q can not be set when sharing the host UTS namespace", hostname)
+		}
+		specOpts = append(specOpts,
+			oci.WithLinuxNamespace(runtimespec.LinuxNamespace{Type: runtimespec.UTSNamespace}),
+			oci.WithHostname(hostname),
+		)
+	}
+
+	// An ephemeral debug container may request to join the namespaces of
+	// another container in the same pod instead of the sandbox's.
+	if targetID := config.GetAnnotations()[annotations.TargetContainerID]; targetID != "" {
+		targetPid, err := c.validateTargetContainer(sandboxID, targetID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid target container %q", targetID)
+		}
+		specOpts = append(specOpts, customopts.WithTargetNamespaces(targetPid))
+	}
 	// cgroupns is used for hiding /sys/fs/cgroup from containers.
 	// For compatibility, cgroupns is not used when running in cgroup v1 mode or in privileged.
 	// https://github.com/containers/libpod/issues/4363
@@ -270,6 +412,79 @@ func (c *criService) containerSpec(id string, sandboxID string, sandboxPid uint3
 	return c.runtimeSpec(id, ociRuntime.BaseRuntimeSpec, specOpts...)
 }
 
+// applyRuntimeDefaultResources returns a copy of the container config with
+// resource settings left unset in the CRI request filled in with the defaults
+// configured for the runtime handler. The original config is not modified.
+func applyRuntimeDefaultResources(config *runtime.ContainerConfig, defaults *config.RuntimeDefaultResources) *runtime.ContainerConfig {
+	if defaults == nil {
+		return config
+	}
+	mergedConfig := *config
+	linux := &runtime.LinuxContainerConfig{}
+	if config.GetLinux() != nil {
+		l := *config.GetLinux()
+		linux = &l
+	}
+	resources := &runtime.LinuxContainerResources{}
+	if linux.GetResources() != nil {
+		r := *linux.GetResources()
+		resources = &r
+	}
+	if resources.MemoryLimitInBytes == 0 {
+		resources.MemoryLimitInBytes = defaults.MemoryLimitInBytes
+	}
+	if resources.CpuShares == 0 {
+		resources.CpuShares = defaults.CpuShares
+	}
+	if resources.OomScoreAdj == 0 {
+		resources.OomScoreAdj = defaults.OomScoreAdj
+	}
+	linux.Resources = resources
+	mergedConfig.Linux = linux
+	return &mergedConfig
+}
+
+// toOCIDeviceCgroupRules converts configured device cgroup rules into OCI
+// device cgroup entries. A negative major or minor number matches all devices.
+func toOCIDeviceCgroupRules(rules []config.DeviceCgroupRule) []runtimespec.LinuxDeviceCgroup {
+	var ociRules []runtimespec.LinuxDeviceCgroup
+	for _, r := range rules {
+		rule := runtimespec.LinuxDeviceCgroup{
+			Allow:  true,
+			Type:   r.Type,
+			Access: r.Access,
+		}
+		if r.Major >= 0 {
+			major := r.Major
+			rule.Major = &major
+		}
+		if r.Minor >= 0 {
+			minor := r.Minor
+			rule.Minor = &minor
+		}
+		ociRules = append(ociRules, rule)
+	}
+	return ociRules
+}
+
+// validateTargetContainer checks that a container is a valid namespace
+// target, i.e. it belongs to the given sandbox and is running, and returns
+// the init process id of its task.
+func (c *criService) validateTargetContainer(sandboxID, targetID string) (uint32, error) {
+	targetContainer, err := c.containerStore.Get(targetID)
+	if err != nil {
+		return 0, errors.Wrapf(err, "container %q does not exist", targetID)
+	}
+	if targetContainer.SandboxID != sandboxID {
+		return 0, errors.Errorf("container %q belongs to sandbox %q, not %q", targetID, targetContainer.SandboxID, sandboxID)
+	}
+	status := targetContainer.Status.Get()
+	if state := status.State(); state != runtime.ContainerState_CONTAINER_RUNNING {
+		return 0, errors.Errorf("container %q is not running - in state %s", targetID, state)
+	}
+	return status.Pid, nil
+}
+
 func (c *criService) containerSpecOpts(config *runtime.ContainerConfig, imageConfig *imagespec.ImageConfig) ([]oci.SpecOpts, error) {
 	var specOpts []oci.SpecOpts
 	securityContext := config.GetLinux().GetSecurityContext()
@@ -301,7 +516,7 @@ func (c *criService) containerSpecOpts(config *runtime.ContainerConfig, imageCon
 	}
 	specOpts = append(specOpts, customopts.WithAdditionalGIDs(userstr))
 
-	apparmorSpecOpts, err := generateApparmorSpecOpts(
+	apparmorSpecOpts, err := c.generateApparmorSpecOpts(
 		securityContext.GetApparmorProfile(),
 		securityContext.GetPrivileged(),
 		c.apparmorEnabled())
@@ -362,13 +577,19 @@ func (c *criService) generateSeccompSpecOpts(seccompProf string, privileged, sec
 }
 
 // generateApparmorSpecOpts generates containerd SpecOpts for apparmor.
-func generateApparmorSpecOpts(apparmorProf string, privileged, apparmorEnabled bool) (oci.SpecOpts, error) {
+func (c *criService) generateApparmorSpecOpts(apparmorProf string, privileged, apparmorEnabled bool) (oci.SpecOpts, error) {
 	if !apparmorEnabled {
-		// Should fail loudly if user try to specify apparmor profile
-		// but we don't support it.
-		if apparmorProf != "" && apparmorProf != unconfinedProfile {
+		// Should fail loudly if user try to specify a specific apparmor
+		// profile but we don't support it.
+		if strings.HasPrefix(apparmorProf, profileNamePrefix) {
 			return nil, errors.New("apparmor is not supported")
 		}
+		if apparmorProf != "" && apparmorProf != unconfinedProfile {
+			// The default profile request does not name a specific
+			// profile. Ignore it with a warning instead of failing
+			// pods scheduled onto nodes without apparmor.
+			logrus.Warnf("Apparmor is disabled, ignoring profile %q", apparmorProf)
+		}
 		return nil, nil
 	}
 	switch apparmorProf {
@@ -389,11 +610,20 @@ func generateApparmorSpecOpts(apparmorProf string, privileged, apparmorEnabled b
 			return nil, errors.Errorf("invalid apparmor profile %q", apparmorProf)
 		}
 		appArmorProfile := strings.TrimPrefix(apparmorProf, profileNamePrefix)
-		if profileExists, err := appArmorProfileExists(appArmorProfile); !profileExists {
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to generate apparmor spec opts")
+		if profileExists, err := appArmorProfileExists(appArmorProfile); err != nil || !profileExists {
+			// The profile is not loaded in the kernel. Try loading a
+			// file backed profile of the same name from the profiles
+			// directory before giving up.
+			load := c.loadApparmorProfile
+			if load == nil {
+				load = c.loadApparmorProfileFromDir
+			}
+			if loadErr := load(appArmorProfile); loadErr != nil {
+				if err != nil {
+					return nil, errors.Wrap(err, "failed to check apparmor profile")
+				}
+				return nil, errors.Wrapf(loadErr, "apparmor profile not found %s", appArmorProfile)
 			}
-			return nil, errors.Errorf("apparmor profile not found %s", appArmorProfile)
 		}
 		return apparmor.WithProfile(appArmorProfile), nil
 	}
@@ -426,6 +656,24 @@ func appArmorProfileExists(profile string) (bool, error) {
 	}
 }
 
+// loadApparmorProfileFromDir loads the file backed apparmor profile of the
+// given name from the configured profiles directory into the kernel. The
+// kernel keeps the loaded profile until reboot; like the created default
+// profile, it is not deleted when the container goes away.
+// TODO (mikebrow): delete created apparmor default profile
+func (c *criService) loadApparmorProfileFromDir(profile string) error {
+	path := filepath.Join(c.config.ApparmorProfilesDir, profile)
+	if _, err := c.os.Stat(path); err != nil {
+		return errors.Wrapf(err, "failed to stat apparmor profile file %q", path)
+	}
+	// Use `-r` to replace an already loaded (e.g. stale) profile of the
+	// same name instead of failing.
+	if output, err := exec.Command("apparmor_parser", "-Kr", path).CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "failed to load apparmor profile %q: %s", path, output)
+	}
+	return nil
+}
+
 // generateUserString generates valid user string based on OCI Image Spec
 // v1.0.0.
 //
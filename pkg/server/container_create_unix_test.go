@@ -21,6 +21,7 @@ package server
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -47,6 +48,7 @@ import (
 	"github.com/containerd/cri/pkg/containerd/opts"
 	ctrdutil "github.com/containerd/cri/pkg/containerd/util"
 	ostesting "github.com/containerd/cri/pkg/os/testing"
+	containerstore "github.com/containerd/cri/pkg/store/container"
 	"github.com/containerd/cri/pkg/util"
 )
 
@@ -150,7 +152,7 @@ func getCreateContainerTestData() (*runtime.ContainerConfig, *runtime.PodSandbox
 		assert.Equal(t, spec.Process.NoNewPrivileges, true)
 
 		t.Logf("Check cgroup path")
-		assert.Equal(t, getCgroupsPath("/test/cgroup/parent", id), spec.Linux.CgroupsPath)
+		assert.Equal(t, getCgroupsPath("/test/cgroup/parent", id, false), spec.Linux.CgroupsPath)
 
 		t.Logf("Check namespaces")
 		assert.Contains(t, spec.Linux.Namespaces, runtimespec.LinuxNamespace{
@@ -258,6 +260,115 @@ func TestContainerCapabilities(t *testing.T) {
 	}
 }
 
+func TestContainerHostnameOverride(t *testing.T) {
+	testID := "test-id"
+	testSandboxID := "sandbox-id"
+	testContainerName := "container-name"
+	testPid := uint32(1234)
+	for desc, test := range map[string]struct {
+		hostname    string
+		hostNetwork bool
+		expectErr   bool
+	}{
+		"should override hostname and unshare UTS namespace when annotation is set": {
+			hostname: "test-container-hostname",
+		},
+		"should reject hostname override when sharing the host UTS namespace": {
+			hostname:    "test-container-hostname",
+			hostNetwork: true,
+			expectErr:   true,
+		},
+		"should keep sandbox UTS namespace without the annotation": {},
+	} {
+		t.Logf("TestCase %q", desc)
+		containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+		ociRuntime := config.Runtime{}
+		c := newTestCRIService()
+		if test.hostname != "" {
+			containerConfig.Annotations = map[string]string{
+				annotations.ContainerHostname: test.hostname,
+			}
+		}
+		if test.hostNetwork {
+			containerConfig.Linux.SecurityContext.NamespaceOptions = &runtime.NamespaceOption{
+				Network: runtime.NamespaceMode_NODE,
+			}
+		}
+		spec, err := c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		if test.hostname != "" {
+			assert.Equal(t, test.hostname, spec.Hostname)
+			assert.Contains(t, spec.Linux.Namespaces, runtimespec.LinuxNamespace{
+				Type: runtimespec.UTSNamespace,
+			})
+		} else {
+			assert.Empty(t, spec.Hostname)
+			assert.Contains(t, spec.Linux.Namespaces, runtimespec.LinuxNamespace{
+				Type: runtimespec.UTSNamespace,
+				Path: opts.GetUTSNamespace(testPid),
+			})
+		}
+	}
+}
+
+func TestContainerDeviceCgroupRules(t *testing.T) {
+	testID := "test-id"
+	testSandboxID := "sandbox-id"
+	testContainerName := "container-name"
+	testPid := uint32(1234)
+	containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+	ociRuntime := config.Runtime{}
+	c := newTestCRIService()
+	c.config.DeviceCgroupRules = []config.DeviceCgroupRule{
+		{Type: "c", Major: 10, Minor: -1, Access: "rwm"},
+		{Type: "b", Major: -1, Minor: -1, Access: "r"},
+	}
+
+	spec, err := c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.NoError(t, err)
+
+	major := int64(10)
+	assert.Contains(t, spec.Linux.Resources.Devices, runtimespec.LinuxDeviceCgroup{
+		Allow:  true,
+		Type:   "c",
+		Major:  &major,
+		Access: "rwm",
+	})
+	assert.Contains(t, spec.Linux.Resources.Devices, runtimespec.LinuxDeviceCgroup{
+		Allow:  true,
+		Type:   "b",
+		Access: "r",
+	})
+}
+
+func TestContainerDefaultSupplementalGroups(t *testing.T) {
+	testID := "test-id"
+	testSandboxID := "sandbox-id"
+	testContainerName := "container-name"
+	testPid := uint32(1234)
+	containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+	ociRuntime := config.Runtime{}
+	c := newTestCRIService()
+	// 2222 is in both the container config and the node defaults, it should
+	// only show up once in the merged list.
+	c.config.DefaultSupplementalGroups = []int64{2222, 3333}
+
+	spec, err := c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.NoError(t, err)
+
+	seen := make(map[uint32]int)
+	for _, gid := range spec.Process.User.AdditionalGids {
+		seen[gid]++
+	}
+	for _, gid := range []uint32{1111, 2222, 3333} {
+		assert.Equal(t, 1, seen[gid], "gid %d should appear exactly once", gid)
+	}
+}
+
 func TestContainerSpecTty(t *testing.T) {
 	testID := "test-id"
 	testSandboxID := "sandbox-id"
@@ -429,10 +540,15 @@ func TestContainerAndSandboxPrivileged(t *testing.T) {
 }
 
 func TestContainerMounts(t *testing.T) {
-	const testSandboxID = "test-id"
+	const (
+		testID        = "test-container-id"
+		testSandboxID = "test-id"
+	)
 	for desc, test := range map[string]struct {
 		statFn          func(string) (os.FileInfo, error)
+		writeFileFn     func(string, []byte, os.FileMode) error
 		criMounts       []*runtime.Mount
+		annotations     map[string]string
 		securityContext *runtime.LinuxContainerSecurityContext
 		expectedMounts  []*runtime.Mount
 	}{
@@ -539,6 +655,38 @@ func TestContainerMounts(t *testing.T) {
 			securityContext: &runtime.LinuxContainerSecurityContext{},
 			expectedMounts:  nil,
 		},
+		"should keep hostname override mount when the hostname file cannot be written": {
+			annotations: map[string]string{
+				annotations.ContainerHostname: "container-hostname",
+			},
+			writeFileFn: func(string, []byte, os.FileMode) error {
+				return errors.New("no such file or directory")
+			},
+			securityContext: &runtime.LinuxContainerSecurityContext{},
+			expectedMounts: []*runtime.Mount{
+				{
+					ContainerPath: "/etc/hostname",
+					HostPath:      filepath.Join(testRootDir, containersDir, testID, "hostname"),
+					Readonly:      false,
+				},
+				{
+					ContainerPath: "/etc/hosts",
+					HostPath:      filepath.Join(testRootDir, sandboxesDir, testSandboxID, "hosts"),
+					Readonly:      false,
+				},
+				{
+					ContainerPath: resolvConfPath,
+					HostPath:      filepath.Join(testRootDir, sandboxesDir, testSandboxID, "resolv.conf"),
+					Readonly:      false,
+				},
+				{
+					ContainerPath:  "/dev/shm",
+					HostPath:       filepath.Join(testStateDir, sandboxesDir, testSandboxID, "shm"),
+					Readonly:       false,
+					SelinuxRelabel: true,
+				},
+			},
+		},
 		"should skip hostname mount if the old sandbox doesn't have hostname file": {
 			statFn: func(path string) (os.FileInfo, error) {
 				assert.Equal(t, filepath.Join(testRootDir, sandboxesDir, testSandboxID, "hostname"), path)
@@ -570,14 +718,16 @@ func TestContainerMounts(t *testing.T) {
 				Name:    "test-name",
 				Attempt: 1,
 			},
-			Mounts: test.criMounts,
+			Mounts:      test.criMounts,
+			Annotations: test.annotations,
 			Linux: &runtime.LinuxContainerConfig{
 				SecurityContext: test.securityContext,
 			},
 		}
 		c := newTestCRIService()
 		c.os.(*ostesting.FakeOS).StatFn = test.statFn
-		mounts := c.containerMounts(testSandboxID, config)
+		c.os.(*ostesting.FakeOS).WriteFileFn = test.writeFileFn
+		mounts := c.containerMounts(testID, testSandboxID, config)
 		assert.Equal(t, test.expectedMounts, mounts, desc)
 	}
 }
@@ -722,7 +872,7 @@ func TestMountPropagation(t *testing.T) {
 		var spec runtimespec.Spec
 		spec.Linux = &runtimespec.Linux{}
 
-		err := opts.WithMounts(c.os, config, []*runtime.Mount{test.criMount}, "")(context.Background(), nil, nil, &spec)
+		err := opts.WithMounts(c.os, config, []*runtime.Mount{test.criMount}, "", false)(context.Background(), nil, nil, &spec)
 		if test.expectErr {
 			require.Error(t, err)
 		} else {
@@ -742,24 +892,20 @@ func TestPidNamespace(t *testing.T) {
 	c := newTestCRIService()
 	for desc, test := range map[string]struct {
 		pidNS    runtime.NamespaceMode
-		expected runtimespec.LinuxNamespace
+		expected *runtimespec.LinuxNamespace
 	}{
-		"node namespace mode": {
+		"node namespace mode should remove the pid namespace": {
 			pidNS: runtime.NamespaceMode_NODE,
-			expected: runtimespec.LinuxNamespace{
-				Type: runtimespec.PIDNamespace,
-				Path: opts.GetPIDNamespace(testPid),
-			},
 		},
 		"container namespace mode": {
 			pidNS: runtime.NamespaceMode_CONTAINER,
-			expected: runtimespec.LinuxNamespace{
+			expected: &runtimespec.LinuxNamespace{
 				Type: runtimespec.PIDNamespace,
 			},
 		},
-		"pod namespace mode": {
+		"pod namespace mode should join the sandbox pid namespace": {
 			pidNS: runtime.NamespaceMode_POD,
-			expected: runtimespec.LinuxNamespace{
+			expected: &runtimespec.LinuxNamespace{
 				Type: runtimespec.PIDNamespace,
 				Path: opts.GetPIDNamespace(testPid),
 			},
@@ -769,7 +915,111 @@ func TestPidNamespace(t *testing.T) {
 		containerConfig.Linux.SecurityContext.NamespaceOptions = &runtime.NamespaceOption{Pid: test.pidNS}
 		spec, err := c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
 		require.NoError(t, err)
-		assert.Contains(t, spec.Linux.Namespaces, test.expected)
+		if test.expected == nil {
+			for _, ns := range spec.Linux.Namespaces {
+				assert.NotEqual(t, runtimespec.PIDNamespace, ns.Type)
+			}
+			continue
+		}
+		assert.Contains(t, spec.Linux.Namespaces, *test.expected)
+	}
+}
+
+func TestRuntimeDefaultResources(t *testing.T) {
+	testID := "test-id"
+	testPid := uint32(1234)
+	testSandboxID := "sandbox-id"
+	testContainerName := "container-name"
+	c := newTestCRIService()
+	ociRuntime := config.Runtime{
+		DefaultResources: &config.RuntimeDefaultResources{
+			MemoryLimitInBytes: 800,
+		},
+	}
+
+	t.Logf("explicit CRI memory limit should take precedence over the runtime default")
+	containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+	spec, err := c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.NoError(t, err)
+	assert.EqualValues(t, 400, *spec.Linux.Resources.Memory.Limit)
+
+	t.Logf("runtime default memory limit should be applied when the CRI request leaves memory unset")
+	containerConfig, sandboxConfig, imageConfig, _ = getCreateContainerTestData()
+	containerConfig.Linux.Resources.MemoryLimitInBytes = 0
+	spec, err = c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.NoError(t, err)
+	assert.EqualValues(t, 800, *spec.Linux.Resources.Memory.Limit)
+	assert.EqualValues(t, 0, containerConfig.Linux.Resources.MemoryLimitInBytes, "CRI request should not be modified")
+}
+
+func TestTargetContainerNamespaces(t *testing.T) {
+	testID := "test-id"
+	testPid := uint32(1234)
+	testSandboxID := "sandbox-id"
+	testContainerName := "container-name"
+	testTargetID := "target-id"
+	testTargetPid := uint32(5678)
+	containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+	ociRuntime := config.Runtime{}
+	for desc, test := range map[string]struct {
+		status    containerstore.Status
+		sandboxID string
+		expectErr bool
+	}{
+		"should join the namespaces of a running target container": {
+			status: containerstore.Status{
+				CreatedAt: 1,
+				StartedAt: 2,
+				Pid:       testTargetPid,
+			},
+			sandboxID: testSandboxID,
+		},
+		"should return error if target container is not running": {
+			status: containerstore.Status{
+				CreatedAt: 1,
+			},
+			sandboxID: testSandboxID,
+			expectErr: true,
+		},
+		"should return error if target container is in another sandbox": {
+			status: containerstore.Status{
+				CreatedAt: 1,
+				StartedAt: 2,
+				Pid:       testTargetPid,
+			},
+			sandboxID: "another-sandbox-id",
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIService()
+		target, err := containerstore.NewContainer(
+			containerstore.Metadata{ID: testTargetID, SandboxID: test.sandboxID},
+			containerstore.WithFakeStatus(test.status),
+		)
+		require.NoError(t, err)
+		require.NoError(t, c.containerStore.Add(target))
+		containerConfig.Annotations = map[string]string{
+			annotations.TargetContainerID: testTargetID,
+		}
+		spec, err := c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Contains(t, spec.Linux.Namespaces, runtimespec.LinuxNamespace{
+			Type: runtimespec.PIDNamespace,
+			Path: opts.GetPIDNamespace(testTargetPid),
+		})
+		assert.Contains(t, spec.Linux.Namespaces, runtimespec.LinuxNamespace{
+			Type: runtimespec.NetworkNamespace,
+			Path: opts.GetNetworkNamespace(testTargetPid),
+		})
+		assert.Contains(t, spec.Linux.Namespaces, runtimespec.LinuxNamespace{
+			Type: runtimespec.IPCNamespace,
+			Path: opts.GetIPCNamespace(testTargetPid),
+		})
 	}
 }
 
@@ -789,6 +1039,32 @@ func TestNoDefaultRunMount(t *testing.T) {
 	}
 }
 
+func TestRunTmpfsMount(t *testing.T) {
+	testID := "test-id"
+	testPid := uint32(1234)
+	testSandboxID := "sandbox-id"
+	testContainerName := "container-name"
+	containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+	ociRuntime := config.Runtime{}
+	c := newTestCRIService()
+	c.config.EnableRunTmpfs = true
+	c.config.RunTmpfsSize = "64m"
+
+	spec, err := c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	assert.NoError(t, err)
+	var runMount *runtimespec.Mount
+	for i, mount := range spec.Mounts {
+		if mount.Destination == "/run" {
+			runMount = &spec.Mounts[i]
+			break
+		}
+	}
+	require.NotNil(t, runMount, "spec should contain a /run mount")
+	assert.Equal(t, "tmpfs", runMount.Type)
+	assert.Contains(t, runMount.Options, "size=64m")
+	assert.Contains(t, runMount.Options, "tmpcopyup")
+}
+
 func TestGenerateSeccompSpecOpts(t *testing.T) {
 	for desc, test := range map[string]struct {
 		profile        string
@@ -870,8 +1146,12 @@ func TestGenerateApparmorSpecOpts(t *testing.T) {
 		specOpts   oci.SpecOpts
 		expectErr  bool
 	}{
-		"should return error if apparmor is specified when apparmor is not supported": {
-			profile:   runtimeDefault,
+		"should ignore default apparmor profile when apparmor is not supported": {
+			profile: runtimeDefault,
+			disable: true,
+		},
+		"should return error if custom apparmor profile is specified when apparmor is not supported": {
+			profile:   profileNamePrefix + "test-profile",
 			disable:   true,
 			expectErr: true,
 		},
@@ -922,7 +1202,11 @@ func TestGenerateApparmorSpecOpts(t *testing.T) {
 		},
 	} {
 		t.Logf("TestCase %q", desc)
-		specOpts, err := generateApparmorSpecOpts(test.profile, test.privileged, !test.disable)
+		c := newTestCRIService()
+		c.loadApparmorProfile = func(profile string) error {
+			return errors.Errorf("apparmor profile file not found %q", profile)
+		}
+		specOpts, err := c.generateApparmorSpecOpts(test.profile, test.privileged, !test.disable)
 		assert.Equal(t,
 			reflect.ValueOf(test.specOpts).Pointer(),
 			reflect.ValueOf(specOpts).Pointer())
@@ -934,6 +1218,27 @@ func TestGenerateApparmorSpecOpts(t *testing.T) {
 	}
 }
 
+func TestFileBackedApparmorProfile(t *testing.T) {
+	c := newTestCRIService()
+	var loaded []string
+	c.loadApparmorProfile = func(profile string) error {
+		loaded = append(loaded, profile)
+		return nil
+	}
+
+	t.Logf("a local profile missing from the kernel should be loaded from file")
+	specOpts, err := c.generateApparmorSpecOpts(profileNamePrefix+"file-profile", false, true)
+	assert.NoError(t, err)
+	assert.NotNil(t, specOpts)
+	assert.Equal(t, []string{"file-profile"}, loaded)
+
+	t.Logf("a profile without the localhost prefix should still be rejected")
+	specOpts, err = c.generateApparmorSpecOpts("file-profile", false, true)
+	assert.Error(t, err)
+	assert.Nil(t, specOpts)
+	assert.Equal(t, []string{"file-profile"}, loaded)
+}
+
 func TestMaskedAndReadonlyPaths(t *testing.T) {
 	testID := "test-id"
 	testSandboxID := "sandbox-id"
@@ -1215,6 +1520,26 @@ func TestPrivilegedDevices(t *testing.T) {
 	}
 }
 
+func TestPrivilegedDeviceAllowlist(t *testing.T) {
+	testPid := uint32(1234)
+	c := newTestCRIService()
+	c.config.PrivilegedDeviceAllowlist = []string{"/dev/null", "/dev/zero"}
+	testSandboxID := "sandbox-id"
+	testContainerName := "container-name"
+	containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+	containerConfig.Linux.SecurityContext.Privileged = true
+	sandboxConfig.Linux.SecurityContext.Privileged = true
+
+	spec, err := c.containerSpec(t.Name(), testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, config.Runtime{})
+	require.NoError(t, err)
+
+	var paths []string
+	for _, dev := range spec.Linux.Devices {
+		paths = append(paths, dev.Path)
+	}
+	assert.Equal(t, []string{"/dev/null", "/dev/zero"}, paths)
+}
+
 func TestBaseOCISpec(t *testing.T) {
 	c := newTestCRIService()
 	baseLimit := int64(100)
@@ -1256,3 +1581,195 @@ func TestBaseOCISpec(t *testing.T) {
 
 	assert.Equal(t, *spec.Linux.Resources.Memory.Limit, containerConfig.Linux.Resources.MemoryLimitInBytes)
 }
+
+func TestContainerSpecExtraEnvPrecedence(t *testing.T) {
+	testID := "test-id"
+	testSandboxID := "sandbox-id"
+	testContainerName := "container-name"
+	testPid := uint32(1234)
+	containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+	ociRuntime := config.Runtime{}
+	c := newTestCRIService()
+
+	tempDir, err := ioutil.TempDir(os.TempDir(), "test-extra-env")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+	envFile := filepath.Join(tempDir, "extra-env")
+	require.NoError(t, ioutil.WriteFile(envFile, []byte(
+		"EXTRA_ONLY=file\n"+
+			"# comment\n"+
+			"\n"+
+			"malformed\n"+
+			"ik8s=file\n"+
+			"cck8s=file\n"), 0644))
+	c.config.ExtraEnvFile = envFile
+	imageConfig.Env = append(imageConfig.Env, "ik8s=image")
+	containerConfig.Envs = append(containerConfig.Envs, &runtime.KeyValue{Key: "cck8s", Value: "config"})
+
+	spec, err := c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.NoError(t, err)
+	envIndex := func(e string) int {
+		for i, env := range spec.Process.Env {
+			if env == e {
+				return i
+			}
+		}
+		return -1
+	}
+	assert.Contains(t, spec.Process.Env, "EXTRA_ONLY=file", "env only in the file should be present")
+	assert.NotContains(t, spec.Process.Env, "malformed")
+	// Env precedence is by ordering, the last duplicate wins.
+	require.Contains(t, spec.Process.Env, "ik8s=image")
+	assert.True(t, envIndex("ik8s=file") < envIndex("ik8s=image"),
+		"image config env should override file env")
+	require.Contains(t, spec.Process.Env, "cck8s=config")
+	assert.True(t, envIndex("cck8s=file") < envIndex("cck8s=config"),
+		"container config env should override file env")
+}
+
+func TestContainerSpecOCIHooks(t *testing.T) {
+	testID := "test-id"
+	testSandboxID := "sandbox-id"
+	testContainerName := "container-name"
+	testPid := uint32(1234)
+	ociRuntime := config.Runtime{}
+	hookAnnotation := "example.com/inject-hook"
+	timeout := 5
+	c := newTestCRIService()
+	c.config.OCIHooks = []config.OCIHook{
+		{
+			Phase:           "prestart",
+			Path:            "/usr/local/bin/device-hook",
+			Args:            []string{"device-hook", "prestart"},
+			Timeout:         timeout,
+			MatchAnnotation: hookAnnotation,
+		},
+		{
+			Phase: "poststop",
+			Path:  "/usr/local/bin/cleanup-hook",
+		},
+	}
+
+	t.Logf("matching container should get the annotation-filtered prestart hook")
+	containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+	containerConfig.Annotations[hookAnnotation] = "true"
+	spec, err := c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.NoError(t, err)
+	require.NotNil(t, spec.Hooks)
+	require.Len(t, spec.Hooks.Prestart, 1)
+	assert.Equal(t, "/usr/local/bin/device-hook", spec.Hooks.Prestart[0].Path)
+	assert.Equal(t, []string{"device-hook", "prestart"}, spec.Hooks.Prestart[0].Args)
+	require.NotNil(t, spec.Hooks.Prestart[0].Timeout)
+	assert.Equal(t, timeout, *spec.Hooks.Prestart[0].Timeout)
+	require.Len(t, spec.Hooks.Poststop, 1)
+	assert.Equal(t, "/usr/local/bin/cleanup-hook", spec.Hooks.Poststop[0].Path)
+
+	t.Logf("container without the annotation should not get the filtered hook")
+	containerConfig, sandboxConfig, imageConfig, _ = getCreateContainerTestData()
+	spec, err = c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.NoError(t, err)
+	require.NotNil(t, spec.Hooks)
+	assert.Empty(t, spec.Hooks.Prestart)
+	require.Len(t, spec.Hooks.Poststop, 1)
+}
+
+func TestContainerSpecMemorySwapLimit(t *testing.T) {
+	testID := "test-id"
+	testSandboxID := "sandbox-id"
+	testContainerName := "container-name"
+	testPid := uint32(1234)
+	ociRuntime := config.Runtime{}
+	c := newTestCRIService()
+
+	t.Logf("valid swap limit should be set in the spec")
+	containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+	containerConfig.Annotations[annotations.MemorySwapLimit] = "800"
+	spec, err := c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.NoError(t, err)
+	require.NotNil(t, spec.Linux.Resources.Memory.Swap)
+	assert.Equal(t, int64(800), *spec.Linux.Resources.Memory.Swap)
+	// The test data memory limit is 400.
+	assert.Equal(t, int64(400), *spec.Linux.Resources.Memory.Limit)
+
+	t.Logf("swap limit smaller than the memory limit should return error")
+	containerConfig, sandboxConfig, imageConfig, _ = getCreateContainerTestData()
+	containerConfig.Annotations[annotations.MemorySwapLimit] = "100"
+	_, err = c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "smaller than memory limit")
+
+	t.Logf("non-integer swap limit should return error")
+	containerConfig, sandboxConfig, imageConfig, _ = getCreateContainerTestData()
+	containerConfig.Annotations[annotations.MemorySwapLimit] = "not-a-number"
+	_, err = c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid memory swap limit")
+}
+
+func TestContainerSpecMemoryReservation(t *testing.T) {
+	testID := "test-id"
+	testSandboxID := "sandbox-id"
+	testContainerName := "container-name"
+	testPid := uint32(1234)
+	ociRuntime := config.Runtime{}
+	c := newTestCRIService()
+
+	t.Logf("valid reservation should be set in the spec")
+	containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+	containerConfig.Annotations[annotations.MemoryReservation] = "200"
+	spec, err := c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.NoError(t, err)
+	require.NotNil(t, spec.Linux.Resources.Memory.Reservation)
+	assert.Equal(t, int64(200), *spec.Linux.Resources.Memory.Reservation)
+	// The test data memory limit is 400.
+	assert.Equal(t, int64(400), *spec.Linux.Resources.Memory.Limit)
+
+	t.Logf("reservation larger than the memory limit should return error")
+	containerConfig, sandboxConfig, imageConfig, _ = getCreateContainerTestData()
+	containerConfig.Annotations[annotations.MemoryReservation] = "800"
+	_, err = c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "larger than memory limit")
+
+	t.Logf("non-integer reservation should return error")
+	containerConfig, sandboxConfig, imageConfig, _ = getCreateContainerTestData()
+	containerConfig.Annotations[annotations.MemoryReservation] = "not-a-number"
+	_, err = c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid memory reservation")
+}
+
+func TestContainerSpecCPURealtime(t *testing.T) {
+	testID := "test-id"
+	testSandboxID := "sandbox-id"
+	testContainerName := "container-name"
+	testPid := uint32(1234)
+	ociRuntime := config.Runtime{}
+	c := newTestCRIService()
+
+	t.Logf("realtime runtime and period should be set in the spec")
+	containerConfig, sandboxConfig, imageConfig, _ := getCreateContainerTestData()
+	containerConfig.Annotations[annotations.CPURealtimeRuntime] = "950000"
+	containerConfig.Annotations[annotations.CPURealtimePeriod] = "1000000"
+	spec, err := c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.NoError(t, err)
+	require.NotNil(t, spec.Linux.Resources.CPU.RealtimeRuntime)
+	assert.Equal(t, int64(950000), *spec.Linux.Resources.CPU.RealtimeRuntime)
+	require.NotNil(t, spec.Linux.Resources.CPU.RealtimePeriod)
+	assert.Equal(t, uint64(1000000), *spec.Linux.Resources.CPU.RealtimePeriod)
+
+	t.Logf("runtime larger than period should return error")
+	containerConfig, sandboxConfig, imageConfig, _ = getCreateContainerTestData()
+	containerConfig.Annotations[annotations.CPURealtimeRuntime] = "2000000"
+	containerConfig.Annotations[annotations.CPURealtimePeriod] = "1000000"
+	_, err = c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "larger than realtime period")
+
+	t.Logf("non-integer values should return error")
+	containerConfig, sandboxConfig, imageConfig, _ = getCreateContainerTestData()
+	containerConfig.Annotations[annotations.CPURealtimePeriod] = "not-a-number"
+	_, err = c.containerSpec(testID, testSandboxID, testPid, "", testContainerName, containerConfig, sandboxConfig, imageConfig, nil, ociRuntime)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid CPU realtime period")
+}
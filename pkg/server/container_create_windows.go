@@ -30,7 +30,7 @@ import (
 )
 
 // No container mounts for windows.
-func (c *criService) containerMounts(sandboxID string, config *runtime.ContainerConfig) []*runtime.Mount {
+func (c *criService) containerMounts(id, sandboxID string, config *runtime.ContainerConfig) []*runtime.Mount {
 	return nil
 }
 
@@ -38,7 +38,7 @@ func (c *criService) containerSpec(id string, sandboxID string, sandboxPid uint3
 	config *runtime.ContainerConfig, sandboxConfig *runtime.PodSandboxConfig, imageConfig *imagespec.ImageConfig,
 	extraMounts []*runtime.Mount, ociRuntime config.Runtime) (*runtimespec.Spec, error) {
 	specOpts := []oci.SpecOpts{
-		customopts.WithProcessArgs(config, imageConfig),
+		customopts.WithProcessArgs(config, imageConfig, c.config.ProcessArgsPolicy),
 	}
 	if config.GetWorkingDir() != "" {
 		specOpts = append(specOpts, oci.WithProcessCwd(config.GetWorkingDir()))
@@ -50,9 +50,9 @@ func (c *criService) containerSpec(id string, sandboxID string, sandboxPid uint3
 		specOpts = append(specOpts, oci.WithTTY)
 	}
 
-	// Apply envs from image config first, so that envs from container config
-	// can override them.
-	env := append([]string{}, imageConfig.Env...)
+	// Apply file-provided extra env first, then envs from image config, so
+	// that envs from container config can override both.
+	env := append(c.loadExtraEnv(), imageConfig.Env...)
 	for _, e := range config.GetEnvs() {
 		env = append(env, e.GetKey()+"="+e.GetValue())
 	}
@@ -103,6 +103,14 @@ func (c *criService) containerSpec(id string, sandboxID string, sandboxPid uint3
 		specOpts = append(specOpts, customopts.WithAnnotation(pKey, pValue))
 	}
 
+	// Propagate allowlisted CRI labels into the OCI spec annotations with a
+	// namespaced prefix, so that OCI hooks and tools reading the spec can
+	// see them without leaking every label.
+	for lKey, lValue := range getPassthroughAnnotations(config.GetLabels(),
+		c.config.SpecLabelAllowlist) {
+		specOpts = append(specOpts, customopts.WithAnnotation(annotations.LabelPrefix+lKey, lValue))
+	}
+
 	specOpts = append(specOpts,
 		customopts.WithAnnotation(annotations.ContainerType, annotations.ContainerTypeContainer),
 		customopts.WithAnnotation(annotations.SandboxID, sandboxID),
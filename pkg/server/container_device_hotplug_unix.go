@@ -0,0 +1,164 @@
+// +build !windows
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"strings"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/log"
+	"github.com/opencontainers/runc/libcontainer/devices"
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+
+	"github.com/containerd/cri/pkg/annotations"
+	ctrdutil "github.com/containerd/cri/pkg/containerd/util"
+	containerstore "github.com/containerd/cri/pkg/store/container"
+	"github.com/containerd/cri/pkg/util"
+)
+
+// hotplugTask is the subset of the containerd task API used for device
+// hot-plug. It is satisfied by containerd.Task and can be faked in tests.
+type hotplugTask interface {
+	Update(context.Context, ...containerd.UpdateTaskOpts) error
+}
+
+// hotplugDevices adds the host devices listed in the hot-plug annotation
+// which are not yet part of the container spec to the container and its
+// running task.
+func (c *criService) hotplugDevices(ctx context.Context, cntr containerstore.Container, status containerstore.Status) error {
+	devicePaths := parseHotplugDevices(cntr.Config.GetAnnotations()[annotations.HotplugDevices])
+	if len(devicePaths) == 0 {
+		return nil
+	}
+	oldSpec, err := cntr.Container.Spec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get container spec")
+	}
+	existing := make(map[string]struct{})
+	if oldSpec.Linux != nil {
+		for _, dev := range oldSpec.Linux.Devices {
+			existing[dev.Path] = struct{}{}
+		}
+	}
+	var devs []runtimespec.LinuxDevice
+	for _, path := range devicePaths {
+		if _, ok := existing[path]; ok {
+			continue
+		}
+		resolved, err := c.os.ResolveSymbolicLink(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve device %q", path)
+		}
+		dev, err := devices.DeviceFromPath(resolved, "rwm")
+		if err != nil {
+			return errors.Wrapf(err, "failed to get device info for %q", path)
+		}
+		devs = append(devs, runtimespec.LinuxDevice{
+			Path:  path,
+			Type:  string(dev.Type),
+			Major: dev.Major,
+			Minor: dev.Minor,
+			UID:   &dev.Uid,
+			GID:   &dev.Gid,
+		})
+	}
+	if len(devs) == 0 {
+		return nil
+	}
+	var task hotplugTask
+	if status.State() == runtime.ContainerState_CONTAINER_RUNNING {
+		t, err := cntr.Container.Task(ctx, nil)
+		if err != nil {
+			if !errdefs.IsNotFound(err) {
+				return errors.Wrap(err, "failed to get task")
+			}
+			// Task exited already, only the spec needs updating.
+		} else {
+			task = t
+		}
+	}
+	return applyDeviceHotplug(ctx, cntr.Container, task, oldSpec, devs)
+}
+
+// applyDeviceHotplug appends the devices and matching device cgroup rules to
+// the container spec and applies the new rules to the running task, if any.
+func applyDeviceHotplug(ctx context.Context, cntr containerd.Container, task hotplugTask, oldSpec *runtimespec.Spec, devs []runtimespec.LinuxDevice) (retErr error) {
+	// Copy to make sure old spec is not changed.
+	var newSpec runtimespec.Spec
+	if err := util.DeepCopy(&newSpec, oldSpec); err != nil {
+		return errors.Wrap(err, "failed to deep copy")
+	}
+	if newSpec.Linux == nil {
+		newSpec.Linux = &runtimespec.Linux{}
+	}
+	if newSpec.Linux.Resources == nil {
+		newSpec.Linux.Resources = &runtimespec.LinuxResources{}
+	}
+	for _, dev := range devs {
+		dev := dev
+		newSpec.Linux.Devices = append(newSpec.Linux.Devices, dev)
+		newSpec.Linux.Resources.Devices = append(newSpec.Linux.Resources.Devices, runtimespec.LinuxDeviceCgroup{
+			Allow:  true,
+			Type:   dev.Type,
+			Major:  &dev.Major,
+			Minor:  &dev.Minor,
+			Access: "rwm",
+		})
+	}
+	if err := updateContainerSpec(ctx, cntr, &newSpec); err != nil {
+		return err
+	}
+	defer func() {
+		if retErr != nil {
+			deferCtx, deferCancel := ctrdutil.DeferContext()
+			defer deferCancel()
+			// Reset spec on error.
+			if err := updateContainerSpec(deferCtx, cntr, oldSpec); err != nil {
+				log.G(ctx).WithError(err).Errorf("Failed to update spec %+v for container %q", oldSpec, cntr.ID())
+			}
+		}
+	}()
+	if task == nil {
+		return nil
+	}
+	if err := task.Update(ctx, containerd.WithResources(newSpec.Linux.Resources)); err != nil {
+		if errdefs.IsNotFound(err) {
+			// Task exited already.
+			return nil
+		}
+		return errors.Wrap(err, "failed to hotplug devices")
+	}
+	return nil
+}
+
+// parseHotplugDevices parses the comma separated host device paths in the
+// hot-plug annotation.
+func parseHotplugDevices(value string) []string {
+	var paths []string
+	for _, path := range strings.Split(value, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,145 @@
+// +build !windows
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/typeurl"
+	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHotplugTask fakes the task update API for device hot-plug tests.
+type fakeHotplugTask struct {
+	containerd.Task
+	updates []*runtimespec.LinuxResources
+	err     error
+}
+
+func (f *fakeHotplugTask) Update(ctx context.Context, opts ...containerd.UpdateTaskOpts) error {
+	if f.err != nil {
+		return f.err
+	}
+	var info containerd.UpdateTaskInfo
+	for _, o := range opts {
+		if err := o(ctx, nil, &info); err != nil {
+			return err
+		}
+	}
+	f.updates = append(f.updates, info.Resources.(*runtimespec.LinuxResources))
+	return nil
+}
+
+// fakeHotplugContainer fakes the container update API for device hot-plug
+// tests, it only tracks the container spec.
+type fakeHotplugContainer struct {
+	containerd.Container
+	spec *runtimespec.Spec
+}
+
+func (f *fakeHotplugContainer) ID() string { return "test-id" }
+
+func (f *fakeHotplugContainer) Spec(ctx context.Context) (*runtimespec.Spec, error) {
+	return f.spec, nil
+}
+
+func (f *fakeHotplugContainer) Update(ctx context.Context, opts ...containerd.UpdateContainerOpts) error {
+	var c containers.Container
+	for _, o := range opts {
+		if err := o(ctx, nil, &c); err != nil {
+			return err
+		}
+	}
+	v, err := typeurl.UnmarshalAny(c.Spec)
+	if err != nil {
+		return err
+	}
+	f.spec = v.(*runtimespec.Spec)
+	return nil
+}
+
+func TestApplyDeviceHotplug(t *testing.T) {
+	newSpec := func() *runtimespec.Spec {
+		return &runtimespec.Spec{
+			Linux: &runtimespec.Linux{
+				Devices: []runtimespec.LinuxDevice{{Path: "/dev/null", Type: "c", Major: 1, Minor: 3}},
+			},
+		}
+	}
+	dev := runtimespec.LinuxDevice{Path: "/dev/fake", Type: "c", Major: 10, Minor: 200}
+
+	t.Logf("hot-plug should update both the container spec and the running task")
+	cntr := &fakeHotplugContainer{spec: newSpec()}
+	task := &fakeHotplugTask{}
+	err := applyDeviceHotplug(context.Background(), cntr, task, cntr.spec, []runtimespec.LinuxDevice{dev})
+	require.NoError(t, err)
+	require.Len(t, cntr.spec.Linux.Devices, 2)
+	assert.Equal(t, "/dev/fake", cntr.spec.Linux.Devices[1].Path)
+	require.Len(t, cntr.spec.Linux.Resources.Devices, 1)
+	rule := cntr.spec.Linux.Resources.Devices[0]
+	assert.True(t, rule.Allow)
+	assert.Equal(t, "c", rule.Type)
+	assert.Equal(t, int64(10), *rule.Major)
+	assert.Equal(t, int64(200), *rule.Minor)
+	assert.Equal(t, "rwm", rule.Access)
+	require.Len(t, task.updates, 1)
+	assert.Equal(t, cntr.spec.Linux.Resources, task.updates[0])
+
+	t.Logf("hot-plug without a running task should only update the spec")
+	cntr = &fakeHotplugContainer{spec: newSpec()}
+	err = applyDeviceHotplug(context.Background(), cntr, nil, cntr.spec, []runtimespec.LinuxDevice{dev})
+	require.NoError(t, err)
+	assert.Len(t, cntr.spec.Linux.Devices, 2)
+
+	t.Logf("spec should be reset when the task update fails")
+	oldSpec := newSpec()
+	cntr = &fakeHotplugContainer{spec: oldSpec}
+	task = &fakeHotplugTask{err: errors.New("update error")}
+	err = applyDeviceHotplug(context.Background(), cntr, task, oldSpec, []runtimespec.LinuxDevice{dev})
+	assert.Error(t, err)
+	assert.Equal(t, newSpec(), cntr.spec)
+}
+
+func TestParseHotplugDevices(t *testing.T) {
+	for desc, test := range map[string]struct {
+		value    string
+		expected []string
+	}{
+		"empty value should parse to nothing": {
+			value: "",
+		},
+		"single device": {
+			value:    "/dev/fake",
+			expected: []string{"/dev/fake"},
+		},
+		"multiple devices with spaces": {
+			value:    "/dev/fake0, /dev/fake1 ,,",
+			expected: []string{"/dev/fake0", "/dev/fake1"},
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		assert.Equal(t, test.expected, parseHotplugDevices(test.value))
+	}
+}
@@ -92,18 +92,9 @@ func (c *criService) filterCRIContainers(containers []*runtime.Container, filter
 		if filter.GetState() != nil && filter.GetState().GetState() != cntr.State {
 			continue
 		}
-		if filter.GetLabelSelector() != nil {
-			match := true
-			for k, v := range filter.GetLabelSelector() {
-				got, ok := cntr.Labels[k]
-				if !ok || got != v {
-					match = false
-					break
-				}
-			}
-			if !match {
-				continue
-			}
+		if filter.GetLabelSelector() != nil &&
+			!matchLabelSelector(filter.GetLabelSelector(), cntr.Labels) {
+			continue
 		}
 		filtered = append(filtered, cntr)
 	}
@@ -126,6 +126,12 @@ func TestFilterContainers(t *testing.T) {
 			},
 			expect: []*runtime.Container{testContainers[1]},
 		},
+		"label filter with multiple labels requires all to match": {
+			filter: &runtime.ContainerFilter{
+				LabelSelector: map[string]string{"a": "b", "x": "y"},
+			},
+			expect: []*runtime.Container{},
+		},
 		"sandbox id filter": {
 			filter: &runtime.ContainerFilter{PodSandboxId: "s-2"},
 			expect: []*runtime.Container{testContainers[1], testContainers[2]},
@@ -40,12 +40,8 @@ func (c *criService) ReopenContainerLog(ctx context.Context, r *runtime.ReopenCo
 	if err != nil {
 		return nil, err
 	}
-	oldStdoutWC, oldStderrWC := container.IO.AddOutput("log", stdoutWC, stderrWC)
-	if oldStdoutWC != nil {
-		oldStdoutWC.Close()
-	}
-	if oldStderrWC != nil {
-		oldStderrWC.Close()
-	}
+	// Swap the loggers atomically, so that no log line is dropped or
+	// duplicated while the log file is rotated.
+	container.IO.SwapOutput("log", stdoutWC, stderrWC)
 	return &runtime.ReopenContainerLogResponse{}, nil
 }
@@ -25,12 +25,14 @@ import (
 	"golang.org/x/net/context"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
+	"github.com/containerd/cri/pkg/annotations"
 	"github.com/containerd/cri/pkg/store"
 	containerstore "github.com/containerd/cri/pkg/store/container"
 )
 
 // RemoveContainer removes the container.
 func (c *criService) RemoveContainer(ctx context.Context, r *runtime.RemoveContainerRequest) (_ *runtime.RemoveContainerResponse, retErr error) {
+	defer c.trackOperation()()
 	container, err := c.containerStore.Get(r.GetContainerId())
 	if err != nil {
 		if err != store.ErrNotExist {
@@ -103,6 +105,21 @@ func (c *criService) RemoveContainer(ctx context.Context, r *runtime.RemoveConta
 	return &runtime.RemoveContainerResponse{}, nil
 }
 
+// autoRemoveContainer removes an exited container whose config carries the
+// auto-remove annotation. Removal goes through RemoveContainer so that it
+// takes the same removing-state lock as a kubelet initiated removal and can
+// not race with it; when kubelet removes the container first, this is a
+// no-op.
+func (c *criService) autoRemoveContainer(ctx context.Context, cntr containerstore.Container) {
+	if cntr.Config.GetAnnotations()[annotations.AutoRemove] != "true" {
+		return
+	}
+	logrus.Infof("Auto-removing exited container %q", cntr.ID)
+	if _, err := c.RemoveContainer(ctx, &runtime.RemoveContainerRequest{ContainerId: cntr.ID}); err != nil {
+		log.G(ctx).WithError(err).Errorf("Failed to auto-remove container %q", cntr.ID)
+	}
+}
+
 // setContainerRemoving sets the container into removing state. In removing state, the
 // container will not be started or removed again.
 func setContainerRemoving(container containerstore.Container) error {
@@ -38,6 +38,7 @@ import (
 
 // StartContainer starts the container.
 func (c *criService) StartContainer(ctx context.Context, r *runtime.StartContainerRequest) (retRes *runtime.StartContainerResponse, retErr error) {
+	defer c.trackOperation()()
 	cntr, err := c.containerStore.Get(r.GetContainerId())
 	if err != nil {
 		return nil, errors.Wrapf(err, "an error occurred when try to find container %q", r.GetContainerId())
@@ -82,6 +83,13 @@ func (c *criService) StartContainer(ctx context.Context, r *runtime.StartContain
 		return nil, errors.Errorf("sandbox container %q is not running", sandboxID)
 	}
 
+	// Verify the container snapshot still exists before creating the task.
+	// The snapshot can be garbage collected out-of-band, in which case task
+	// creation fails deep inside containerd with an opaque error.
+	if err := c.checkContainerSnapshot(ctx, id); err != nil {
+		return nil, err
+	}
+
 	ioCreation := func(id string) (_ containerdio.IO, err error) {
 		stdoutWC, stderrWC, err := c.createContainerLoggers(meta.LogPath, config.GetTty())
 		if err != nil {
@@ -141,6 +149,21 @@ func (c *criService) StartContainer(ctx context.Context, r *runtime.StartContain
 	return &runtime.StartContainerResponse{}, nil
 }
 
+// checkContainerSnapshot verifies that the snapshot backing the container
+// still exists. The snapshot key is the container id.
+func (c *criService) checkContainerSnapshot(ctx context.Context, id string) error {
+	if c.snapshotService == nil {
+		return nil
+	}
+	if _, err := c.snapshotService.Stat(ctx, id); err != nil {
+		if errdefs.IsNotFound(err) {
+			return errors.Errorf("snapshot for container %q no longer exists, remove and re-create the container", id)
+		}
+		return errors.Wrapf(err, "failed to stat snapshot for container %q", id)
+	}
+	return nil
+}
+
 // setContainerStarting sets the container into starting state. In starting state, the
 // container will not be removed or started again.
 func setContainerStarting(container containerstore.Container) error {
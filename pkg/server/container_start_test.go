@@ -20,9 +20,17 @@ import (
 	"testing"
 	"time"
 
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/snapshots"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
 	containerstore "github.com/containerd/cri/pkg/store/container"
+	sandboxstore "github.com/containerd/cri/pkg/store/sandbox"
 )
 
 // TestSetContainerStarting tests setContainerStarting sets removing
@@ -96,3 +104,83 @@ func TestSetContainerStarting(t *testing.T) {
 		}
 	}
 }
+
+// fakeSnapshotService is a fake snapshots.Snapshotter which only knows the
+// snapshots it was created with.
+type fakeSnapshotService struct {
+	snapshots map[string]snapshots.Info
+}
+
+func (f *fakeSnapshotService) Stat(ctx context.Context, key string) (snapshots.Info, error) {
+	info, ok := f.snapshots[key]
+	if !ok {
+		return snapshots.Info{}, errors.Wrapf(errdefs.ErrNotFound, "snapshot %q", key)
+	}
+	return info, nil
+}
+
+func (f *fakeSnapshotService) Update(ctx context.Context, info snapshots.Info, fieldpaths ...string) (snapshots.Info, error) {
+	return snapshots.Info{}, errdefs.ErrNotImplemented
+}
+
+func (f *fakeSnapshotService) Usage(ctx context.Context, key string) (snapshots.Usage, error) {
+	return snapshots.Usage{}, errdefs.ErrNotImplemented
+}
+
+func (f *fakeSnapshotService) Mounts(ctx context.Context, key string) ([]mount.Mount, error) {
+	return nil, errdefs.ErrNotImplemented
+}
+
+func (f *fakeSnapshotService) Prepare(ctx context.Context, key, parent string, opts ...snapshots.Opt) ([]mount.Mount, error) {
+	return nil, errdefs.ErrNotImplemented
+}
+
+func (f *fakeSnapshotService) View(ctx context.Context, key, parent string, opts ...snapshots.Opt) ([]mount.Mount, error) {
+	return nil, errdefs.ErrNotImplemented
+}
+
+func (f *fakeSnapshotService) Commit(ctx context.Context, name, key string, opts ...snapshots.Opt) error {
+	return errdefs.ErrNotImplemented
+}
+
+func (f *fakeSnapshotService) Remove(ctx context.Context, key string) error {
+	return errdefs.ErrNotImplemented
+}
+
+func (f *fakeSnapshotService) Walk(ctx context.Context, fn snapshots.WalkFunc, filters ...string) error {
+	return errdefs.ErrNotImplemented
+}
+
+func (f *fakeSnapshotService) Close() error {
+	return nil
+}
+
+func TestStartContainerMissingSnapshot(t *testing.T) {
+	testID := "test-id"
+	testSandboxID := "test-sandbox-id"
+	c := newTestCRIService()
+	c.snapshotService = &fakeSnapshotService{snapshots: map[string]snapshots.Info{}}
+
+	sandbox := sandboxstore.NewSandbox(
+		sandboxstore.Metadata{ID: testSandboxID},
+		sandboxstore.Status{State: sandboxstore.StateReady},
+	)
+	require.NoError(t, c.sandboxStore.Add(sandbox))
+	container, err := containerstore.NewContainer(
+		containerstore.Metadata{ID: testID, SandboxID: testSandboxID},
+		containerstore.WithFakeStatus(containerstore.Status{CreatedAt: time.Now().UnixNano()}),
+	)
+	require.NoError(t, err)
+	require.NoError(t, c.containerStore.Add(container))
+
+	t.Logf("start should fail with a descriptive error before task creation")
+	_, err = c.StartContainer(context.Background(), &runtime.StartContainerRequest{ContainerId: testID})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no longer exists")
+
+	t.Logf("the precheck should pass when the snapshot is present")
+	c.snapshotService = &fakeSnapshotService{snapshots: map[string]snapshots.Info{
+		testID: {Name: testID},
+	}}
+	assert.NoError(t, c.checkContainerSnapshot(context.Background(), testID))
+}
@@ -96,6 +96,17 @@ func (c *criService) buildTaskMetricsRequest(
 			!matchLabelSelector(r.GetFilter().GetLabelSelector(), cntr.Config.GetLabels()) {
 			continue
 		}
+		if cntr.Status.Get().State() != runtime.ContainerState_CONTAINER_RUNNING {
+			// Stopped containers have no task metrics. Only include them,
+			// with writable layer usage from the snapshot store and nil
+			// CPU/memory, when configured, so that the summary CPU/memory
+			// semantics stay unchanged by default.
+			if c.config.StatsIncludeStoppedContainers &&
+				cntr.Status.Get().State() == runtime.ContainerState_CONTAINER_EXITED {
+				containers = append(containers, cntr)
+			}
+			continue
+		}
 		containers = append(containers, cntr)
 		req.Filters = append(req.Filters, "id=="+cntr.ID)
 	}
@@ -0,0 +1,113 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+
+	containerstore "github.com/containerd/cri/pkg/store/container"
+	snapshotstore "github.com/containerd/cri/pkg/store/snapshot"
+)
+
+func TestBuildTaskMetricsRequestStoppedContainers(t *testing.T) {
+	newContainer := func(id string, status containerstore.Status) containerstore.Container {
+		cntr, err := containerstore.NewContainer(
+			containerstore.Metadata{
+				ID:     id,
+				Name:   id,
+				Config: &runtime.ContainerConfig{},
+			},
+			containerstore.WithFakeStatus(status),
+		)
+		require.NoError(t, err)
+		return cntr
+	}
+	now := time.Now().UnixNano()
+	running := newContainer("running", containerstore.Status{StartedAt: now})
+	stopped := newContainer("stopped", containerstore.Status{StartedAt: now, FinishedAt: now})
+
+	for desc, test := range map[string]struct {
+		includeStopped bool
+		expectedIDs    []string
+	}{
+		"stopped containers should be skipped by default": {
+			expectedIDs: []string{"running"},
+		},
+		"stopped containers should be included when configured": {
+			includeStopped: true,
+			expectedIDs:    []string{"running", "stopped"},
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIService()
+		c.config.StatsIncludeStoppedContainers = test.includeStopped
+		require.NoError(t, c.containerStore.Add(running))
+		require.NoError(t, c.containerStore.Add(stopped))
+
+		req, containers, err := c.buildTaskMetricsRequest(&runtime.ListContainerStatsRequest{
+			Filter: &runtime.ContainerStatsFilter{},
+		})
+		require.NoError(t, err)
+		var ids []string
+		for _, cntr := range containers {
+			ids = append(ids, cntr.ID)
+		}
+		assert.ElementsMatch(t, test.expectedIDs, ids)
+		// Task metrics are only requested for running containers.
+		assert.Equal(t, []string{"id==running"}, req.Filters)
+	}
+}
+
+func TestStoppedContainerWritableLayerStats(t *testing.T) {
+	c := newTestCRIService()
+	c.config.StatsIncludeStoppedContainers = true
+	now := time.Now().UnixNano()
+	stopped, err := containerstore.NewContainer(
+		containerstore.Metadata{
+			ID:     "stopped",
+			Name:   "stopped",
+			Config: &runtime.ContainerConfig{},
+		},
+		containerstore.WithFakeStatus(containerstore.Status{StartedAt: now, FinishedAt: now}),
+	)
+	require.NoError(t, err)
+	c.snapshotStore.Add(snapshotstore.Snapshot{
+		Key:       "stopped",
+		Size:      100,
+		Inodes:    10,
+		Timestamp: now,
+	})
+
+	resp, err := c.toCRIContainerStats(nil, []containerstore.Container{stopped})
+	require.NoError(t, err)
+	require.Len(t, resp.GetStats(), 1)
+	stats := resp.GetStats()[0]
+	assert.Equal(t, "stopped", stats.GetAttributes().GetId())
+
+	t.Logf("writable layer usage should come from the snapshot store")
+	assert.Equal(t, uint64(100), stats.GetWritableLayer().GetUsedBytes().GetValue())
+	assert.Equal(t, uint64(10), stats.GetWritableLayer().GetInodesUsed().GetValue())
+
+	t.Logf("cpu and memory should stay unset without task metrics")
+	assert.Nil(t, stats.GetCpu())
+	assert.Nil(t, stats.GetMemory())
+}
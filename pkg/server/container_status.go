@@ -18,6 +18,7 @@ package server
 
 import (
 	"encoding/json"
+	"strconv"
 
 	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
@@ -163,11 +164,23 @@ func toCRIContainerInfo(ctx context.Context, container containerstore.Container,
 	ci.RuntimeType = ctrInfo.Runtime.Name
 	ci.RuntimeOptions = runtimeOptions
 
+	return containerInfoMap(ci)
+}
+
+// containerInfoMap converts the container info into the CRI status info map.
+// Besides the full json blob under "info", the init task pid is exposed as a
+// separate "pid" entry when the container has been started, so that debugging
+// tools can get the host pid without parsing the blob.
+func containerInfoMap(ci *ContainerInfo) (map[string]string, error) {
 	infoBytes, err := json.Marshal(ci)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to marshal info %v", ci)
 	}
-	return map[string]string{
+	info := map[string]string{
 		"info": string(infoBytes),
-	}, nil
+	}
+	if ci.Pid != 0 {
+		info["pid"] = strconv.FormatUint(uint64(ci.Pid), 10)
+	}
+	return info, nil
 }
@@ -225,3 +225,17 @@ func TestContainerStatus(t *testing.T) {
 		assert.Equal(t, expected, resp.GetStatus())
 	}
 }
+
+func TestContainerInfoMapPid(t *testing.T) {
+	t.Logf("a started container should expose its init task pid")
+	info, err := containerInfoMap(&ContainerInfo{SandboxID: "test-sandbox-id", Pid: 1234})
+	assert.NoError(t, err)
+	assert.Contains(t, info, "info")
+	assert.Equal(t, "1234", info["pid"])
+
+	t.Logf("a created but not started container should not expose a pid")
+	info, err = containerInfoMap(&ContainerInfo{SandboxID: "test-sandbox-id"})
+	assert.NoError(t, err)
+	assert.Contains(t, info, "info")
+	assert.NotContains(t, info, "pid")
+}
@@ -39,6 +39,13 @@ import (
 
 // UpdateContainerResources updates ContainerConfig of the container.
 func (c *criService) UpdateContainerResources(ctx context.Context, r *runtime.UpdateContainerResourcesRequest) (retRes *runtime.UpdateContainerResourcesResponse, retErr error) {
+	if c.config.DisableCgroup {
+		// Resource limits are not applied when cgroup is disabled, and trying
+		// to update them would fail on a cgroup-less setup. Return success so
+		// that kubelet doesn't retry forever.
+		log.G(ctx).Infof("UpdateContainerResources for container %q skipped because cgroup is disabled", r.GetContainerId())
+		return &runtime.UpdateContainerResourcesResponse{}, nil
+	}
 	container, err := c.containerStore.Get(r.GetContainerId())
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to find container")
@@ -47,7 +54,13 @@ func (c *criService) UpdateContainerResources(ctx context.Context, r *runtime.Up
 	// 1) There won't be race condition with container start.
 	// 2) There won't be concurrent resource update to the same container.
 	if err := container.Status.Update(func(status containerstore.Status) (containerstore.Status, error) {
-		return status, c.updateContainerResources(ctx, container, r.GetLinux(), status)
+		if err := c.updateContainerResources(ctx, container, r.GetLinux(), status); err != nil {
+			return status, err
+		}
+		if c.config.EnableDeviceHotplug {
+			return status, c.hotplugDevices(ctx, container, status)
+		}
+		return status, nil
 	}); err != nil {
 		return nil, errors.Wrap(err, "failed to update resources")
 	}
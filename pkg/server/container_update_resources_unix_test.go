@@ -162,3 +162,18 @@ func TestUpdateOCILinuxResource(t *testing.T) {
 		assert.Equal(t, test.expected, got)
 	}
 }
+
+func TestUpdateContainerResourcesDisableCgroup(t *testing.T) {
+	c := newTestCRIService()
+	c.config.DisableCgroup = true
+	// The container is intentionally not added to the container store, so
+	// any attempt to update it would fail.
+	resp, err := c.UpdateContainerResources(context.Background(), &runtime.UpdateContainerResourcesRequest{
+		ContainerId: "test-id",
+		Linux: &runtime.LinuxContainerResources{
+			MemoryLimitInBytes: 54321,
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, resp)
+}
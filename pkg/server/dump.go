@@ -0,0 +1,53 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// dumpState returns a snapshot of the CRI view of sandboxes, containers and
+// images for debugging.
+func (c *criService) dumpState() string {
+	var b strings.Builder
+	sandboxes := c.sandboxStore.List()
+	fmt.Fprintf(&b, "Sandboxes (%d):\n", len(sandboxes))
+	for _, sandbox := range sandboxes {
+		fmt.Fprintf(&b, "  sandbox %q name %q state %q\n",
+			sandbox.ID, sandbox.Name, sandbox.Status.Get().State)
+	}
+	containers := c.containerStore.List()
+	fmt.Fprintf(&b, "Containers (%d):\n", len(containers))
+	for _, cntr := range containers {
+		fmt.Fprintf(&b, "  container %q name %q sandbox %q state %q\n",
+			cntr.ID, cntr.Name, cntr.SandboxID, cntr.Status.Get().State())
+	}
+	images := c.imageStore.List()
+	fmt.Fprintf(&b, "Images (%d):\n", len(images))
+	for _, image := range images {
+		fmt.Fprintf(&b, "  image %q references %v\n", image.ID, image.References)
+	}
+	return b.String()
+}
+
+// logStateDump logs the current store state.
+func (c *criService) logStateDump() {
+	logrus.Infof("CRI state dump:\n%s", c.dumpState())
+}
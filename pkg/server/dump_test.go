@@ -0,0 +1,67 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	containerstore "github.com/containerd/cri/pkg/store/container"
+	imagestore "github.com/containerd/cri/pkg/store/image"
+	sandboxstore "github.com/containerd/cri/pkg/store/sandbox"
+)
+
+func TestDumpState(t *testing.T) {
+	const testImageID = "sha256:1123456789abcdef1123456789abcdef1123456789abcdef1123456789abcdef"
+	c := newTestCRIService()
+
+	sandbox := sandboxstore.NewSandbox(
+		sandboxstore.Metadata{ID: "test-sandbox-id", Name: "test-sandbox-name"},
+		sandboxstore.Status{State: sandboxstore.StateReady},
+	)
+	require.NoError(t, c.sandboxStore.Add(sandbox))
+
+	container, err := containerstore.NewContainer(containerstore.Metadata{
+		ID:        "test-container-id",
+		Name:      "test-container-name",
+		SandboxID: "test-sandbox-id",
+	}, containerstore.WithFakeStatus(containerstore.Status{}))
+	require.NoError(t, err)
+	require.NoError(t, c.containerStore.Add(container))
+
+	c.imageStore, err = imagestore.NewFakeStore([]imagestore.Image{
+		{
+			ID:         testImageID,
+			ChainID:    "test-chain-id",
+			References: []string{"docker.io/library/busybox:latest"},
+			Size:       10,
+		},
+	})
+	require.NoError(t, err)
+
+	dump := c.dumpState()
+	t.Logf("dump should include all seeded store entries:\n%s", dump)
+	assert.Contains(t, dump, "test-sandbox-id")
+	assert.Contains(t, dump, "test-sandbox-name")
+	assert.Contains(t, dump, sandboxstore.StateReady.String())
+	assert.Contains(t, dump, "test-container-id")
+	assert.Contains(t, dump, "test-container-name")
+	assert.Contains(t, dump, testImageID)
+	assert.Contains(t, dump, "docker.io/library/busybox:latest")
+}
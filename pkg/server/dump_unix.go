@@ -0,0 +1,37 @@
+// +build !windows
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+)
+
+// startStateDumpHandler dumps the current store state to the log on SIGUSR2.
+func (c *criService) startStateDumpHandler() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, unix.SIGUSR2)
+	go func() {
+		for range ch {
+			c.logStateDump()
+		}
+	}()
+}
@@ -249,6 +249,7 @@ func (em *eventMonitor) handleEvent(any interface{}) error {
 			if err := handleContainerExit(ctx, e, cntr); err != nil {
 				return errors.Wrap(err, "failed to handle container TaskExit event")
 			}
+			em.c.autoRemoveContainer(ctx, cntr)
 			return nil
 		} else if err != store.ErrNotExist {
 			return errors.Wrap(err, "can't find container for TaskExit event")
@@ -327,7 +328,7 @@ func handleContainerExit(ctx context.Context, e *eventtypes.TaskExit, cntr conta
 	err = cntr.Status.UpdateSync(func(status containerstore.Status) (containerstore.Status, error) {
 		if status.FinishedAt == 0 {
 			status.Pid = 0
-			status.FinishedAt = e.ExitedAt.UnixNano()
+			status.FinishedAt = exitTimestamp(e)
 			status.ExitCode = int32(e.ExitStatus)
 		}
 		// Unknown state can only transit to EXITED state, so we need
@@ -346,6 +347,17 @@ func handleContainerExit(ctx context.Context, e *eventtypes.TaskExit, cntr conta
 	return nil
 }
 
+// exitTimestamp returns the exit timestamp of the event in wall-clock
+// nanoseconds. A zero exit time, e.g. from a malformed event, falls back to
+// the current time instead of producing a nonsensical negative timestamp,
+// so that FinishedAt stays consistent with the other status timestamps.
+func exitTimestamp(e *eventtypes.TaskExit) int64 {
+	if e.ExitedAt.IsZero() {
+		return time.Now().UnixNano()
+	}
+	return e.ExitedAt.UnixNano()
+}
+
 // handleSandboxExit handles TaskExit event for sandbox.
 func handleSandboxExit(ctx context.Context, e *eventtypes.TaskExit, sb sandboxstore.Sandbox) error {
 	// No stream attached to sandbox container.
@@ -20,10 +20,18 @@ import (
 	"testing"
 	"time"
 
+	"github.com/containerd/containerd"
 	eventtypes "github.com/containerd/containerd/api/events"
 	"github.com/containerd/typeurl"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
 	"k8s.io/apimachinery/pkg/util/clock"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+
+	"github.com/containerd/cri/pkg/annotations"
+	"github.com/containerd/cri/pkg/store"
+	containerstore "github.com/containerd/cri/pkg/store/container"
 )
 
 // TestBackOff tests the logic of backOff struct.
@@ -132,3 +140,101 @@ func TestBackOff(t *testing.T) {
 		assert.Equal(t, actQueue, expQueue)
 	}
 }
+
+func TestExitTimestamp(t *testing.T) {
+	t.Logf("the event exit time should be used when set")
+	exitedAt := time.Now().Add(-time.Minute)
+	ts := exitTimestamp(&eventtypes.TaskExit{ExitedAt: exitedAt})
+	assert.Equal(t, exitedAt.UnixNano(), ts)
+
+	t.Logf("a zero exit time should fall back to the current time")
+	before := time.Now().UnixNano()
+	ts = exitTimestamp(&eventtypes.TaskExit{})
+	after := time.Now().UnixNano()
+	assert.True(t, ts >= before && ts <= after)
+}
+
+func TestContainerStatusTimestamps(t *testing.T) {
+	metadata, status, _, _ := getContainerStatusTestData()
+
+	t.Logf("StartedAt should be zero before the container is started")
+	status.StartedAt = 0
+	status.FinishedAt = 0
+	container, err := containerstore.NewContainer(*metadata, containerstore.WithFakeStatus(*status))
+	require.NoError(t, err)
+	criStatus := toCRIContainerStatus(container, &runtime.ImageSpec{}, "")
+	assert.Equal(t, runtime.ContainerState_CONTAINER_CREATED, criStatus.State)
+	assert.Zero(t, criStatus.StartedAt)
+	assert.Zero(t, criStatus.FinishedAt)
+
+	t.Logf("StartedAt should be set once the task has started")
+	startedAt := time.Now().UnixNano()
+	status.StartedAt = startedAt
+	container, err = containerstore.NewContainer(*metadata, containerstore.WithFakeStatus(*status))
+	require.NoError(t, err)
+	criStatus = toCRIContainerStatus(container, &runtime.ImageSpec{}, "")
+	assert.Equal(t, runtime.ContainerState_CONTAINER_RUNNING, criStatus.State)
+	assert.Equal(t, startedAt, criStatus.StartedAt)
+
+	t.Logf("FinishedAt should be set once the task has exited")
+	finishedAt := time.Now().UnixNano()
+	status.FinishedAt = finishedAt
+	container, err = containerstore.NewContainer(*metadata, containerstore.WithFakeStatus(*status))
+	require.NoError(t, err)
+	criStatus = toCRIContainerStatus(container, &runtime.ImageSpec{}, "")
+	assert.Equal(t, runtime.ContainerState_CONTAINER_EXITED, criStatus.State)
+	assert.Equal(t, startedAt, criStatus.StartedAt)
+	assert.Equal(t, finishedAt, criStatus.FinishedAt)
+}
+
+// fakeContainerdContainer is a containerd.Container whose Delete is a no-op,
+// any other method panics.
+type fakeContainerdContainer struct {
+	containerd.Container
+	id string
+}
+
+func (f *fakeContainerdContainer) ID() string { return f.id }
+
+func (f *fakeContainerdContainer) Delete(ctx context.Context, opts ...containerd.DeleteOpts) error {
+	return nil
+}
+
+func TestAutoRemoveContainerOnExit(t *testing.T) {
+	testID := "test-id"
+	c := newTestCRIService()
+
+	newExitedContainer := func(annotationsMap map[string]string) containerstore.Container {
+		cntr, err := containerstore.NewContainer(
+			containerstore.Metadata{
+				ID: testID,
+				Config: &runtime.ContainerConfig{
+					Metadata:    &runtime.ContainerMetadata{Name: "test-name"},
+					Annotations: annotationsMap,
+				},
+			},
+			containerstore.WithFakeStatus(containerstore.Status{
+				CreatedAt:  time.Now().UnixNano(),
+				StartedAt:  time.Now().UnixNano(),
+				FinishedAt: time.Now().UnixNano(),
+			}),
+			containerstore.WithContainer(&fakeContainerdContainer{id: testID}),
+		)
+		require.NoError(t, err)
+		return cntr
+	}
+
+	t.Logf("an auto-remove container should be removed from the store after exit")
+	cntr := newExitedContainer(map[string]string{annotations.AutoRemove: "true"})
+	require.NoError(t, c.containerStore.Add(cntr))
+	c.autoRemoveContainer(context.Background(), cntr)
+	_, err := c.containerStore.Get(testID)
+	assert.Equal(t, store.ErrNotExist, err)
+
+	t.Logf("a container without the annotation should stay in the store")
+	cntr = newExitedContainer(nil)
+	require.NoError(t, c.containerStore.Add(cntr))
+	c.autoRemoveContainer(context.Background(), cntr)
+	_, err = c.containerStore.Get(testID)
+	assert.NoError(t, err)
+}
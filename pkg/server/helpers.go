@@ -35,10 +35,13 @@ import (
 	imagedigest "github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
 	runtimeoptions "github.com/containerd/cri/pkg/api/runtimeoptions/v1"
 	criconfig "github.com/containerd/cri/pkg/config"
+	"github.com/containerd/cri/pkg/constants"
 	"github.com/containerd/cri/pkg/store"
 	containerstore "github.com/containerd/cri/pkg/store/container"
 	imagestore "github.com/containerd/cri/pkg/store/image"
@@ -88,6 +91,11 @@ const (
 	// defaultIfName is the default network interface for the pods
 	defaultIfName = "eth0"
 
+	// According to http://man7.org/linux/man-pages/man5/resolv.conf.5.html:
+	// "The search list is currently limited to six domains with a total of 256 characters."
+	// The same limit is enforced for windows sandboxes for consistency.
+	maxDNSSearches = 6
+
 	// runtimeRunhcsV1 is the runtime type for runhcs.
 	runtimeRunhcsV1 = "io.containerd.runhcs.v1"
 )
@@ -116,10 +124,35 @@ func makeContainerName(c *runtime.ContainerMetadata, s *runtime.PodSandboxMetada
 	}, nameDelimiter)
 }
 
+// rootDirBase returns the base directory for persistent sandbox and
+// container files, honoring the per-namespace override for the managed
+// namespace when one is configured.
+func (c *criService) rootDirBase() string {
+	if dir := c.config.NamespaceRootDirs[constants.K8sContainerdNamespace]; dir != "" {
+		return dir
+	}
+	return c.config.RootDir
+}
+
 // getSandboxRootDir returns the root directory for managing sandbox files,
 // e.g. hosts files.
 func (c *criService) getSandboxRootDir(id string) string {
-	return filepath.Join(c.config.RootDir, sandboxesDir, id)
+	return filepath.Join(c.rootDirBase(), sandboxesDir, id)
+}
+
+// getSandboxHostname returns the hostname file path inside the sandbox root directory.
+func (c *criService) getSandboxHostname(id string) string {
+	return filepath.Join(c.getSandboxRootDir(id), "hostname")
+}
+
+// getSandboxHosts returns the hosts file path inside the sandbox root directory.
+func (c *criService) getSandboxHosts(id string) string {
+	return filepath.Join(c.getSandboxRootDir(id), "hosts")
+}
+
+// getResolvPath returns resolv.conf filepath for specified sandbox.
+func (c *criService) getResolvPath(id string) string {
+	return filepath.Join(c.getSandboxRootDir(id), "resolv.conf")
 }
 
 // getVolatileSandboxRootDir returns the root directory for managing volatile sandbox files,
@@ -131,7 +164,7 @@ func (c *criService) getVolatileSandboxRootDir(id string) string {
 // getContainerRootDir returns the root directory for managing container files,
 // e.g. state checkpoint.
 func (c *criService) getContainerRootDir(id string) string {
-	return filepath.Join(c.config.RootDir, containersDir, id)
+	return filepath.Join(c.rootDirBase(), containersDir, id)
 }
 
 // getVolatileContainerRootDir returns the root directory for managing volatile container files,
@@ -196,6 +229,9 @@ func (c *criService) toContainerdImage(ctx context.Context, image imagestore.Ima
 	if len(image.References) == 0 {
 		return nil, errors.Errorf("invalid image with no reference %q", image.ID)
 	}
+	if c.getContainerdImage != nil {
+		return c.getContainerdImage(ctx, image.References[0])
+	}
 	return c.client.GetImage(ctx, image.References[0])
 }
 
@@ -218,18 +254,24 @@ func getUserFromImage(user string) (*int64, string) {
 	return &uid, ""
 }
 
-// ensureImageExists returns corresponding metadata of the image reference, if image is not
-// pulled yet, the function will pull the image.
+// ensureImageExists returns corresponding metadata of the image reference, pulling
+// the image as dictated by the sandbox image pull policy.
 func (c *criService) ensureImageExists(ctx context.Context, ref string, config *runtime.PodSandboxConfig) (*imagestore.Image, error) {
-	image, err := c.localResolve(ref)
-	if err != nil && err != store.ErrNotExist {
-		return nil, errors.Wrapf(err, "failed to get image %q", ref)
-	}
-	if err == nil {
-		return &image, nil
+	policy := c.config.SandboxImagePullPolicy
+	if policy != criconfig.SandboxImagePullPolicyAlways {
+		image, err := c.localResolve(ref)
+		if err != nil && err != store.ErrNotExist {
+			return nil, errors.Wrapf(err, "failed to get image %q", ref)
+		}
+		if err == nil {
+			return &image, nil
+		}
+		if policy == criconfig.SandboxImagePullPolicyNever {
+			return nil, errors.Errorf("image %q is not present and sandbox image pull policy is %q", ref, policy)
+		}
 	}
 	// Pull image to ensure the image exists
-	resp, err := c.PullImage(ctx, &runtime.PullImageRequest{Image: &runtime.ImageSpec{Image: ref}, SandboxConfig: config})
+	resp, err := c.PullImage(ctx, &runtime.PullImageRequest{Image: &runtime.ImageSpec{Image: ref}, SandboxConfig: config, Auth: c.sandboxPullAuth(ref)})
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to pull image %q", ref)
 	}
@@ -242,6 +284,19 @@ func (c *criService) ensureImageExists(ctx context.Context, ref string, config *
 	return &newImage, nil
 }
 
+// sandboxPullAuth returns the configured sandbox image auth if the given
+// reference is the sandbox image, or nil otherwise, so that the credentials
+// are never applied to workload image pulls.
+func (c *criService) sandboxPullAuth(ref string) *runtime.AuthConfig {
+	if ref != c.config.SandboxImage {
+		return nil
+	}
+	if c.config.SandboxImageAuth == (criconfig.AuthConfig{}) {
+		return nil
+	}
+	return toRuntimeAuthConfig(c.config.SandboxImageAuth)
+}
+
 // isInCRIMounts checks whether a destination is in CRI mount list.
 func isInCRIMounts(dst string, mounts []*runtime.Mount) bool {
 	for _, m := range mounts {
@@ -299,15 +354,26 @@ func parseImageReferences(refs []string) ([]string, []string) {
 // generateRuntimeOptions generates runtime options from cri plugin config.
 func generateRuntimeOptions(r criconfig.Runtime, c criconfig.Config) (interface{}, error) {
 	if r.Options == nil {
-		if r.Type != plugin.RuntimeLinuxV1 {
+		switch r.Type {
+		case plugin.RuntimeRuncV1, plugin.RuntimeRuncV2:
+			if !c.SystemdCgroup {
+				return nil, nil
+			}
+			// Respect the global systemd cgroup setting even if there are
+			// no handler specific options.
+			return &runcoptions.Options{
+				SystemdCgroup: c.SystemdCgroup,
+			}, nil
+		case plugin.RuntimeLinuxV1:
+			// This is a legacy config, generate runctypes.RuncOptions.
+			return &runctypes.RuncOptions{
+				Runtime:       r.Engine,
+				RuntimeRoot:   r.Root,
+				SystemdCgroup: c.SystemdCgroup,
+			}, nil
+		default:
 			return nil, nil
 		}
-		// This is a legacy config, generate runctypes.RuncOptions.
-		return &runctypes.RuncOptions{
-			Runtime:       r.Engine,
-			RuntimeRoot:   r.Root,
-			SystemdCgroup: c.SystemdCgroup,
-		}, nil
 	}
 	options := getRuntimeOptionsType(r.Type)
 	if err := toml.PrimitiveDecode(*r.Options, options); err != nil {
@@ -370,6 +436,16 @@ func unknownSandboxStatus() sandboxstore.Status {
 	}
 }
 
+// runtimeSnapshotter returns the snapshotter used for sandboxes and
+// containers of the given runtime, falling back to the default snapshotter
+// when the runtime does not configure one.
+func (c *criService) runtimeSnapshotter(ociRuntime criconfig.Runtime) string {
+	if ociRuntime.Snapshotter != "" {
+		return ociRuntime.Snapshotter
+	}
+	return c.config.ContainerdConfig.Snapshotter
+}
+
 // getPassthroughAnnotations filters requested pod annotations by comparing
 // against permitted annotations for the given runtime.
 func getPassthroughAnnotations(podAnnotations map[string]string,
@@ -388,3 +464,21 @@ func getPassthroughAnnotations(podAnnotations map[string]string,
 	}
 	return passthroughAnnotations
 }
+
+// checkSandboxLimit returns a resource exhausted error when the configured
+// sandbox limit is reached.
+func (c *criService) checkSandboxLimit() error {
+	if max := c.config.MaxSandboxes; max > 0 && len(c.sandboxStore.List()) >= max {
+		return status.Errorf(codes.ResourceExhausted, "sandbox limit %d reached", max)
+	}
+	return nil
+}
+
+// checkContainerLimit returns a resource exhausted error when the configured
+// container limit is reached.
+func (c *criService) checkContainerLimit() error {
+	if max := c.config.MaxContainers; max > 0 && len(c.containerStore.List()) >= max {
+		return status.Errorf(codes.ResourceExhausted, "container limit %d reached", max)
+	}
+	return nil
+}
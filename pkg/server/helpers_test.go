@@ -19,6 +19,7 @@ package server
 import (
 	"context"
 	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/BurntSushi/toml"
@@ -31,8 +32,10 @@ import (
 	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
 	criconfig "github.com/containerd/cri/pkg/config"
+	"github.com/containerd/cri/pkg/constants"
 	"github.com/containerd/cri/pkg/store"
 	imagestore "github.com/containerd/cri/pkg/store/image"
 )
@@ -222,12 +225,26 @@ systemd_cgroup = true
   Root = "/runcv2"
   NoNewKeyring = true
 `
-	var nilOptsConfig, nonNilOptsConfig criconfig.Config
+	nilOptsNoSystemdCgroup := `
+[containerd]
+  no_pivot = true
+  default_runtime_name = "default"
+[containerd.runtimes.legacy]
+  runtime_type = "` + plugin.RuntimeLinuxV1 + `"
+[containerd.runtimes.runc]
+  runtime_type = "` + plugin.RuntimeRuncV1 + `"
+[containerd.runtimes.runcv2]
+  runtime_type = "` + plugin.RuntimeRuncV2 + `"
+`
+	var nilOptsConfig, nilOptsNoSystemdCgroupConfig, nonNilOptsConfig criconfig.Config
 	_, err := toml.Decode(nilOpts, &nilOptsConfig)
 	require.NoError(t, err)
+	_, err = toml.Decode(nilOptsNoSystemdCgroup, &nilOptsNoSystemdCgroupConfig)
+	require.NoError(t, err)
 	_, err = toml.Decode(nonNilOpts, &nonNilOptsConfig)
 	require.NoError(t, err)
 	require.Len(t, nilOptsConfig.Runtimes, 3)
+	require.Len(t, nilOptsNoSystemdCgroupConfig.Runtimes, 3)
 	require.Len(t, nonNilOptsConfig.Runtimes, 3)
 
 	for desc, test := range map[string]struct {
@@ -235,14 +252,28 @@ systemd_cgroup = true
 		c               criconfig.Config
 		expectedOptions interface{}
 	}{
-		"when options is nil, should return nil option for io.containerd.runc.v1": {
-			r:               nilOptsConfig.Runtimes["runc"],
-			c:               nilOptsConfig,
+		"when options is nil, should set systemd cgroup for io.containerd.runc.v1": {
+			r: nilOptsConfig.Runtimes["runc"],
+			c: nilOptsConfig,
+			expectedOptions: &runcoptions.Options{
+				SystemdCgroup: true,
+			},
+		},
+		"when options is nil, should set systemd cgroup for io.containerd.runc.v2": {
+			r: nilOptsConfig.Runtimes["runcv2"],
+			c: nilOptsConfig,
+			expectedOptions: &runcoptions.Options{
+				SystemdCgroup: true,
+			},
+		},
+		"when options is nil and systemd cgroup is disabled, should return nil option for io.containerd.runc.v1": {
+			r:               nilOptsNoSystemdCgroupConfig.Runtimes["runc"],
+			c:               nilOptsNoSystemdCgroupConfig,
 			expectedOptions: nil,
 		},
-		"when options is nil, should return nil option for io.containerd.runc.v2": {
-			r:               nilOptsConfig.Runtimes["runcv2"],
-			c:               nilOptsConfig,
+		"when options is nil and systemd cgroup is disabled, should return nil option for io.containerd.runc.v2": {
+			r:               nilOptsNoSystemdCgroupConfig.Runtimes["runcv2"],
+			c:               nilOptsNoSystemdCgroupConfig,
 			expectedOptions: nil,
 		},
 		"when options is nil, should use legacy fields for legacy runtime": {
@@ -496,3 +527,89 @@ func TestEnsureRemoveAllWithFile(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestEnsureImageExistsPullPolicy(t *testing.T) {
+	testID := "sha256:d848ce12891bf78792cda4a23c58984033b0c397a55e93a1556202222ecc5ed4"
+	testRef := "gcr.io/library/busybox:latest"
+	image := imagestore.Image{
+		ID:         testID,
+		References: []string{testRef},
+	}
+
+	t.Logf("IfNotPresent should skip the pull when the image is present")
+	c := newTestCRIService()
+	c.config.SandboxImagePullPolicy = criconfig.SandboxImagePullPolicyIfNotPresent
+	var err error
+	c.imageStore, err = imagestore.NewFakeStore([]imagestore.Image{image})
+	require.NoError(t, err)
+	// The test service has no containerd client, so attempting a pull
+	// here would panic.
+	got, err := c.ensureImageExists(context.Background(), testRef, nil)
+	require.NoError(t, err)
+	assert.Equal(t, testID, got.ID)
+
+	t.Logf("Never should fail fast when the image is missing")
+	c = newTestCRIService()
+	c.config.SandboxImagePullPolicy = criconfig.SandboxImagePullPolicyNever
+	_, err = c.ensureImageExists(context.Background(), testRef, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sandbox image pull policy")
+}
+
+func TestSandboxPullAuth(t *testing.T) {
+	auth := criconfig.AuthConfig{
+		Username: "user",
+		Password: "password",
+	}
+	for desc, test := range map[string]struct {
+		ref      string
+		auth     criconfig.AuthConfig
+		expected *runtime.AuthConfig
+	}{
+		"sandbox image should use the configured auth": {
+			ref:  "k8s.gcr.io/pause:3.2",
+			auth: auth,
+			expected: &runtime.AuthConfig{
+				Username: "user",
+				Password: "password",
+			},
+		},
+		"workload image should not use the configured auth": {
+			ref:      "gcr.io/library/busybox:latest",
+			auth:     auth,
+			expected: nil,
+		},
+		"sandbox image without configured auth should get no auth": {
+			ref:      "k8s.gcr.io/pause:3.2",
+			expected: nil,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIService()
+		c.config.SandboxImage = "k8s.gcr.io/pause:3.2"
+		c.config.SandboxImageAuth = test.auth
+		assert.Equal(t, test.expected, c.sandboxPullAuth(test.ref))
+	}
+}
+
+func TestNamespaceRootDirOverride(t *testing.T) {
+	testID := "test-id"
+	c := newTestCRIService()
+
+	t.Logf("should use the plugin root dir without an override")
+	assert.Equal(t, filepath.Join(testRootDir, containersDir, testID), c.getContainerRootDir(testID))
+	assert.Equal(t, filepath.Join(testRootDir, sandboxesDir, testID), c.getSandboxRootDir(testID))
+
+	t.Logf("an override for another namespace should not take effect")
+	c.config.NamespaceRootDirs = map[string]string{"other": "/custom/other"}
+	assert.Equal(t, filepath.Join(testRootDir, containersDir, testID), c.getContainerRootDir(testID))
+
+	t.Logf("an override for the managed namespace should relocate the root dirs")
+	c.config.NamespaceRootDirs[constants.K8sContainerdNamespace] = "/custom/k8s"
+	assert.Equal(t, filepath.Join("/custom/k8s", containersDir, testID), c.getContainerRootDir(testID))
+	assert.Equal(t, filepath.Join("/custom/k8s", sandboxesDir, testID), c.getSandboxRootDir(testID))
+
+	t.Logf("volatile root dirs should keep using the state dir")
+	assert.Equal(t, filepath.Join(testStateDir, containersDir, testID), c.getVolatileContainerRootDir(testID))
+	assert.Equal(t, filepath.Join(testStateDir, sandboxesDir, testID), c.getVolatileSandboxRootDir(testID))
+}
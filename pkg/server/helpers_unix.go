@@ -32,6 +32,8 @@ import (
 
 	"github.com/containerd/containerd/log"
 	"github.com/containerd/containerd/mount"
+	"github.com/containerd/cri/pkg/netns"
+	osinterface "github.com/containerd/cri/pkg/os"
 	"github.com/containerd/cri/pkg/seccomp"
 	runcapparmor "github.com/opencontainers/runc/libcontainer/apparmor"
 	"github.com/opencontainers/selinux/go-selinux/label"
@@ -47,9 +49,6 @@ const (
 	defaultShmSize = int64(1024 * 1024 * 64)
 	// relativeRootfsPath is the rootfs path relative to bundle path.
 	relativeRootfsPath = "rootfs"
-	// According to http://man7.org/linux/man-pages/man5/resolv.conf.5.html:
-	// "The search list is currently limited to six domains with a total of 256 characters."
-	maxDNSSearches = 6
 	// devShm is the default path of /dev/shm.
 	devShm = "/dev/shm"
 	// etcHosts is the default path of /etc/hosts file.
@@ -62,10 +61,13 @@ const (
 	hostnameEnv = "HOSTNAME"
 )
 
-// getCgroupsPath generates container cgroups path.
-func getCgroupsPath(cgroupsParent, id string) string {
+// getCgroupsPath generates container cgroups path. When systemd cgroup is
+// enabled, or the cgroup parent is a systemd slice, the path is generated in
+// the systemd "slice:prefix:name" form expected by runc, otherwise it is a
+// regular cgroupfs path.
+func getCgroupsPath(cgroupsParent, id string, systemdCgroup bool) string {
 	base := path.Base(cgroupsParent)
-	if strings.HasSuffix(base, ".slice") {
+	if systemdCgroup || strings.HasSuffix(base, ".slice") {
 		// For a.slice/b.slice/c.slice, base is c.slice.
 		// runc systemd cgroup path format is "slice:prefix:name".
 		return strings.Join([]string{base, "cri-containerd", id}, ":")
@@ -73,21 +75,6 @@ func getCgroupsPath(cgroupsParent, id string) string {
 	return filepath.Join(cgroupsParent, id)
 }
 
-// getSandboxHostname returns the hostname file path inside the sandbox root directory.
-func (c *criService) getSandboxHostname(id string) string {
-	return filepath.Join(c.getSandboxRootDir(id), "hostname")
-}
-
-// getSandboxHosts returns the hosts file path inside the sandbox root directory.
-func (c *criService) getSandboxHosts(id string) string {
-	return filepath.Join(c.getSandboxRootDir(id), "hosts")
-}
-
-// getResolvPath returns resolv.conf filepath for specified sandbox.
-func (c *criService) getResolvPath(id string) string {
-	return filepath.Join(c.getSandboxRootDir(id), "resolv.conf")
-}
-
 // getSandboxDevShm returns the shm file path inside the sandbox root directory.
 func (c *criService) getSandboxDevShm(id string) string {
 	return filepath.Join(c.getVolatileSandboxRootDir(id), "shm")
@@ -259,3 +246,44 @@ func ensureRemoveAll(ctx context.Context, dir string) error {
 		time.Sleep(100 * time.Millisecond)
 	}
 }
+
+// cleanupLeakedNetNS removes netns files under the netns directory which are
+// not referenced by any sandbox in the sandbox store. Such files can be
+// leaked by ungraceful shutdowns. Cleanup is best effort, a failure to
+// remove a single netns only generates a warning.
+func (c *criService) cleanupLeakedNetNS(ctx context.Context) error {
+	nsFiles, err := c.os.ReadDir(netns.NSRunDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to read netns directory %q", netns.NSRunDir)
+	}
+	used := make(map[string]struct{})
+	for _, sb := range c.sandboxStore.List() {
+		if sb.NetNSPath != "" {
+			used[sb.NetNSPath] = struct{}{}
+		}
+	}
+	for _, f := range nsFiles {
+		nsPath := filepath.Join(netns.NSRunDir, f.Name())
+		if _, ok := used[nsPath]; ok {
+			continue
+		}
+		path, err := c.os.FollowSymlinkInScope(nsPath, "/")
+		if err != nil {
+			log.G(ctx).WithError(err).Warnf("Failed to follow symlink for leaked netns %q", nsPath)
+			continue
+		}
+		if err := c.os.(osinterface.UNIX).Unmount(path); err != nil && !os.IsNotExist(err) {
+			log.G(ctx).WithError(err).Warnf("Failed to unmount leaked netns %q", path)
+			continue
+		}
+		if err := c.os.RemoveAll(path); err != nil {
+			log.G(ctx).WithError(err).Warnf("Failed to remove leaked netns %q", path)
+			continue
+		}
+		log.G(ctx).Debugf("Cleanup leaked netns %q", path)
+	}
+	return nil
+}
@@ -26,14 +26,20 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 	"golang.org/x/sys/unix"
+
+	"github.com/containerd/cri/pkg/netns"
+	ostesting "github.com/containerd/cri/pkg/os/testing"
+	sandboxstore "github.com/containerd/cri/pkg/store/sandbox"
 )
 
 func TestGetCgroupsPath(t *testing.T) {
 	testID := "test-id"
 	for desc, test := range map[string]struct {
 		cgroupsParent string
+		systemdCgroup bool
 		expected      string
 	}{
 		"should support regular cgroup path": {
@@ -56,9 +62,14 @@ func TestGetCgroupsPath(t *testing.T) {
 			cgroupsParent: "/",
 			expected:      "/test-id",
 		},
+		"should use systemd form when systemd cgroup is enabled": {
+			cgroupsParent: "/kubepods",
+			systemdCgroup: true,
+			expected:      "kubepods:cri-containerd:test-id",
+		},
 	} {
 		t.Logf("TestCase %q", desc)
-		got := getCgroupsPath(test.cgroupsParent, testID)
+		got := getCgroupsPath(test.cgroupsParent, testID, test.systemdCgroup)
 		assert.Equal(t, test.expected, got)
 	}
 }
@@ -106,3 +117,47 @@ func TestEnsureRemoveAllWithMount(t *testing.T) {
 		t.Fatalf("expected %q to not exist", dir1)
 	}
 }
+
+// fakeFileInfo only implements the name of a directory entry.
+type fakeFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (f fakeFileInfo) Name() string {
+	return f.name
+}
+
+func TestCleanupLeakedNetNS(t *testing.T) {
+	usedNetNS := filepath.Join(netns.NSRunDir, "cni-used")
+	leakedNetNS := filepath.Join(netns.NSRunDir, "cni-leaked")
+	c := newTestCRIService()
+	fakeOS := c.os.(*ostesting.FakeOS)
+	fakeOS.ReadDirFn = func(dir string) ([]os.FileInfo, error) {
+		assert.Equal(t, netns.NSRunDir, dir)
+		return []os.FileInfo{
+			fakeFileInfo{name: "cni-used"},
+			fakeFileInfo{name: "cni-leaked"},
+		}, nil
+	}
+	sandbox := sandboxstore.NewSandbox(
+		sandboxstore.Metadata{
+			ID:        "test-id",
+			Name:      "test-name",
+			NetNSPath: usedNetNS,
+		},
+		sandboxstore.Status{State: sandboxstore.StateReady},
+	)
+	require.NoError(t, c.sandboxStore.Add(sandbox))
+
+	require.NoError(t, c.cleanupLeakedNetNS(context.Background()))
+
+	var removed []string
+	for _, call := range fakeOS.GetCalls() {
+		if call.Name == "RemoveAll" {
+			removed = append(removed, call.Arguments[0].(string))
+		}
+	}
+	assert.Contains(t, removed, leakedNetNS, "unreferenced netns should be removed")
+	assert.NotContains(t, removed, usedNetNS, "referenced netns should remain")
+}
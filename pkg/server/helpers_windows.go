@@ -26,6 +26,16 @@ import (
 	"time"
 )
 
+// hostEtcHosts returns the path of the hosts file on the windows host,
+// conventionally %SystemRoot%\System32\drivers\etc\hosts.
+func hostEtcHosts() string {
+	systemRoot := os.Getenv("SystemRoot")
+	if systemRoot == "" {
+		systemRoot = `C:\Windows`
+	}
+	return filepath.Join(systemRoot, "System32", "drivers", "etc", "hosts")
+}
+
 // openLogFile opens/creates a container log file.
 // It specifies `FILE_SHARE_DELETE` option to make sure
 // log files can be rotated by kubelet.
@@ -217,3 +227,9 @@ func ensureRemoveAll(_ context.Context, dir string) error {
 		time.Sleep(100 * time.Millisecond)
 	}
 }
+
+// cleanupLeakedNetNS is a noop on windows, network namespaces are managed by
+// the host compute service.
+func (c *criService) cleanupLeakedNetNS(_ context.Context) error {
+	return nil
+}
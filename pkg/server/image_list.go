@@ -17,18 +17,24 @@
 package server
 
 import (
+	"strings"
+
 	"golang.org/x/net/context"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+
+	imagestore "github.com/containerd/cri/pkg/store/image"
 )
 
 // ListImages lists existing images.
-// TODO(random-liu): Add image list filters after CRI defines this more clear, and kubelet
-// actually needs it.
 func (c *criService) ListImages(ctx context.Context, r *runtime.ListImagesRequest) (*runtime.ListImagesResponse, error) {
+	filter := r.GetFilter().GetImage().GetImage()
 	imagesInStore := c.imageStore.List()
 
 	var images []*runtime.Image
 	for _, image := range imagesInStore {
+		if !matchImageFilter(image, filter) {
+			continue
+		}
 		// TODO(random-liu): [P0] Make sure corresponding snapshot exists. What if snapshot
 		// doesn't exist?
 		images = append(images, toCRIImage(image))
@@ -36,3 +42,21 @@ func (c *criService) ListImages(ctx context.Context, r *runtime.ListImagesReques
 
 	return &runtime.ListImagesResponse{Images: images}, nil
 }
+
+// matchImageFilter returns whether the image matches the reference filter.
+// An image matches if the filter is a prefix of its id or of any of its
+// references, so both full references and repository prefixes work.
+func matchImageFilter(image imagestore.Image, filter string) bool {
+	if filter == "" {
+		return true
+	}
+	if strings.HasPrefix(image.ID, filter) {
+		return true
+	}
+	for _, ref := range image.References {
+		if strings.HasPrefix(ref, filter) {
+			return true
+		}
+	}
+	return false
+}
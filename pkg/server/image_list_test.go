@@ -111,3 +111,78 @@ func TestListImages(t *testing.T) {
 		assert.Contains(t, images, i)
 	}
 }
+
+func TestListImagesWithFilter(t *testing.T) {
+	imagesInStore := []imagestore.Image{
+		{
+			ID: "sha256:1123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			References: []string{
+				"gcr.io/library/busybox:latest",
+				"gcr.io/library/busybox@sha256:e6693c20186f837fc393390135d8a598a96a833917917789d63766cab6c59582",
+			},
+		},
+		{
+			ID: "sha256:2123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			References: []string{
+				"gcr.io/library/alpine:latest",
+				"gcr.io/library/alpine@sha256:e6693c20186f837fc393390135d8a598a96a833917917789d63766cab6c59582",
+			},
+		},
+		{
+			ID:         "sha256:3123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			References: []string{"docker.io/library/ubuntu:latest"},
+		},
+	}
+	for desc, test := range map[string]struct {
+		filter   string
+		expected []string
+	}{
+		"empty filter should match all images": {
+			filter: "",
+			expected: []string{
+				"sha256:1123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+				"sha256:2123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+				"sha256:3123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			},
+		},
+		"repository prefix should scope results": {
+			filter: "gcr.io/library/busybox",
+			expected: []string{
+				"sha256:1123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			},
+		},
+		"registry prefix should match multiple images": {
+			filter: "gcr.io/",
+			expected: []string{
+				"sha256:1123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+				"sha256:2123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			},
+		},
+		"image id prefix should match": {
+			filter: "sha256:3123",
+			expected: []string{
+				"sha256:3123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			},
+		},
+		"non-matching filter should return nothing": {
+			filter:   "quay.io/",
+			expected: nil,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIService()
+		var err error
+		c.imageStore, err = imagestore.NewFakeStore(imagesInStore)
+		require.NoError(t, err)
+
+		resp, err := c.ListImages(context.Background(), &runtime.ListImagesRequest{
+			Filter: &runtime.ImageFilter{Image: &runtime.ImageSpec{Image: test.filter}},
+		})
+		require.NoError(t, err)
+		var ids []string
+		for _, i := range resp.GetImages() {
+			ids = append(ids, i.GetId())
+		}
+		assert.ElementsMatch(t, test.expected, ids)
+	}
+}
@@ -0,0 +1,247 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// loadImageResult is the outcome of loading a single image from a tar
+// archive. Err is nil when the image was loaded successfully.
+type loadImageResult struct {
+	// Ref is the image reference from the archive.
+	Ref string
+	// Err is the failure loading this image, if any.
+	Err error
+}
+
+// loadImage loads images from a docker save or OCI image tar archive into
+// the containerd image store, and updates the CRI image store for every
+// loaded reference. A docker save tar may contain multiple images; each
+// image is processed independently, so that one broken image does not
+// prevent the others from loading. The returned error is only non-nil when
+// the archive itself can not be imported.
+func (c *criService) loadImage(ctx context.Context, tarPath, platform string) ([]loadImageResult, error) {
+	rc, err := openImageArchive(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return c.loadImageFromStream(ctx, rc, platform)
+}
+
+// loadImageFromStream loads images from an image tar archive stream. It is
+// split out from loadImage so that archives piped in over stdin can be
+// streamed to the same load logic. When platform is not empty, only the
+// images matching the platform are loaded from a multi-arch archive.
+func (c *criService) loadImageFromStream(ctx context.Context, reader io.Reader, platform string) ([]loadImageResult, error) {
+	release, err := c.acquireLoadSlot()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	// The import runs under a client managed lease, so blobs of a partial
+	// import are garbage collected once the lease expires on failure.
+	imgs, err := c.client.Import(ctx, reader)
+	if err != nil {
+		return nil, classifyLoadError(err)
+	}
+	if platform != "" {
+		imgs, err = filterImagesByPlatform(imgs, platform)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var refs []string
+	for _, img := range imgs {
+		refs = append(refs, img.Name)
+	}
+	return loadImageResults(ctx, refs, c.updateImage), nil
+}
+
+// filterImagesByPlatform keeps only the imported images matching the
+// requested platform. Images without a recorded platform are kept, since
+// single-platform docker archives often do not record one.
+func filterImagesByPlatform(imgs []images.Image, platform string) ([]images.Image, error) {
+	p, err := platforms.Parse(platform)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid platform %q", platform)
+	}
+	matcher := platforms.NewMatcher(p)
+	var filtered []images.Image
+	for _, img := range imgs {
+		if img.Target.Platform != nil && !matcher.Match(*img.Target.Platform) {
+			continue
+		}
+		filtered = append(filtered, img)
+	}
+	return filtered, nil
+}
+
+// maxConcurrentLoads normalizes the configured load concurrency limit;
+// non-positive values mean to serialize all loads.
+func maxConcurrentLoads(configured int) int {
+	if configured <= 0 {
+		return 1
+	}
+	return configured
+}
+
+// acquireLoadSlot reserves a slot for an image load operation and returns
+// the function releasing it. It fails fast with an unavailable error when
+// the configured number of loads is already in progress, so that callers
+// get a clear "import in progress" signal instead of hanging on content
+// store contention.
+func (c *criService) acquireLoadSlot() (func(), error) {
+	if c.loadSem == nil {
+		return func() {}, nil
+	}
+	select {
+	case c.loadSem <- struct{}{}:
+		return func() { <-c.loadSem }, nil
+	default:
+		return nil, errors.Wrap(errdefs.ErrUnavailable, "image load already in progress, try again later")
+	}
+}
+
+// loadImageStdinPath is the tar path used to request loading the image
+// archive from stdin, following the usual CLI convention.
+const loadImageStdinPath = "-"
+
+// openImageArchive opens the image tar archive at the given path. "-"
+// reads the archive from stdin, and a directory is streamed as a tar of
+// its OCI image layout, so that layout directories can be imported without
+// creating a temporary archive.
+func openImageArchive(path string) (io.ReadCloser, error) {
+	if path == loadImageStdinPath {
+		// Wrap stdin so that closing the archive does not close stdin.
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to stat image archive %q", path)
+	}
+	if info.IsDir() {
+		return openOCILayout(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open image tar %q", path)
+	}
+	return f, nil
+}
+
+// openOCILayout checks that the directory looks like an OCI image layout
+// and returns a stream tarring it on the fly, which is the archive format
+// the containerd importer expects.
+func openOCILayout(dir string) (io.ReadCloser, error) {
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err != nil {
+		return nil, errors.Wrapf(err, "%q is not an OCI image layout, missing index.json", dir)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(tarDirectory(dir, pw))
+	}()
+	return pr, nil
+}
+
+// tarDirectory writes the directory content to the writer as a tar archive
+// with paths relative to the directory root.
+func tarDirectory(dir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(name)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	}); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// loadImageResults updates the CRI image store for each imported reference
+// independently and reports per-image success or failure.
+func loadImageResults(ctx context.Context, refs []string, update func(context.Context, string) error) []loadImageResult {
+	results := make([]loadImageResult, 0, len(refs))
+	for _, ref := range refs {
+		res := loadImageResult{Ref: ref}
+		if err := update(ctx, ref); err != nil {
+			res.Err = errors.Wrapf(err, "failed to update image store for %q", ref)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// classifyLoadError maps known importer failures to actionable messages,
+// so that a user loading a bad tar is told what is wrong with it instead
+// of getting the raw importer error. Unknown errors are returned as is.
+func classifyLoadError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch {
+	case errors.Cause(err) == tar.ErrHeader:
+		return errors.Wrap(err, "the file is not a valid tar archive")
+	case strings.Contains(err.Error(), "unrecognized image format"):
+		return errors.Wrap(err, "the archive is neither a docker save archive nor an OCI image layout, it contains no manifest.json or index.json")
+	case strings.Contains(err.Error(), "untar manifest"):
+		return errors.Wrap(err, "the image manifest in the archive is malformed")
+	case strings.Contains(err.Error(), "unsupported OCI version"):
+		return errors.Wrap(err, "the OCI layout version in the archive is not supported")
+	case strings.Contains(err.Error(), "missing index.json"):
+		return errors.Wrap(err, "the OCI layout in the archive is missing index.json")
+	default:
+		return err
+	}
+}
@@ -0,0 +1,268 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestOpenImageArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-load")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	tarPath := filepath.Join(dir, "image.tar")
+	require.NoError(t, ioutil.WriteFile(tarPath, []byte("test archive content"), 0600))
+
+	t.Logf("a file path should be opened and readable")
+	rc, err := openImageArchive(tarPath)
+	require.NoError(t, err)
+	var content []byte
+	content, err = ioutil.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "test archive content", string(content))
+	assert.NoError(t, rc.Close())
+
+	t.Logf("%q should read the archive from stdin", loadImageStdinPath)
+	rc, err = openImageArchive(loadImageStdinPath)
+	require.NoError(t, err)
+	require.NotNil(t, rc)
+	// Closing the returned archive must not close stdin itself.
+	assert.NoError(t, rc.Close())
+	_, err = os.Stdin.Stat()
+	assert.NoError(t, err)
+
+	t.Logf("a missing file should return an error")
+	_, err = openImageArchive(filepath.Join(dir, "does-not-exist.tar"))
+	assert.Error(t, err)
+}
+
+func TestLoadImageResults(t *testing.T) {
+	updateErr := errors.New("update failure")
+	update := func(_ context.Context, ref string) error {
+		if ref == "docker.io/library/broken:latest" {
+			return updateErr
+		}
+		return nil
+	}
+	results := loadImageResults(context.Background(), []string{
+		"docker.io/library/busybox:latest",
+		"docker.io/library/broken:latest",
+		"docker.io/library/alpine:latest",
+	}, update)
+	require.Len(t, results, 3, "every image should get a result")
+	assert.Equal(t, "docker.io/library/busybox:latest", results[0].Ref)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, "docker.io/library/broken:latest", results[1].Ref)
+	assert.Contains(t, results[1].Err.Error(), updateErr.Error())
+	assert.Equal(t, "docker.io/library/alpine:latest", results[2].Ref,
+		"a failed image should not prevent loading the remaining images")
+	assert.NoError(t, results[2].Err)
+}
+
+func TestAcquireLoadSlot(t *testing.T) {
+	c := newTestCRIService()
+	c.loadSem = make(chan struct{}, maxConcurrentLoads(0))
+
+	t.Logf("a second load should fail fast while one is in progress")
+	release, err := c.acquireLoadSlot()
+	require.NoError(t, err)
+	_, err = c.acquireLoadSlot()
+	require.Error(t, err)
+	assert.True(t, errdefs.IsUnavailable(err))
+
+	t.Logf("the slot should be reusable after release")
+	release()
+	release, err = c.acquireLoadSlot()
+	require.NoError(t, err)
+	release()
+
+	t.Logf("exactly one of two concurrent loads should get the slot")
+	var (
+		wg        sync.WaitGroup
+		succeeded int32
+	)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.acquireLoadSlot(); err == nil {
+				atomic.AddInt32(&succeeded, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), succeeded)
+
+	t.Logf("a nil semaphore should not limit loads")
+	c.loadSem = nil
+	release, err = c.acquireLoadSlot()
+	require.NoError(t, err)
+	release()
+}
+
+func TestFilterImagesByPlatform(t *testing.T) {
+	amd64 := &imagespec.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := &imagespec.Platform{OS: "linux", Architecture: "arm64"}
+	imgs := []images.Image{
+		{Name: "docker.io/library/busybox:amd64", Target: imagespec.Descriptor{Platform: amd64}},
+		{Name: "docker.io/library/busybox:arm64", Target: imagespec.Descriptor{Platform: arm64}},
+		{Name: "docker.io/library/busybox:noplatform"},
+	}
+
+	t.Logf("only the requested platform should be kept from a multi-arch archive")
+	filtered, err := filterImagesByPlatform(imgs, "linux/amd64")
+	require.NoError(t, err)
+	var names []string
+	for _, img := range filtered {
+		names = append(names, img.Name)
+	}
+	assert.Equal(t, []string{
+		"docker.io/library/busybox:amd64",
+		"docker.io/library/busybox:noplatform",
+	}, names, "images without a recorded platform should be kept")
+
+	t.Logf("an invalid platform should return an error")
+	_, err = filterImagesByPlatform(imgs, "not a platform")
+	assert.Error(t, err)
+}
+
+func TestClassifyLoadError(t *testing.T) {
+	for desc, test := range map[string]struct {
+		err         error
+		expected    string
+		passthrough bool
+	}{
+		"nil error should stay nil": {
+			err: nil,
+		},
+		"a corrupt tar should be reported as not a tar archive": {
+			err:      errors.Wrap(tar.ErrHeader, "failed to import"),
+			expected: "not a valid tar archive",
+		},
+		"an unrecognized format should be reported as not an image archive": {
+			err:      errors.New("unrecognized image format"),
+			expected: "neither a docker save archive nor an OCI image layout",
+		},
+		"a malformed manifest should be reported as such": {
+			err:      errors.Wrap(errors.New("unexpected end of JSON input"), `untar manifest "manifest.json"`),
+			expected: "image manifest in the archive is malformed",
+		},
+		"an unsupported OCI layout version should be reported as such": {
+			err:      errors.New("unsupported OCI version 2.0.0"),
+			expected: "OCI layout version in the archive is not supported",
+		},
+		"a missing OCI index should be reported as such": {
+			err:      errors.New("missing index.json in OCI layout 1.0.0"),
+			expected: "missing index.json",
+		},
+		"an unknown error should pass through unchanged": {
+			err:         errors.New("some other failure"),
+			passthrough: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		got := classifyLoadError(test.err)
+		if test.err == nil {
+			assert.NoError(t, got)
+			continue
+		}
+		if test.passthrough {
+			assert.Equal(t, test.err, got)
+			continue
+		}
+		assert.Contains(t, got.Error(), test.expected)
+		// The original error must be preserved for debugging.
+		assert.Contains(t, got.Error(), test.err.Error())
+	}
+}
+
+func TestOpenImageArchiveStdin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-load-stdin")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stdinPath := filepath.Join(dir, "stdin")
+	require.NoError(t, ioutil.WriteFile(stdinPath, []byte("piped archive content"), 0600))
+	f, err := os.Open(stdinPath)
+	require.NoError(t, err)
+	defer f.Close()
+	oldStdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = oldStdin }()
+
+	t.Logf("the archive content should be readable through stdin")
+	rc, err := openImageArchive(loadImageStdinPath)
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "piped archive content", string(content))
+	assert.NoError(t, rc.Close())
+}
+
+func TestOpenImageArchiveOCILayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-load-layout")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Logf("a directory without index.json should be rejected")
+	_, err = openImageArchive(dir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing index.json")
+
+	layout := map[string]string{
+		"oci-layout":        `{"imageLayoutVersion": "1.0.0"}`,
+		"index.json":        `{"schemaVersion": 2}`,
+		"blobs/sha256/blob": "blob content",
+	}
+	for name, content := range layout {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+
+	t.Logf("the layout directory should be streamed as a tar archive")
+	rc, err := openImageArchive(dir)
+	require.NoError(t, err)
+	defer rc.Close()
+	found := map[string]string{}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		content, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		found[hdr.Name] = string(content)
+	}
+	assert.Equal(t, layout, found)
+}
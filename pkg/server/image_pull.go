@@ -134,7 +134,7 @@ func (c *criService) PullImage(ctx context.Context, r *runtime.PullImageRequest)
 			containerd.WithChildLabelMap(containerdimages.ChildGCLabelsFilterLayers))
 	}
 
-	image, err := c.client.Pull(ctx, ref, pullOpts...)
+	image, err := c.pullImage(ctx, ref, pullOpts...)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to pull and unpack image %q", ref)
 	}
@@ -171,6 +171,30 @@ func (c *criService) PullImage(ctx context.Context, r *runtime.PullImageRequest)
 	return &runtime.PullImageResponse{ImageRef: imageID}, nil
 }
 
+// pullImage pulls the image through the containerd client, returning
+// promptly when the context is cancelled even if the underlying pull is
+// stuck in non-cancellable I/O. The pull goroutine shares the cancelled
+// context, so the resolver and fetcher abort as well, and any partial
+// ingest is released for containerd garbage collection.
+func (c *criService) pullImage(ctx context.Context, ref string, opts ...containerd.RemoteOpt) (containerd.Image, error) {
+	type pullResult struct {
+		image containerd.Image
+		err   error
+	}
+	resCh := make(chan pullResult, 1)
+	go func() {
+		image, err := c.pullContainerdImage(ctx, ref, opts...)
+		resCh <- pullResult{image: image, err: err}
+	}()
+	select {
+	case res := <-resCh:
+		return res.image, res.err
+	case <-ctx.Done():
+		log.G(ctx).Infof("Pull of image %q was cancelled", ref)
+		return nil, errors.Wrap(ctx.Err(), "pull was cancelled")
+	}
+}
+
 // ParseAuth parses AuthConfig and returns username and password/secret required by containerd.
 func ParseAuth(auth *runtime.AuthConfig, host string) (string, string, error) {
 	if auth == nil {
@@ -22,10 +22,13 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/containerd/containerd"
 	digest "github.com/opencontainers/go-digest"
 	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
 	criconfig "github.com/containerd/cri/pkg/config"
@@ -110,6 +113,42 @@ func TestParseAuth(t *testing.T) {
 	}
 }
 
+func TestPullImageCancellation(t *testing.T) {
+	c := newTestCRIService()
+	pulling := make(chan struct{})
+	c.pullContainerdImage = func(ctx context.Context, ref string, opts ...containerd.RemoteOpt) (containerd.Image, error) {
+		close(pulling)
+		// Simulate a pull stuck in the resolver until the context is
+		// cancelled.
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := c.PullImage(ctx, &runtime.PullImageRequest{
+			Image: &runtime.ImageSpec{Image: "docker.io/library/busybox:latest"},
+		})
+		errCh <- err
+	}()
+
+	t.Logf("cancelling the context mid-pull should abort the pull promptly")
+	<-pulling
+	cancel()
+	select {
+	case err := <-errCh:
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), context.Canceled.Error())
+	case <-time.After(5 * time.Second):
+		t.Fatalf("PullImage did not return after the context was cancelled")
+	}
+
+	t.Logf("no image metadata should be created for a cancelled pull")
+	assert.Empty(t, c.imageStore.List())
+}
+
 func TestRegistryEndpoints(t *testing.T) {
 	for desc, test := range map[string]struct {
 		mirrors  map[string]criconfig.Mirror
@@ -24,6 +24,7 @@ import (
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
 	"github.com/containerd/cri/pkg/store"
+	imagestore "github.com/containerd/cri/pkg/store/image"
 )
 
 // RemoveImage removes the image.
@@ -42,7 +43,15 @@ func (c *criService) RemoveImage(ctx context.Context, r *runtime.RemoveImageRequ
 		return nil, errors.Wrapf(err, "can not resolve %q locally", r.GetImage().GetImage())
 	}
 
-	// Remove all image references.
+	if err := c.removeImageRefs(ctx, image); err != nil {
+		return nil, err
+	}
+	return &runtime.RemoveImageResponse{}, nil
+}
+
+// removeImageRefs removes all references of the image from containerd,
+// and updates the image store accordingly.
+func (c *criService) removeImageRefs(ctx context.Context, image imagestore.Image) error {
 	for i, ref := range image.References {
 		var opts []images.DeleteOpt
 		if i == len(image.References)-1 {
@@ -51,15 +60,46 @@ func (c *criService) RemoveImage(ctx context.Context, r *runtime.RemoveImageRequ
 			// someone else before this point.
 			opts = []images.DeleteOpt{images.SynchronousDelete()}
 		}
-		err = c.client.ImageService().Delete(ctx, ref, opts...)
+		err := c.client.ImageService().Delete(ctx, ref, opts...)
 		if err == nil || errdefs.IsNotFound(err) {
 			// Update image store to reflect the newest state in containerd.
 			if err := c.imageStore.Update(ctx, ref); err != nil {
-				return nil, errors.Wrapf(err, "failed to update image reference %q for %q", ref, image.ID)
+				return errors.Wrapf(err, "failed to update image reference %q for %q", ref, image.ID)
 			}
 			continue
 		}
-		return nil, errors.Wrapf(err, "failed to delete image reference %q for %q", ref, image.ID)
+		return errors.Wrapf(err, "failed to delete image reference %q for %q", ref, image.ID)
 	}
-	return &runtime.RemoveImageResponse{}, nil
+	return nil
+}
+
+// removeDanglingImages removes all images which have no repo tags and are
+// not used by any container, using the given remove function. It returns
+// the ids of the removed images and the total reclaimed bytes. The in-use
+// check is repeated per image right before removal, and content used by
+// running containers remains protected by containerd's garbage collection
+// references, so a concurrent container creation at worst keeps an image
+// alive one extra round.
+func (c *criService) removeDanglingImages(ctx context.Context, remove func(context.Context, imagestore.Image) error) ([]string, int64, error) {
+	var (
+		removed   []string
+		reclaimed int64
+	)
+	for _, image := range c.imageStore.List() {
+		if !danglingImage(image) || c.imageInUse(image.ID) {
+			continue
+		}
+		if err := remove(ctx, image); err != nil {
+			return removed, reclaimed, errors.Wrapf(err, "failed to remove dangling image %q", image.ID)
+		}
+		removed = append(removed, image.ID)
+		reclaimed += image.Size
+	}
+	return removed, reclaimed, nil
+}
+
+// danglingImage returns whether the image has no repo tags.
+func danglingImage(image imagestore.Image) bool {
+	repoTags, _ := parseImageReferences(image.References)
+	return len(repoTags) == 0
 }
@@ -0,0 +1,78 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	containerstore "github.com/containerd/cri/pkg/store/container"
+	imagestore "github.com/containerd/cri/pkg/store/image"
+)
+
+func TestRemoveDanglingImages(t *testing.T) {
+	taggedID := "sha256:1123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	danglingID := "sha256:2123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	inUseID := "sha256:3123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	imagesInStore := []imagestore.Image{
+		{
+			ID: taggedID,
+			References: []string{
+				"gcr.io/library/busybox:latest",
+				"gcr.io/library/busybox@sha256:e6693c20186f837fc393390135d8a598a96a833917917789d63766cab6c59582",
+			},
+			Size: 1000,
+		},
+		{
+			ID:         danglingID,
+			References: []string{"gcr.io/library/alpine@sha256:e6693c20186f837fc393390135d8a598a96a833917917789d63766cab6c59582"},
+			Size:       2000,
+		},
+		{
+			ID:         inUseID,
+			References: []string{"gcr.io/library/ubuntu@sha256:e6693c20186f837fc393390135d8a598a96a833917917789d63766cab6c59582"},
+			Size:       3000,
+		},
+	}
+	c := newTestCRIService()
+	var err error
+	c.imageStore, err = imagestore.NewFakeStore(imagesInStore)
+	require.NoError(t, err)
+	container, err := containerstore.NewContainer(
+		containerstore.Metadata{
+			ID:       "test-container-id",
+			ImageRef: inUseID,
+		},
+		containerstore.WithFakeStatus(containerstore.Status{}),
+	)
+	require.NoError(t, err)
+	require.NoError(t, c.containerStore.Add(container))
+
+	var removedIDs []string
+	remove := func(ctx context.Context, image imagestore.Image) error {
+		removedIDs = append(removedIDs, image.ID)
+		return nil
+	}
+	removed, reclaimed, err := c.removeDanglingImages(context.Background(), remove)
+	require.NoError(t, err)
+	assert.Equal(t, []string{danglingID}, removed, "only the untagged unused image should be removed")
+	assert.Equal(t, []string{danglingID}, removedIDs)
+	assert.Equal(t, int64(2000), reclaimed)
+}
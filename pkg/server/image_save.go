@@ -0,0 +1,55 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"io"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images/archive"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// saveImage exports the image referenced by ref from the CRI image store
+// into a docker/OCI compatible tar archive written to w, complementing
+// loadImage for transferring images to air-gapped nodes.
+func (c *criService) saveImage(ctx context.Context, ref string, w io.Writer) error {
+	image, err := c.localResolve(ref)
+	if err != nil {
+		return errors.Wrapf(err, "can not resolve %q locally", ref)
+	}
+	// Resolve the manifest descriptor through the image id reference,
+	// which always exists for images managed by the cri plugin.
+	img, err := c.client.GetImage(ctx, image.ID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get image %q", image.ID)
+	}
+	return exportImage(ctx, c.client.ContentStore(), img.Target(), image.References, w)
+}
+
+// exportImage streams an archive containing the manifest and layers of the
+// image to w, tagged with the given references. It is split out from
+// saveImage so that the export logic can be exercised with a fake content
+// provider.
+func exportImage(ctx context.Context, provider content.Provider, manifest imagespec.Descriptor, refs []string, w io.Writer) error {
+	if err := archive.Export(ctx, provider, w, archive.WithManifest(manifest, refs...)); err != nil {
+		return errors.Wrap(err, "failed to export image archive")
+	}
+	return nil
+}
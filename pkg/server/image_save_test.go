@@ -0,0 +1,123 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	containerdimages "github.com/containerd/containerd/images"
+	digest "github.com/opencontainers/go-digest"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// fakeContentProvider serves blobs from memory for export tests.
+type fakeContentProvider struct {
+	blobs map[digest.Digest][]byte
+}
+
+func (p *fakeContentProvider) ReaderAt(_ context.Context, desc imagespec.Descriptor) (content.ReaderAt, error) {
+	b, ok := p.blobs[desc.Digest]
+	if !ok {
+		return nil, errdefs.ErrNotFound
+	}
+	return &fakeReaderAt{Reader: bytes.NewReader(b), size: int64(len(b))}, nil
+}
+
+type fakeReaderAt struct {
+	*bytes.Reader
+	size int64
+}
+
+func (r *fakeReaderAt) Size() int64 { return r.size }
+
+func (r *fakeReaderAt) Close() error { return nil }
+
+func TestExportImage(t *testing.T) {
+	provider := &fakeContentProvider{blobs: make(map[digest.Digest][]byte)}
+	addBlob := func(mediaType string, b []byte) imagespec.Descriptor {
+		dgst := digest.FromBytes(b)
+		provider.blobs[dgst] = b
+		return imagespec.Descriptor{
+			MediaType: mediaType,
+			Digest:    dgst,
+			Size:      int64(len(b)),
+		}
+	}
+
+	configDesc := addBlob(containerdimages.MediaTypeDockerSchema2Config,
+		[]byte(`{"architecture":"amd64","os":"linux"}`))
+	layerDesc := addBlob(containerdimages.MediaTypeDockerSchema2LayerGzip,
+		[]byte("test layer content"))
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     containerdimages.MediaTypeDockerSchema2Manifest,
+		"config":        configDesc,
+		"layers":        []imagespec.Descriptor{layerDesc},
+	})
+	require.NoError(t, err)
+	manifestDesc := addBlob(containerdimages.MediaTypeDockerSchema2Manifest, manifest)
+
+	testRef := "docker.io/library/busybox:latest"
+	var buf bytes.Buffer
+	require.NoError(t, exportImage(context.Background(), provider, manifestDesc, []string{testRef}, &buf))
+
+	// Collect the archive entries.
+	entries := make(map[string][]byte)
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		entries[hdr.Name] = b
+	}
+
+	blobPath := func(desc imagespec.Descriptor) string {
+		return fmt.Sprintf("blobs/sha256/%s", desc.Digest.Encoded())
+	}
+	assert.Contains(t, entries, "manifest.json")
+	assert.Contains(t, entries, "index.json")
+	assert.Contains(t, entries, blobPath(manifestDesc), "manifest blob should be exported")
+	assert.Contains(t, entries, blobPath(configDesc), "config blob should be exported")
+	assert.Contains(t, entries, blobPath(layerDesc), "layer blob should be exported")
+	assert.Equal(t, []byte("test layer content"), entries[blobPath(layerDesc)])
+
+	var mfsts []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}
+	require.NoError(t, json.Unmarshal(entries["manifest.json"], &mfsts))
+	require.Len(t, mfsts, 1)
+	// The exporter writes the familiar form of the reference as repo tag.
+	assert.Contains(t, mfsts[0].RepoTags, "busybox:latest")
+	assert.Contains(t, mfsts[0].Layers, blobPath(layerDesc))
+}
@@ -78,6 +78,9 @@ func toCRIImage(image imagestore.Image) *runtime.Image {
 type verboseImageInfo struct {
 	ChainID   string          `json:"chainID"`
 	ImageSpec imagespec.Image `json:"imageSpec"`
+	// InUse indicates whether the image is used by at least one container,
+	// in which case RemoveImage would fail.
+	InUse bool `json:"inUse"`
 }
 
 // toCRIImageInfo converts internal image object information to CRI image status response info map.
@@ -91,6 +94,7 @@ func (c *criService) toCRIImageInfo(ctx context.Context, image *imagestore.Image
 	imi := &verboseImageInfo{
 		ChainID:   image.ChainID,
 		ImageSpec: image.ImageSpec,
+		InUse:     c.imageInUse(image.ID),
 	}
 
 	m, err := json.Marshal(imi)
@@ -103,3 +107,14 @@ func (c *criService) toCRIImageInfo(ctx context.Context, image *imagestore.Image
 
 	return info, nil
 }
+
+// imageInUse returns whether any container in the container store was
+// created from the given image.
+func (c *criService) imageInUse(id string) bool {
+	for _, cntr := range c.containerStore.List() {
+		if cntr.ImageRef == id {
+			return true
+		}
+	}
+	return false
+}
@@ -17,6 +17,7 @@
 package server
 
 import (
+	"encoding/json"
 	"testing"
 
 	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
@@ -25,6 +26,7 @@ import (
 	"golang.org/x/net/context"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
+	containerstore "github.com/containerd/cri/pkg/store/container"
 	imagestore "github.com/containerd/cri/pkg/store/image"
 )
 
@@ -72,3 +74,46 @@ func TestImageStatus(t *testing.T) {
 	assert.NotNil(t, resp)
 	assert.Equal(t, expected, resp.GetImage())
 }
+
+func TestImageStatusInUse(t *testing.T) {
+	testID := "sha256:d848ce12891bf78792cda4a23c58984033b0c397a55e93a1556202222ecc5ed4"
+	image := imagestore.Image{
+		ID:      testID,
+		ChainID: "test-chain-id",
+	}
+	c := newTestCRIService()
+	var err error
+	c.imageStore, err = imagestore.NewFakeStore([]imagestore.Image{image})
+	require.NoError(t, err)
+
+	t.Logf("image without container should not be in use")
+	info, err := c.toCRIImageInfo(context.Background(), &image, true)
+	require.NoError(t, err)
+	imi := &verboseImageInfo{}
+	require.NoError(t, json.Unmarshal([]byte(info["info"]), imi))
+	assert.False(t, imi.InUse)
+
+	t.Logf("image with a container created from it should be in use")
+	container, err := containerstore.NewContainer(
+		containerstore.Metadata{
+			ID:       "test-container-id",
+			ImageRef: testID,
+		},
+		containerstore.WithFakeStatus(containerstore.Status{}),
+	)
+	require.NoError(t, err)
+	require.NoError(t, c.containerStore.Add(container))
+	info, err = c.toCRIImageInfo(context.Background(), &image, true)
+	require.NoError(t, err)
+	imi = &verboseImageInfo{}
+	require.NoError(t, json.Unmarshal([]byte(info["info"]), imi))
+	assert.True(t, imi.InUse)
+
+	t.Logf("image should not be in use after the container is removed")
+	c.containerStore.Delete("test-container-id")
+	info, err = c.toCRIImageInfo(context.Background(), &image, true)
+	require.NoError(t, err)
+	imi = &verboseImageInfo{}
+	require.NoError(t, json.Unmarshal([]byte(info["info"]), imi))
+	assert.False(t, imi.InUse)
+}
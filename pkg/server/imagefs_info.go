@@ -17,8 +17,12 @@
 package server
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/containerd/containerd/log"
 	"golang.org/x/net/context"
 
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
@@ -39,14 +43,84 @@ func (c *criService) ImageFsInfo(ctx context.Context, r *runtime.ImageFsInfoRequ
 		inodesUsed += sn.Inodes
 	}
 	// TODO(random-liu): Handle content store
-	return &runtime.ImageFsInfoResponse{
-		ImageFilesystems: []*runtime.FilesystemUsage{
-			{
-				Timestamp:  timestamp,
-				FsId:       &runtime.FilesystemIdentifier{Mountpoint: c.imageFSPath},
-				UsedBytes:  &runtime.UInt64Value{Value: usedBytes},
-				InodesUsed: &runtime.UInt64Value{Value: inodesUsed},
-			},
+	filesystems := []*runtime.FilesystemUsage{
+		{
+			Timestamp:  timestamp,
+			FsId:       &runtime.FilesystemIdentifier{Mountpoint: c.imageFSPath},
+			UsedBytes:  &runtime.UInt64Value{Value: usedBytes},
+			InodesUsed: &runtime.UInt64Value{Value: inodesUsed},
 		},
-	}, nil
+	}
+	// Report an additional filesystem entry per distinct runtime
+	// snapshotter. Snapshot usage is only tracked for the default
+	// snapshotter today, so those entries report zero usage.
+	for _, snapshotter := range c.extraSnapshotters() {
+		filesystems = append(filesystems, &runtime.FilesystemUsage{
+			Timestamp:  timestamp,
+			FsId:       &runtime.FilesystemIdentifier{Mountpoint: imageFSPath(c.config.ContainerdRootDir, snapshotter)},
+			UsedBytes:  &runtime.UInt64Value{},
+			InodesUsed: &runtime.UInt64Value{},
+		})
+	}
+	return &runtime.ImageFsInfoResponse{ImageFilesystems: filesystems}, nil
+}
+
+// imageFSLowResourcesReason is the reason reported when the image
+// filesystem is running out of bytes or inodes.
+const imageFSLowResourcesReason = "ImageFilesystemLowResources"
+
+// imageFSCondition checks the free space of the image filesystem against
+// the configured thresholds, and returns a degraded condition when a
+// threshold is crossed, or nil when the check is disabled or passes.
+func (c *criService) imageFSCondition(ctx context.Context) *runtime.RuntimeCondition {
+	bytesThreshold := c.config.ImageFSFreeBytesThreshold
+	inodesThreshold := c.config.ImageFSFreeInodesThreshold
+	if bytesThreshold <= 0 && inodesThreshold <= 0 {
+		return nil
+	}
+	if c.getImageFSStats == nil {
+		return nil
+	}
+	freeBytes, freeInodes, err := c.getImageFSStats(c.imageFSPath)
+	if err != nil {
+		log.G(ctx).WithError(err).Errorf("Failed to get stats of image filesystem %q", c.imageFSPath)
+		return nil
+	}
+	var problems []string
+	if bytesThreshold > 0 && freeBytes < uint64(bytesThreshold) {
+		problems = append(problems, fmt.Sprintf("free bytes %d below threshold %d", freeBytes, bytesThreshold))
+	}
+	if inodesThreshold > 0 && freeInodes < uint64(inodesThreshold) {
+		problems = append(problems, fmt.Sprintf("free inodes %d below threshold %d", freeInodes, inodesThreshold))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	message := fmt.Sprintf("Image filesystem %q is low on resources: %s", c.imageFSPath, strings.Join(problems, "; "))
+	log.G(ctx).Warn(message)
+	return &runtime.RuntimeCondition{
+		Type:    "ImageFilesystemReady",
+		Status:  false,
+		Reason:  imageFSLowResourcesReason,
+		Message: message,
+	}
+}
+
+// extraSnapshotters returns the distinct per-runtime snapshotters
+// configured besides the default one, sorted for stable output.
+func (c *criService) extraSnapshotters() []string {
+	seen := map[string]struct{}{c.config.ContainerdConfig.Snapshotter: {}}
+	var extras []string
+	for _, r := range c.config.ContainerdConfig.Runtimes {
+		if r.Snapshotter == "" {
+			continue
+		}
+		if _, ok := seen[r.Snapshotter]; ok {
+			continue
+		}
+		seen[r.Snapshotter] = struct{}{}
+		extras = append(extras, r.Snapshotter)
+	}
+	sort.Strings(extras)
+	return extras
 }
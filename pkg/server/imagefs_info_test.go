@@ -17,6 +17,7 @@
 package server
 
 import (
+	"errors"
 	"testing"
 
 	snapshot "github.com/containerd/containerd/snapshots"
@@ -25,6 +26,7 @@ import (
 	"golang.org/x/net/context"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
+	criconfig "github.com/containerd/cri/pkg/config"
 	snapshotstore "github.com/containerd/cri/pkg/store/snapshot"
 )
 
@@ -68,3 +70,93 @@ func TestImageFsInfo(t *testing.T) {
 	assert.Len(t, stats, 1)
 	assert.Equal(t, expected, stats[0])
 }
+
+func TestImageFSCondition(t *testing.T) {
+	for desc, test := range map[string]struct {
+		bytesThreshold  int64
+		inodesThreshold int64
+		freeBytes       uint64
+		freeInodes      uint64
+		statsErr        error
+		expectCondition bool
+		expectedMessage string
+	}{
+		"no condition when the check is disabled": {
+			freeBytes:  100,
+			freeInodes: 10,
+		},
+		"no condition when free space is above the thresholds": {
+			bytesThreshold:  50,
+			inodesThreshold: 5,
+			freeBytes:       100,
+			freeInodes:      10,
+		},
+		"condition when free bytes drop below the threshold": {
+			bytesThreshold:  1000,
+			freeBytes:       100,
+			freeInodes:      10,
+			expectCondition: true,
+			expectedMessage: "free bytes 100 below threshold 1000",
+		},
+		"condition when free inodes drop below the threshold": {
+			inodesThreshold: 100,
+			freeBytes:       100,
+			freeInodes:      10,
+			expectCondition: true,
+			expectedMessage: "free inodes 10 below threshold 100",
+		},
+		"no condition when getting stats fails": {
+			bytesThreshold: 1000,
+			statsErr:       errors.New("injected failure"),
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		c := newTestCRIService()
+		c.config.ImageFSFreeBytesThreshold = test.bytesThreshold
+		c.config.ImageFSFreeInodesThreshold = test.inodesThreshold
+		c.getImageFSStats = func(path string) (uint64, uint64, error) {
+			assert.Equal(t, testImageFSPath, path)
+			return test.freeBytes, test.freeInodes, test.statsErr
+		}
+		cond := c.imageFSCondition(context.Background())
+		if !test.expectCondition {
+			assert.Nil(t, cond)
+			continue
+		}
+		require.NotNil(t, cond)
+		assert.Equal(t, "ImageFilesystemReady", cond.Type)
+		assert.False(t, cond.Status)
+		assert.Equal(t, imageFSLowResourcesReason, cond.Reason)
+		assert.Contains(t, cond.Message, test.expectedMessage)
+
+		t.Logf("the condition should be reported in Status")
+		resp, err := c.Status(context.Background(), &runtime.StatusRequest{})
+		require.NoError(t, err)
+		var found bool
+		for _, sc := range resp.GetStatus().GetConditions() {
+			if sc.Type == "ImageFilesystemReady" {
+				found = true
+				assert.False(t, sc.Status)
+			}
+		}
+		assert.True(t, found)
+	}
+}
+
+func TestImageFsInfoMultipleSnapshotters(t *testing.T) {
+	c := newTestCRIService()
+	c.config.ContainerdRootDir = testRootDir
+	c.config.ContainerdConfig.Snapshotter = "overlayfs"
+	c.config.ContainerdConfig.Runtimes = map[string]criconfig.Runtime{
+		"runc": {},
+		"kata": {Snapshotter: "devmapper"},
+	}
+
+	resp, err := c.ImageFsInfo(context.Background(), &runtime.ImageFsInfoRequest{})
+	require.NoError(t, err)
+	stats := resp.GetImageFilesystems()
+	require.Len(t, stats, 2, "one filesystem entry per distinct snapshotter")
+	assert.Equal(t, testImageFSPath, stats[0].GetFsId().GetMountpoint())
+	assert.Equal(t, imageFSPath(testRootDir, "devmapper"), stats[1].GetFsId().GetMountpoint())
+	assert.NotEqual(t, stats[0].GetFsId().GetMountpoint(), stats[1].GetFsId().GetMountpoint())
+}
@@ -0,0 +1,28 @@
+// +build windows
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import "github.com/pkg/errors"
+
+// getImageFSStats returns the free bytes and free inodes of the filesystem
+// at the given path.
+// TODO(windows): Implement image filesystem stats for windows.
+func getImageFSStats(path string) (uint64, uint64, error) {
+	return 0, 0, errors.New("image filesystem stats are not implemented on windows")
+}
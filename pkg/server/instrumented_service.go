@@ -18,22 +18,34 @@ package server
 
 import (
 	"errors"
+	"time"
 
 	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/log"
 	"golang.org/x/net/context"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
+	"github.com/containerd/cri/pkg/annotations"
 	ctrdutil "github.com/containerd/cri/pkg/containerd/util"
+	"github.com/containerd/cri/pkg/util"
 )
 
 // instrumentedService wraps service with containerd namespace and logs.
 type instrumentedService struct {
 	c *criService
+	// auditor emits structured audit records for mutating calls. It is nil
+	// when audit logging is disabled.
+	auditor *auditor
+	// metrics tracks per-RPC latency and errors for wrapped calls.
+	metrics *criMetrics
 }
 
 func newInstrumentedService(c *criService) grpcServices {
-	return &instrumentedService{c: c}
+	in := &instrumentedService{c: c, metrics: getCRIMetrics()}
+	if c.config.EnableAudit {
+		in.auditor = newAuditor()
+	}
+	return in
 }
 
 // checkInitialized returns error if the server is not fully initialized.
@@ -47,10 +59,25 @@ func (in *instrumentedService) checkInitialized() error {
 	return errors.New("server is not initialized yet")
 }
 
+// withRequestID attaches a request id to the logger in the context, so that
+// every log line for the operation carries it. A request id is generated when
+// the caller did not provide one.
+func withRequestID(ctx context.Context, requestID string) context.Context {
+	if requestID == "" {
+		requestID = util.GenerateID()
+	}
+	return log.WithLogger(ctx, log.G(ctx).WithField("requestID", requestID))
+}
+
 func (in *instrumentedService) RunPodSandbox(ctx context.Context, r *runtime.RunPodSandboxRequest) (res *runtime.RunPodSandboxResponse, err error) {
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("RunPodSandbox", start, err) }()
+	ctx = withRequestID(ctx, r.GetConfig().GetAnnotations()[annotations.RequestID])
+	auditStart := time.Now()
+	defer func() { in.auditor.record(ctx, "RunPodSandbox", res.GetPodSandboxId(), auditStart, err) }()
 	log.G(ctx).Infof("RunPodsandbox for %+v", r.GetConfig().GetMetadata())
 	defer func() {
 		if err != nil {
@@ -67,6 +94,8 @@ func (in *instrumentedService) ListPodSandbox(ctx context.Context, r *runtime.Li
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("ListPodSandbox", start, err) }()
 	log.G(ctx).Tracef("ListPodSandbox with filter %+v", r.GetFilter())
 	defer func() {
 		if err != nil {
@@ -83,6 +112,8 @@ func (in *instrumentedService) PodSandboxStatus(ctx context.Context, r *runtime.
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("PodSandboxStatus", start, err) }()
 	log.G(ctx).Tracef("PodSandboxStatus for %q", r.GetPodSandboxId())
 	defer func() {
 		if err != nil {
@@ -99,6 +130,10 @@ func (in *instrumentedService) StopPodSandbox(ctx context.Context, r *runtime.St
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("StopPodSandbox", start, err) }()
+	auditStart := time.Now()
+	defer func() { in.auditor.record(ctx, "StopPodSandbox", r.GetPodSandboxId(), auditStart, err) }()
 	log.G(ctx).Infof("StopPodSandbox for %q", r.GetPodSandboxId())
 	defer func() {
 		if err != nil {
@@ -115,6 +150,10 @@ func (in *instrumentedService) RemovePodSandbox(ctx context.Context, r *runtime.
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("RemovePodSandbox", start, err) }()
+	auditStart := time.Now()
+	defer func() { in.auditor.record(ctx, "RemovePodSandbox", r.GetPodSandboxId(), auditStart, err) }()
 	log.G(ctx).Infof("RemovePodSandbox for %q", r.GetPodSandboxId())
 	defer func() {
 		if err != nil {
@@ -131,6 +170,8 @@ func (in *instrumentedService) PortForward(ctx context.Context, r *runtime.PortF
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("PortForward", start, err) }()
 	log.G(ctx).Infof("Portforward for %q port %v", r.GetPodSandboxId(), r.GetPort())
 	defer func() {
 		if err != nil {
@@ -147,6 +188,11 @@ func (in *instrumentedService) CreateContainer(ctx context.Context, r *runtime.C
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("CreateContainer", start, err) }()
+	ctx = withRequestID(ctx, r.GetConfig().GetAnnotations()[annotations.RequestID])
+	auditStart := time.Now()
+	defer func() { in.auditor.record(ctx, "CreateContainer", res.GetContainerId(), auditStart, err) }()
 	log.G(ctx).Infof("CreateContainer within sandbox %q for container %+v",
 		r.GetPodSandboxId(), r.GetConfig().GetMetadata())
 	defer func() {
@@ -166,6 +212,10 @@ func (in *instrumentedService) StartContainer(ctx context.Context, r *runtime.St
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("StartContainer", start, err) }()
+	auditStart := time.Now()
+	defer func() { in.auditor.record(ctx, "StartContainer", r.GetContainerId(), auditStart, err) }()
 	log.G(ctx).Infof("StartContainer for %q", r.GetContainerId())
 	defer func() {
 		if err != nil {
@@ -182,6 +232,8 @@ func (in *instrumentedService) ListContainers(ctx context.Context, r *runtime.Li
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("ListContainers", start, err) }()
 	log.G(ctx).Tracef("ListContainers with filter %+v", r.GetFilter())
 	defer func() {
 		if err != nil {
@@ -199,6 +251,8 @@ func (in *instrumentedService) ContainerStatus(ctx context.Context, r *runtime.C
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("ContainerStatus", start, err) }()
 	log.G(ctx).Tracef("ContainerStatus for %q", r.GetContainerId())
 	defer func() {
 		if err != nil {
@@ -215,6 +269,10 @@ func (in *instrumentedService) StopContainer(ctx context.Context, r *runtime.Sto
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("StopContainer", start, err) }()
+	auditStart := time.Now()
+	defer func() { in.auditor.record(ctx, "StopContainer", r.GetContainerId(), auditStart, err) }()
 	log.G(ctx).Infof("StopContainer for %q with timeout %d (s)", r.GetContainerId(), r.GetTimeout())
 	defer func() {
 		if err != nil {
@@ -231,6 +289,10 @@ func (in *instrumentedService) RemoveContainer(ctx context.Context, r *runtime.R
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("RemoveContainer", start, err) }()
+	auditStart := time.Now()
+	defer func() { in.auditor.record(ctx, "RemoveContainer", r.GetContainerId(), auditStart, err) }()
 	log.G(ctx).Infof("RemoveContainer for %q", r.GetContainerId())
 	defer func() {
 		if err != nil {
@@ -247,6 +309,8 @@ func (in *instrumentedService) ExecSync(ctx context.Context, r *runtime.ExecSync
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("ExecSync", start, err) }()
 	log.G(ctx).Infof("ExecSync for %q with command %+v and timeout %d (s)", r.GetContainerId(), r.GetCmd(), r.GetTimeout())
 	defer func() {
 		if err != nil {
@@ -265,6 +329,8 @@ func (in *instrumentedService) Exec(ctx context.Context, r *runtime.ExecRequest)
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("Exec", start, err) }()
 	log.G(ctx).Infof("Exec for %q with command %+v, tty %v and stdin %v",
 		r.GetContainerId(), r.GetCmd(), r.GetTty(), r.GetStdin())
 	defer func() {
@@ -282,6 +348,8 @@ func (in *instrumentedService) Attach(ctx context.Context, r *runtime.AttachRequ
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("Attach", start, err) }()
 	log.G(ctx).Infof("Attach for %q with tty %v and stdin %v", r.GetContainerId(), r.GetTty(), r.GetStdin())
 	defer func() {
 		if err != nil {
@@ -298,6 +366,10 @@ func (in *instrumentedService) UpdateContainerResources(ctx context.Context, r *
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("UpdateContainerResources", start, err) }()
+	auditStart := time.Now()
+	defer func() { in.auditor.record(ctx, "UpdateContainerResources", r.GetContainerId(), auditStart, err) }()
 	log.G(ctx).Infof("UpdateContainerResources for %q with %+v", r.GetContainerId(), r.GetLinux())
 	defer func() {
 		if err != nil {
@@ -314,6 +386,10 @@ func (in *instrumentedService) PullImage(ctx context.Context, r *runtime.PullIma
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("PullImage", start, err) }()
+	auditStart := time.Now()
+	defer func() { in.auditor.record(ctx, "PullImage", r.GetImage().GetImage(), auditStart, err) }()
 	log.G(ctx).Infof("PullImage %q", r.GetImage().GetImage())
 	defer func() {
 		if err != nil {
@@ -331,6 +407,8 @@ func (in *instrumentedService) ListImages(ctx context.Context, r *runtime.ListIm
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("ListImages", start, err) }()
 	log.G(ctx).Tracef("ListImages with filter %+v", r.GetFilter())
 	defer func() {
 		if err != nil {
@@ -348,6 +426,8 @@ func (in *instrumentedService) ImageStatus(ctx context.Context, r *runtime.Image
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("ImageStatus", start, err) }()
 	log.G(ctx).Tracef("ImageStatus for %q", r.GetImage().GetImage())
 	defer func() {
 		if err != nil {
@@ -365,6 +445,10 @@ func (in *instrumentedService) RemoveImage(ctx context.Context, r *runtime.Remov
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("RemoveImage", start, err) }()
+	auditStart := time.Now()
+	defer func() { in.auditor.record(ctx, "RemoveImage", r.GetImage().GetImage(), auditStart, err) }()
 	log.G(ctx).Infof("RemoveImage %q", r.GetImage().GetImage())
 	defer func() {
 		if err != nil {
@@ -381,6 +465,8 @@ func (in *instrumentedService) ImageFsInfo(ctx context.Context, r *runtime.Image
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("ImageFsInfo", start, err) }()
 	log.G(ctx).Debugf("ImageFsInfo")
 	defer func() {
 		if err != nil {
@@ -397,6 +483,8 @@ func (in *instrumentedService) ContainerStats(ctx context.Context, r *runtime.Co
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("ContainerStats", start, err) }()
 	log.G(ctx).Debugf("ContainerStats for %q", r.GetContainerId())
 	defer func() {
 		if err != nil {
@@ -413,6 +501,8 @@ func (in *instrumentedService) ListContainerStats(ctx context.Context, r *runtim
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("ListContainerStats", start, err) }()
 	log.G(ctx).Tracef("ListContainerStats with filter %+v", r.GetFilter())
 	defer func() {
 		if err != nil {
@@ -429,6 +519,8 @@ func (in *instrumentedService) Status(ctx context.Context, r *runtime.StatusRequ
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("Status", start, err) }()
 	log.G(ctx).Tracef("Status")
 	defer func() {
 		if err != nil {
@@ -445,6 +537,8 @@ func (in *instrumentedService) Version(ctx context.Context, r *runtime.VersionRe
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("Version", start, err) }()
 	log.G(ctx).Tracef("Version with client side version %q", r.GetVersion())
 	defer func() {
 		if err != nil {
@@ -461,6 +555,10 @@ func (in *instrumentedService) UpdateRuntimeConfig(ctx context.Context, r *runti
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("UpdateRuntimeConfig", start, err) }()
+	auditStart := time.Now()
+	defer func() { in.auditor.record(ctx, "UpdateRuntimeConfig", "", auditStart, err) }()
 	log.G(ctx).Debugf("UpdateRuntimeConfig with config %+v", r.GetRuntimeConfig())
 	defer func() {
 		if err != nil {
@@ -477,6 +575,8 @@ func (in *instrumentedService) ReopenContainerLog(ctx context.Context, r *runtim
 	if err := in.checkInitialized(); err != nil {
 		return nil, err
 	}
+	start := time.Now()
+	defer func() { in.metrics.observe("ReopenContainerLog", start, err) }()
 	log.G(ctx).Debugf("ReopenContainerLog for %q", r.GetContainerId())
 	defer func() {
 		if err != nil {
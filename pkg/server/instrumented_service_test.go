@@ -0,0 +1,76 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+
+	"github.com/containerd/containerd/log"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+
+	"github.com/containerd/cri/pkg/annotations"
+	"github.com/containerd/cri/pkg/atomic"
+)
+
+func TestWithRequestID(t *testing.T) {
+	t.Logf("provided request id should be attached to the logger")
+	ctx := withRequestID(context.Background(), "test-request-id")
+	assert.Equal(t, "test-request-id", log.G(ctx).Data["requestID"])
+
+	t.Logf("a request id should be generated when the caller did not provide one")
+	ctx = withRequestID(context.Background(), "")
+	assert.NotEmpty(t, log.G(ctx).Data["requestID"])
+}
+
+// captureHook captures all log entries emitted during a test.
+type captureHook struct {
+	entries []*logrus.Entry
+}
+
+func (h *captureHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h *captureHook) Fire(entry *logrus.Entry) error {
+	h.entries = append(h.entries, entry)
+	return nil
+}
+
+func TestRequestIDThroughWrappedCall(t *testing.T) {
+	c := newTestCRIService()
+	c.initialized = atomic.NewBool(true)
+	in := &instrumentedService{c: c}
+
+	hook := &captureHook{}
+	logrus.StandardLogger().AddHook(hook)
+	defer func() { logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks)) }()
+
+	_, err := in.RunPodSandbox(context.Background(), &runtime.RunPodSandboxRequest{
+		Config: &runtime.PodSandboxConfig{
+			Annotations: map[string]string{annotations.RequestID: "test-request-id"},
+		},
+	})
+	// The call fails in the fake environment, but its log lines must still
+	// carry the request id.
+	assert.Error(t, err)
+	require.NotEmpty(t, hook.entries)
+	for _, entry := range hook.entries {
+		assert.Equal(t, "test-request-id", entry.Data["requestID"])
+	}
+}
@@ -17,10 +17,12 @@
 package io
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/containerd/containerd/cio"
 	"github.com/sirupsen/logrus"
@@ -44,6 +46,10 @@ type ContainerIO struct {
 	stdoutGroup *cioutil.WriterGroup
 	stderrGroup *cioutil.WriterGroup
 
+	pool *bufferPool
+
+	combined bool
+
 	closer *wgCloser
 }
 
@@ -60,6 +66,26 @@ func WithFIFOs(fifos *cio.FIFOSet) ContainerIOOpts {
 	}
 }
 
+// WithCopyBufferSize sets the size of the pooled buffers used to copy the
+// container stdio streams. Non-positive values keep the default size.
+func WithCopyBufferSize(size int) ContainerIOOpts {
+	return func(c *ContainerIO) error {
+		c.pool = poolForSize(size)
+		return nil
+	}
+}
+
+// WithCombinedOutput multiplexes stderr into the stdout writer group,
+// producing a single combined stream. Each line is prefixed with its
+// stream name so that the origin is preserved. It has no effect for
+// terminal containers, which only have a stdout stream anyway.
+func WithCombinedOutput() ContainerIOOpts {
+	return func(c *ContainerIO) error {
+		c.combined = true
+		return nil
+	}
+}
+
 // WithNewFIFOs creates new fifos for the container io.
 func WithNewFIFOs(root string, tty, stdin bool) ContainerIOOpts {
 	return func(c *ContainerIO) error {
@@ -77,6 +103,7 @@ func NewContainerIO(id string, opts ...ContainerIOOpts) (_ *ContainerIO, err err
 		id:          id,
 		stdoutGroup: cioutil.NewWriterGroup(),
 		stderrGroup: cioutil.NewWriterGroup(),
+		pool:        poolForSize(defaultCopyBufferSize),
 	}
 	for _, opt := range opts {
 		if err := opt(c); err != nil {
@@ -105,14 +132,37 @@ func (c *ContainerIO) Config() cio.Config {
 // to output stream.
 func (c *ContainerIO) Pipe() {
 	wg := c.closer.wg
+	combined := c.combined && !c.fifos.Terminal && c.stdout != nil && c.stderr != nil
+	stdoutWriter := io.Writer(c.stdoutGroup)
+	stderrWriter := io.Writer(c.stderrGroup)
+	closeStdoutGroup := func() { c.stdoutGroup.Close() }
+	closeStderrGroup := func() { c.stderrGroup.Close() }
+	if combined {
+		stdoutWriter = newStreamLabelWriter(c.stdoutGroup, Stdout)
+		stderrWriter = newStreamLabelWriter(c.stdoutGroup, Stderr)
+		// Both pipes feed the stdout group, so only close it when the
+		// last one finishes, otherwise trailing lines of the slower
+		// stream would be dropped.
+		var pending int32 = 2
+		closeCombined := func() {
+			if atomic.AddInt32(&pending, -1) == 0 {
+				c.stdoutGroup.Close()
+			}
+		}
+		closeStdoutGroup = closeCombined
+		closeStderrGroup = func() {
+			c.stderrGroup.Close()
+			closeCombined()
+		}
+	}
 	if c.stdout != nil {
 		wg.Add(1)
 		go func() {
-			if _, err := io.Copy(c.stdoutGroup, c.stdout); err != nil {
+			if _, err := c.pool.copy(stdoutWriter, c.stdout); err != nil {
 				logrus.WithError(err).Errorf("Failed to pipe stdout of container %q", c.id)
 			}
 			c.stdout.Close()
-			c.stdoutGroup.Close()
+			closeStdoutGroup()
 			wg.Done()
 			logrus.Infof("Finish piping stdout of container %q", c.id)
 		}()
@@ -121,19 +171,65 @@ func (c *ContainerIO) Pipe() {
 	if !c.fifos.Terminal && c.stderr != nil {
 		wg.Add(1)
 		go func() {
-			if _, err := io.Copy(c.stderrGroup, c.stderr); err != nil {
+			if _, err := c.pool.copy(stderrWriter, c.stderr); err != nil {
 				logrus.WithError(err).Errorf("Failed to pipe stderr of container %q", c.id)
 			}
 			c.stderr.Close()
-			c.stderrGroup.Close()
+			closeStderrGroup()
 			wg.Done()
 			logrus.Infof("Finish piping stderr of container %q", c.id)
 		}()
 	}
 }
 
+// streamLabelWriter prefixes every line written through it with the
+// stream name, so that the origin of a line is preserved when stdout
+// and stderr are multiplexed into a single combined stream.
+type streamLabelWriter struct {
+	w       io.Writer
+	label   []byte
+	midLine bool
+}
+
+func newStreamLabelWriter(w io.Writer, stream StreamType) *streamLabelWriter {
+	return &streamLabelWriter{
+		w:     w,
+		label: []byte(string(stream) + ": "),
+	}
+}
+
+func (w *streamLabelWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		n := len(p)
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			n = i + 1
+		}
+		if !w.midLine {
+			// Write the label and the line in a single call, so that a
+			// concurrent write on the other stream can not end up in
+			// between them.
+			buf := make([]byte, 0, len(w.label)+n)
+			buf = append(buf, w.label...)
+			buf = append(buf, p[:n]...)
+			if _, err := w.w.Write(buf); err != nil {
+				return written, err
+			}
+			written += n
+		} else {
+			wn, err := w.w.Write(p[:n])
+			written += wn
+			if err != nil {
+				return written, err
+			}
+		}
+		w.midLine = p[n-1] != '\n'
+		p = p[n:]
+	}
+	return written, nil
+}
+
 // Attach attaches container stdio.
-// TODO(random-liu): Use pools.Copy in docker to reduce memory usage?
 func (c *ContainerIO) Attach(opts AttachOptions) {
 	var wg sync.WaitGroup
 	key := util.GenerateID()
@@ -147,9 +243,21 @@ func (c *ContainerIO) Attach(opts AttachOptions) {
 		// wrapper doesn't close the actual stdin, it only stops io.Copy.
 		// The actual stdin will be closed by stream server.
 		stdinStreamRC = cioutil.NewWrapReadCloser(opts.Stdin)
+		// Make sure the stdin copier terminates when the container io is
+		// cancelled (e.g. the container exits), even when no stdout or
+		// stderr stream is attached to close it.
+		stdinDone := make(chan struct{})
+		go func() {
+			select {
+			case <-c.closer.ctx.Done():
+				stdinStreamRC.Close()
+			case <-stdinDone:
+			}
+		}()
 		wg.Add(1)
 		go func() {
-			if _, err := io.Copy(c.stdin, stdinStreamRC); err != nil {
+			defer close(stdinDone)
+			if _, err := c.pool.copy(c.stdin, stdinStreamRC); err != nil {
 				logrus.WithError(err).Errorf("Failed to pipe stdin for container attach %q", c.id)
 			}
 			logrus.Infof("Attach stream %q closed", stdinKey)
@@ -216,6 +324,23 @@ func (c *ContainerIO) AddOutput(name string, stdout, stderr io.WriteCloser) (io.
 	return oldStdout, oldStderr
 }
 
+// SwapOutput atomically replaces the write closers of the container stream
+// with new ones and closes the old ones. It is used to reopen the container
+// log after external rotation; the atomic swap guarantees that every log
+// line lands in exactly one of the pre- and post-rotation files.
+func (c *ContainerIO) SwapOutput(name string, stdout, stderr io.WriteCloser) {
+	if stdout != nil {
+		if old := c.stdoutGroup.Swap(streamKey(c.id, name, Stdout), stdout); old != nil {
+			old.Close()
+		}
+	}
+	if stderr != nil {
+		if old := c.stderrGroup.Swap(streamKey(c.id, name, Stderr), stderr); old != nil {
+			old.Close()
+		}
+	}
+}
+
 // Cancel cancels container io.
 func (c *ContainerIO) Cancel() {
 	c.closer.Cancel()
@@ -0,0 +1,159 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cioutil "github.com/containerd/cri/pkg/ioutil"
+)
+
+// blockingReader blocks every Read until the reader is unblocked.
+type blockingReader struct {
+	unblock chan struct{}
+}
+
+func (b *blockingReader) Read([]byte) (int, error) {
+	<-b.unblock
+	return 0, io.EOF
+}
+
+func TestAttachStdinTerminatesOnCancel(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "container-io-attach")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	c, err := NewContainerIO("test-container", WithNewFIFOs(tmpDir, false, true))
+	require.NoError(t, err)
+	defer c.Close()
+
+	stdin := &blockingReader{unblock: make(chan struct{})}
+	defer close(stdin.unblock)
+	attachDone := make(chan struct{})
+	go func() {
+		c.Attach(AttachOptions{
+			Stdin:      stdin,
+			CloseStdin: func() error { return nil },
+		})
+		close(attachDone)
+	}()
+
+	t.Logf("attach should block while stdin delivers no data")
+	select {
+	case <-attachDone:
+		t.Fatalf("attach returned before the container io was cancelled")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	t.Logf("cancelling the container io should terminate the stdin copier")
+	c.Cancel()
+	select {
+	case <-attachDone:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("attach did not return after the container io was cancelled")
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.String()
+}
+
+func TestStreamLabelWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newStreamLabelWriter(&buf, Stderr)
+
+	t.Logf("every line should be prefixed with the stream name")
+	_, err := w.Write([]byte("line 1\nline 2\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "stderr: line 1\nstderr: line 2\n", buf.String())
+
+	t.Logf("a line split across writes should only be labeled once")
+	buf.Reset()
+	_, err = w.Write([]byte("partial"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte(" line\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "stderr: partial line\n", buf.String())
+}
+
+func TestCombinedOutputPipe(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "container-io-combined")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	c, err := NewContainerIO("test-container",
+		WithNewFIFOs(tmpDir, false, false),
+		WithCombinedOutput(),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+
+	buf := &syncBuffer{}
+	c.AddOutput("test", cioutil.NewNopWriteCloser(buf), nil)
+	c.Pipe()
+
+	stdout, err := os.OpenFile(c.fifos.Config.Stdout, os.O_WRONLY, 0)
+	require.NoError(t, err)
+	defer stdout.Close()
+	stderr, err := os.OpenFile(c.fifos.Config.Stderr, os.O_WRONLY, 0)
+	require.NoError(t, err)
+	defer stderr.Close()
+
+	waitFor := func(expected string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for buf.String() != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected combined output %q, got %q", expected, buf.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	t.Logf("stdout and stderr lines should interleave in one labeled stream")
+	_, err = stdout.Write([]byte("out 1\n"))
+	require.NoError(t, err)
+	waitFor("stdout: out 1\n")
+	_, err = stderr.Write([]byte("err 1\n"))
+	require.NoError(t, err)
+	waitFor("stdout: out 1\nstderr: err 1\n")
+	_, err = stdout.Write([]byte("out 2\n"))
+	require.NoError(t, err)
+	waitFor("stdout: out 1\nstderr: err 1\nstdout: out 2\n")
+}
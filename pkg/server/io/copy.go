@@ -0,0 +1,87 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package io
+
+import (
+	"io"
+	"sync"
+)
+
+// defaultCopyBufferSize matches the io.Copy default, so that the pooled
+// copy behaves like io.Copy unless a different size is configured.
+const defaultCopyBufferSize = 32 * 1024
+
+// bufferPool recycles copy buffers of a fixed size across streams, capping
+// the per-stream memory used by attach and output piping.
+type bufferPool struct {
+	pool *sync.Pool
+	size int
+}
+
+func newBufferPool(size int) *bufferPool {
+	if size <= 0 {
+		size = defaultCopyBufferSize
+	}
+	return &bufferPool{
+		pool: &sync.Pool{
+			New: func() interface{} {
+				b := make([]byte, size)
+				return &b
+			},
+		},
+		size: size,
+	}
+}
+
+func (p *bufferPool) get() *[]byte {
+	return p.pool.Get().(*[]byte)
+}
+
+func (p *bufferPool) put(b *[]byte) {
+	p.pool.Put(b)
+}
+
+// copy copies from src to dst using a pooled buffer, returning the buffer
+// to the pool when the copy finishes.
+func (p *bufferPool) copy(dst io.Writer, src io.Reader) (int64, error) {
+	b := p.get()
+	defer p.put(b)
+	return io.CopyBuffer(dst, src, *b)
+}
+
+// Pools are shared by all streams using the same buffer size, so that
+// buffers are reused across containers and attaches.
+var (
+	poolsMu sync.Mutex
+	pools   = map[int]*bufferPool{}
+)
+
+// poolForSize returns the shared pool for the given buffer size, creating
+// it on first use. Non-positive sizes map to the default size.
+func poolForSize(size int) *bufferPool {
+	if size <= 0 {
+		size = defaultCopyBufferSize
+	}
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	if p, ok := pools[size]; ok {
+		return p
+	}
+	p := newBufferPool(size)
+	pools[size] = p
+	return p
+}
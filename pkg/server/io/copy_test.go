@@ -0,0 +1,77 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// plainReader and plainWriter hide the WriterTo/ReaderFrom fast paths so
+// that io.CopyBuffer actually uses the pooled buffer.
+type plainReader struct{ r io.Reader }
+
+func (p plainReader) Read(b []byte) (int, error) { return p.r.Read(b) }
+
+type plainWriter struct{ w io.Writer }
+
+func (p plainWriter) Write(b []byte) (int, error) { return p.w.Write(b) }
+
+func TestPooledCopy(t *testing.T) {
+	pool := newBufferPool(8)
+	data := strings.Repeat("0123456789", 100)
+	out := new(bytes.Buffer)
+	n, err := pool.copy(plainWriter{out}, plainReader{strings.NewReader(data)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, data, out.String())
+}
+
+func TestPooledCopyBufferReuse(t *testing.T) {
+	allocated := 0
+	pool := newBufferPool(16)
+	pool.pool = &sync.Pool{
+		New: func() interface{} {
+			allocated++
+			b := make([]byte, 16)
+			return &b
+		},
+	}
+	for i := 0; i < 5; i++ {
+		out := new(bytes.Buffer)
+		_, err := pool.copy(plainWriter{out}, plainReader{strings.NewReader("stream data")})
+		require.NoError(t, err)
+		assert.Equal(t, "stream data", out.String())
+	}
+	assert.Equal(t, 1, allocated, "sequential copies should reuse one buffer")
+}
+
+func TestPoolForSize(t *testing.T) {
+	t.Logf("non-positive sizes should share the default pool")
+	assert.Equal(t, poolForSize(0), poolForSize(-1))
+	assert.Equal(t, defaultCopyBufferSize, poolForSize(0).size)
+
+	t.Logf("the same size should map to the same pool across containers")
+	assert.Equal(t, poolForSize(64*1024), poolForSize(64*1024))
+	assert.Equal(t, 64*1024, poolForSize(64*1024).size)
+}
@@ -18,7 +18,10 @@ package io
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -256,3 +259,55 @@ func TestRedirectLogs(t *testing.T) {
 		}
 	}
 }
+
+func TestLogReopenAcrossRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reopen-log")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "container.log")
+
+	openLogger := func() (io.WriteCloser, <-chan struct{}, *os.File) {
+		f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+		require.NoError(t, err)
+		wc, stop := NewCRILogger(logPath, f, Stdout, 0)
+		return wc, stop, f
+	}
+
+	group := cioutil.NewWriterGroup()
+	const key = "log"
+
+	wc1, stop1, f1 := openLogger()
+	assert.Nil(t, group.Swap(key, wc1))
+	_, err = group.Write([]byte("before rotation\n"))
+	require.NoError(t, err)
+
+	// Simulate logrotate renaming the log file away. The old logger keeps
+	// writing to the renamed file through the open fd.
+	rotatedPath := logPath + ".1"
+	require.NoError(t, os.Rename(logPath, rotatedPath))
+
+	// Reopen: create a new logger on the original path and swap it in
+	// atomically, then close the old one to flush its buffered bytes.
+	wc2, stop2, f2 := openLogger()
+	old := group.Swap(key, wc2)
+	require.NotNil(t, old)
+	old.Close()
+	<-stop1
+	f1.Close()
+
+	_, err = group.Write([]byte("after rotation\n"))
+	require.NoError(t, err)
+	group.Close()
+	<-stop2
+	f2.Close()
+
+	rotated, err := ioutil.ReadFile(rotatedPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(rotated), "before rotation")
+	assert.NotContains(t, string(rotated), "after rotation")
+
+	current, err := ioutil.ReadFile(logPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(current), "after rotation")
+	assert.NotContains(t, string(current), "before rotation")
+}
@@ -0,0 +1,88 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	metrics "github.com/docker/go-metrics"
+	"github.com/sirupsen/logrus"
+
+	"github.com/containerd/cri/pkg/constants"
+)
+
+// slowNetworkOpThreshold is the duration above which a CNI network operation
+// is logged as slow. Network setup can legitimately take seconds, e.g. when
+// IPv6 duplicate address detection is enabled, and such delays directly show
+// up as pod start latency.
+const slowNetworkOpThreshold = 5 * time.Second
+
+// criMetrics holds the per-RPC latency histograms and error counters for
+// wrapped CRI calls. The metrics are registered in the global prometheus
+// registry, so they are served by containerd's metrics HTTP endpoint.
+type criMetrics struct {
+	latency metrics.LabeledTimer
+	errors  metrics.LabeledCounter
+	// network records the latency of CNI network setup and teardown,
+	// separately from the surrounding RunPodSandbox/StopPodSandbox RPCs,
+	// to make it possible to attribute pod-start slowness to CNI.
+	network metrics.LabeledTimer
+}
+
+var (
+	criMetricsOnce     sync.Once
+	criMetricsInstance *criMetrics
+)
+
+// getCRIMetrics registers the CRI operation metrics once and returns them.
+func getCRIMetrics() *criMetrics {
+	criMetricsOnce.Do(func() {
+		ns := metrics.NewNamespace("containerd", "cri", nil)
+		criMetricsInstance = &criMetrics{
+			latency: ns.NewLabeledTimer("operation", "CRI operation latency", "operation", "namespace"),
+			errors:  ns.NewLabeledCounter("operation_errors", "CRI operation errors", "operation", "namespace"),
+			network: ns.NewLabeledTimer("network", "CNI network operation latency", "operation", "namespace"),
+		}
+		metrics.Register(ns)
+	})
+	return criMetricsInstance
+}
+
+// observe records the latency of one wrapped CRI call, and counts the error
+// when the call failed.
+func (m *criMetrics) observe(operation string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.latency.WithValues(operation, constants.K8sContainerdNamespace).UpdateSince(start)
+	if err != nil {
+		m.errors.WithValues(operation, constants.K8sContainerdNamespace).Inc(1)
+	}
+}
+
+// observeNetworkOp records the latency of one CNI network operation for the
+// given sandbox, and logs a warning when the operation is slow enough to
+// noticeably delay pod start or stop.
+func (m *criMetrics) observeNetworkOp(operation, sandboxID string, duration time.Duration) {
+	if m != nil {
+		m.network.WithValues(operation, constants.K8sContainerdNamespace).Update(duration)
+	}
+	if duration > slowNetworkOpThreshold {
+		logrus.Warnf("Slow CNI network %s for sandbox %q: took %v", operation, sandboxID, duration)
+	}
+}
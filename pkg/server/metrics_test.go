@@ -0,0 +1,147 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	cni "github.com/containerd/go-cni"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+
+	"github.com/containerd/cri/pkg/atomic"
+	servertesting "github.com/containerd/cri/pkg/server/testing"
+	sandboxstore "github.com/containerd/cri/pkg/store/sandbox"
+)
+
+// criMetricsSnapshot captures the per-operation histogram sample counts and
+// error counter values.
+type criMetricsSnapshot struct {
+	samples        map[string]uint64
+	errors         map[string]float64
+	networkSamples map[string]uint64
+	networkSum     map[string]float64
+}
+
+func snapshotCRIMetrics(t *testing.T) criMetricsSnapshot {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	s := criMetricsSnapshot{
+		samples:        make(map[string]uint64),
+		errors:         make(map[string]float64),
+		networkSamples: make(map[string]uint64),
+		networkSum:     make(map[string]float64),
+	}
+	for _, f := range families {
+		switch f.GetName() {
+		case "containerd_cri_operation_seconds":
+			for _, m := range f.GetMetric() {
+				s.samples[operationLabel(m)] = m.GetHistogram().GetSampleCount()
+			}
+		case "containerd_cri_operation_errors_total":
+			for _, m := range f.GetMetric() {
+				s.errors[operationLabel(m)] = m.GetCounter().GetValue()
+			}
+		case "containerd_cri_network_seconds":
+			for _, m := range f.GetMetric() {
+				s.networkSamples[operationLabel(m)] = m.GetHistogram().GetSampleCount()
+				s.networkSum[operationLabel(m)] = m.GetHistogram().GetSampleSum()
+			}
+		}
+	}
+	return s
+}
+
+func operationLabel(m *dto.Metric) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == "operation" {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+func TestCRIMetrics(t *testing.T) {
+	c := newTestCRIService()
+	c.initialized = atomic.NewBool(true)
+	in := &instrumentedService{c: c, metrics: getCRIMetrics()}
+	ctx := context.Background()
+
+	before := snapshotCRIMetrics(t)
+
+	_, err := in.Version(ctx, &runtime.VersionRequest{})
+	assert.NoError(t, err)
+	_, err = in.ListContainers(ctx, &runtime.ListContainersRequest{})
+	assert.NoError(t, err)
+	_, err = in.StartContainer(ctx, &runtime.StartContainerRequest{ContainerId: "does-not-exist"})
+	assert.Error(t, err)
+
+	after := snapshotCRIMetrics(t)
+
+	t.Logf("each wrapped call should observe exactly one latency sample")
+	assert.Equal(t, uint64(1), after.samples["Version"]-before.samples["Version"])
+	assert.Equal(t, uint64(1), after.samples["ListContainers"]-before.samples["ListContainers"])
+	assert.Equal(t, uint64(1), after.samples["StartContainer"]-before.samples["StartContainer"])
+
+	t.Logf("only the failed call should increment the error counter")
+	assert.Equal(t, float64(1), after.errors["StartContainer"]-before.errors["StartContainer"])
+	assert.Equal(t, float64(0), after.errors["Version"]-before.errors["Version"])
+	assert.Equal(t, float64(0), after.errors["ListContainers"]-before.errors["ListContainers"])
+}
+
+func TestCRINetworkMetrics(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	c := newTestCRIService()
+	plugin := servertesting.NewFakeCNIPlugin()
+	plugin.SetupDelay = delay
+	plugin.SetupResult = &cni.CNIResult{
+		Interfaces: map[string]*cni.Config{
+			defaultIfName: {
+				IPConfigs: []*cni.IPConfig{{IP: net.ParseIP("10.0.0.5")}},
+			},
+		},
+	}
+	c.netPlugin = plugin
+	sandbox := sandboxstore.Sandbox{
+		Metadata: sandboxstore.Metadata{
+			ID: "test-sandbox-id",
+			Config: &runtime.PodSandboxConfig{
+				Metadata: &runtime.PodSandboxMetadata{
+					Name:      "test-name",
+					Uid:       "test-uid",
+					Namespace: "test-ns",
+				},
+			},
+		},
+	}
+
+	before := snapshotCRIMetrics(t)
+	require.NoError(t, c.setupPodNetwork(context.Background(), &sandbox))
+	after := snapshotCRIMetrics(t)
+
+	t.Logf("network setup should observe exactly one latency sample")
+	assert.Equal(t, uint64(1), after.networkSamples["setup"]-before.networkSamples["setup"])
+
+	t.Logf("the observed latency should reflect the artificial CNI delay")
+	assert.True(t, after.networkSum["setup"]-before.networkSum["setup"] >= delay.Seconds())
+}
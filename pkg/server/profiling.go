@@ -0,0 +1,72 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// profilingListener creates the listener for the profiling server. A
+// configured unix socket path takes precedence over the TCP address, so
+// that the pprof endpoints are not exposed on shared-node networks.
+func profilingListener(address, socketPath string) (net.Listener, error) {
+	if socketPath != "" {
+		// Remove a stale socket left over from a previous run.
+		if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "failed to remove stale profiling socket %q", socketPath)
+		}
+		return net.Listen("unix", socketPath)
+	}
+	return net.Listen("tcp", address)
+}
+
+// profilingMux returns the http handler serving the pprof endpoints.
+func profilingMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// startProfilingServer serves the pprof profiling endpoints when profiling
+// is enabled in the config. It is best effort, failures do not stop the
+// CRI service.
+func (c *criService) startProfilingServer() error {
+	if !c.config.EnableProfiling {
+		return nil
+	}
+	l, err := profilingListener(c.config.ProfilingAddress, c.config.ProfilingSocketPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to listen for profiling server")
+	}
+	logrus.Infof("Start profiling server on %s://%s", l.Addr().Network(), l.Addr().String())
+	go func() {
+		if err := http.Serve(l, profilingMux()); err != nil {
+			logrus.WithError(err).Error("Failed to serve profiling server")
+		}
+	}()
+	return nil
+}
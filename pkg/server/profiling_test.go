@@ -0,0 +1,106 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestProfilingListener(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "profiling-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	socket := filepath.Join(tmpDir, "pprof.sock")
+
+	t.Logf("a configured socket path should take precedence over the TCP address")
+	l, err := profilingListener("127.0.0.1:0", socket)
+	require.NoError(t, err)
+	defer l.Close()
+	assert.Equal(t, "unix", l.Addr().Network())
+	assert.Equal(t, socket, l.Addr().String())
+	_, err = os.Stat(socket)
+	assert.NoError(t, err)
+
+	t.Logf("a stale socket should be replaced")
+	l.Close()
+	require.NoError(t, ioutil.WriteFile(socket, []byte{}, 0600))
+	l, err = profilingListener("", socket)
+	require.NoError(t, err)
+	defer l.Close()
+	assert.Equal(t, "unix", l.Addr().Network())
+
+	t.Logf("without a socket path a TCP listener should be created")
+	l2, err := profilingListener("127.0.0.1:0", "")
+	require.NoError(t, err)
+	defer l2.Close()
+	assert.Equal(t, "tcp", l2.Addr().Network())
+}
+
+func TestProfilingServerOnSocket(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "profiling-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	socket := filepath.Join(tmpDir, "pprof.sock")
+
+	c := newTestCRIService()
+
+	t.Logf("the server should not start when profiling is disabled")
+	require.NoError(t, c.startProfilingServer())
+	_, err = os.Stat(socket)
+	assert.True(t, os.IsNotExist(err))
+
+	t.Logf("the pprof index should be served over the socket")
+	c.config.EnableProfiling = true
+	c.config.ProfilingSocketPath = socket
+	require.NoError(t, c.startProfilingServer())
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	resp, err := client.Get("http://profiling/debug/pprof/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestProfilingMux(t *testing.T) {
+	server := httptest.NewServer(profilingMux())
+	defer server.Close()
+	for _, path := range []string{
+		"/debug/pprof/",
+		"/debug/pprof/cmdline",
+		"/debug/pprof/symbol",
+	} {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "path %q", path)
+	}
+}
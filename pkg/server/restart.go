@@ -34,6 +34,7 @@ import (
 	"golang.org/x/net/context"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
+	"github.com/containerd/cri/pkg/annotations"
 	ctrdutil "github.com/containerd/cri/pkg/containerd/util"
 	"github.com/containerd/cri/pkg/netns"
 	cio "github.com/containerd/cri/pkg/server/io"
@@ -57,10 +58,12 @@ func (c *criService) recover(ctx context.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "failed to list sandbox containers")
 	}
+	var orphanedSandboxes []containerd.Container
 	for _, sandbox := range sandboxes {
 		sb, err := c.loadSandbox(ctx, sandbox)
 		if err != nil {
 			log.G(ctx).WithError(err).Errorf("Failed to load sandbox %q", sandbox.ID())
+			orphanedSandboxes = append(orphanedSandboxes, sandbox)
 			continue
 		}
 		log.G(ctx).Debugf("Loaded sandbox %+v", sb)
@@ -71,6 +74,16 @@ func (c *criService) recover(ctx context.Context) error {
 			return errors.Wrapf(err, "failed to reserve sandbox name %q", sb.Name)
 		}
 	}
+	// A sandbox container that failed to load may still have a running pause
+	// task. Kill and delete such tasks, so that at most one live pause task
+	// exists for each recovered sandbox id.
+	cleanupOrphanedSandboxTasks(ctx, orphanedSandboxes)
+
+	if c.config.CleanupLeakedNetNSOnStart {
+		if err := c.cleanupLeakedNetNS(ctx); err != nil {
+			log.G(ctx).WithError(err).Error("Failed to cleanup leaked netns")
+		}
+	}
 
 	// Recover all containers.
 	containers, err := c.client.Containers(ctx, filterLabel(containerKindLabel, containerKindContainer))
@@ -198,9 +211,14 @@ func (c *criService) loadContainer(ctx context.Context, cntr containerd.Containe
 					}
 				}
 			}()
-			containerIO, err = cio.NewContainerIO(id,
+			ioOpts := []cio.ContainerIOOpts{
 				cio.WithFIFOs(fifos),
-			)
+				cio.WithCopyBufferSize(c.config.StreamCopyBufferSize),
+			}
+			if meta.Config.GetAnnotations()[annotations.CombinedOutput] == "true" {
+				ioOpts = append(ioOpts, cio.WithCombinedOutput())
+			}
+			containerIO, err = cio.NewContainerIO(id, ioOpts...)
 			if err != nil {
 				return nil, err
 			}
@@ -235,9 +253,14 @@ func (c *criService) loadContainer(ctx context.Context, cntr containerd.Containe
 				// NOTE: Another possibility is that we've tried to start the container, but
 				// containerd got restarted during that. In that case, we still
 				// treat the container as `CREATED`.
-				containerIO, err = cio.NewContainerIO(id,
+				ioOpts := []cio.ContainerIOOpts{
 					cio.WithNewFIFOs(volatileContainerDir, meta.Config.GetTty(), meta.Config.GetStdin()),
-				)
+					cio.WithCopyBufferSize(c.config.StreamCopyBufferSize),
+				}
+				if meta.Config.GetAnnotations()[annotations.CombinedOutput] == "true" {
+					ioOpts = append(ioOpts, cio.WithCombinedOutput())
+				}
+				containerIO, err = cio.NewContainerIO(id, ioOpts...)
 				if err != nil {
 					return errors.Wrap(err, "failed to create container io")
 				}
@@ -414,6 +437,14 @@ func (c *criService) loadSandbox(ctx context.Context, cntr containerd.Container)
 		// Don't need to load netns for host network sandbox.
 		return sandbox, nil
 	}
+	if meta.Config.GetAnnotations()[annotations.SandboxNetNSPath] != "" {
+		// The sandbox uses a pre-created netns which is not owned by cri.
+		sandbox.NetNS, err = netns.LoadExternalNetNS(meta.NetNSPath)
+		if err != nil {
+			log.G(ctx).WithError(err).Errorf("Failed to load external network namespace for sandbox %q", cntr.ID())
+		}
+		return sandbox, nil
+	}
 	sandbox.NetNS = netns.LoadNetNS(meta.NetNSPath)
 
 	// It doesn't matter whether task is running or not. If it is running, sandbox
@@ -453,6 +484,26 @@ func (c *criService) loadImages(ctx context.Context, cImages []containerd.Image)
 	}
 }
 
+// cleanupOrphanedSandboxTasks kills and deletes pause tasks of sandbox
+// containers which were not recovered into the sandbox store. Cleanup is
+// best effort, a failure only generates a warning.
+func cleanupOrphanedSandboxTasks(ctx context.Context, cntrs []containerd.Container) {
+	for _, cntr := range cntrs {
+		t, err := cntr.Task(ctx, nil)
+		if err != nil {
+			if !errdefs.IsNotFound(err) {
+				log.G(ctx).WithError(err).Warnf("Failed to load orphaned pause task for sandbox %q", cntr.ID())
+			}
+			continue
+		}
+		if _, err := t.Delete(ctx, containerd.WithProcessKill); err != nil && !errdefs.IsNotFound(err) {
+			log.G(ctx).WithError(err).Warnf("Failed to delete orphaned pause task for sandbox %q", cntr.ID())
+			continue
+		}
+		log.G(ctx).Debugf("Deleted orphaned pause task for sandbox %q", cntr.ID())
+	}
+}
+
 func cleanupOrphanedIDDirs(ctx context.Context, cntrs []containerd.Container, base string) error {
 	// Cleanup orphaned id directories.
 	dirs, err := ioutil.ReadDir(base)
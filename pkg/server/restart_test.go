@@ -0,0 +1,72 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd"
+	containerdio "github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// fakeSandboxTask is a minimal containerd.Task implementation which only
+// records whether it has been deleted.
+type fakeSandboxTask struct {
+	containerd.Task
+	deleted bool
+}
+
+func (f *fakeSandboxTask) Delete(ctx context.Context, opts ...containerd.ProcessDeleteOpts) (*containerd.ExitStatus, error) {
+	f.deleted = true
+	return containerd.NewExitStatus(0, time.Time{}, nil), nil
+}
+
+// fakeSandboxContainer is a minimal containerd.Container implementation
+// which only supports loading its task.
+type fakeSandboxContainer struct {
+	containerd.Container
+	id   string
+	task *fakeSandboxTask
+}
+
+func (f *fakeSandboxContainer) ID() string {
+	return f.id
+}
+
+func (f *fakeSandboxContainer) Task(ctx context.Context, attach containerdio.Attach) (containerd.Task, error) {
+	if f.task == nil {
+		return nil, errors.Wrapf(errdefs.ErrNotFound, "no running task found")
+	}
+	return f.task, nil
+}
+
+func TestCleanupOrphanedSandboxTasks(t *testing.T) {
+	taskToClean := &fakeSandboxTask{}
+	cntrs := []containerd.Container{
+		// Orphaned pause task should be deleted.
+		&fakeSandboxContainer{id: "sandbox-with-task", task: taskToClean},
+		// Sandbox container without task should be tolerated.
+		&fakeSandboxContainer{id: "sandbox-without-task"},
+	}
+	cleanupOrphanedSandboxTasks(context.Background(), cntrs)
+	assert.True(t, taskToClean.deleted, "orphaned pause task should be deleted")
+}
@@ -17,6 +17,7 @@
 package server
 
 import (
+	"github.com/containerd/containerd"
 	"golang.org/x/net/context"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
@@ -29,10 +30,19 @@ func (c *criService) ListPodSandbox(ctx context.Context, r *runtime.ListPodSandb
 	sandboxesInStore := c.sandboxStore.List()
 	var sandboxes []*runtime.PodSandbox
 	for _, sandboxInStore := range sandboxesInStore {
-		sandboxes = append(sandboxes, toCRISandbox(
+		sandbox := toCRISandbox(
 			sandboxInStore.Metadata,
 			sandboxInStore.Status.Get(),
-		))
+		)
+		// A sandbox in the middle of stop/remove can briefly keep a ready
+		// state in the store. Check the live task and report NOTREADY when
+		// it is gone or no longer running, so that kubelet does not
+		// reconcile against stale state.
+		if sandbox.State == runtime.PodSandboxState_SANDBOX_READY &&
+			!c.sandboxTaskRunning(ctx, sandboxInStore) {
+			sandbox.State = runtime.PodSandboxState_SANDBOX_NOTREADY
+		}
+		sandboxes = append(sandboxes, sandbox)
 	}
 
 	sandboxes = c.filterCRISandboxes(sandboxes, r.GetFilter())
@@ -57,6 +67,24 @@ func toCRISandbox(meta sandboxstore.Metadata, status sandboxstore.Status) *runti
 	}
 }
 
+// sandboxTaskRunning returns whether the sandbox task is still running.
+// When there is no sandbox container to inspect, the store state is
+// trusted as is.
+func (c *criService) sandboxTaskRunning(ctx context.Context, sandbox sandboxstore.Sandbox) bool {
+	if sandbox.Container == nil {
+		return true
+	}
+	task, err := sandbox.Container.Task(ctx, nil)
+	if err != nil {
+		return false
+	}
+	s, err := task.Status(ctx)
+	if err != nil {
+		return false
+	}
+	return s.Status == containerd.Running
+}
+
 func (c *criService) normalizePodSandboxFilter(filter *runtime.PodSandboxFilter) {
 	if sb, err := c.sandboxStore.Get(filter.GetId()); err == nil {
 		filter.Id = sb.ID
@@ -81,18 +109,9 @@ func (c *criService) filterCRISandboxes(sandboxes []*runtime.PodSandbox, filter
 			continue
 		}
 		// Filter by label
-		if filter.GetLabelSelector() != nil {
-			match := true
-			for k, v := range filter.GetLabelSelector() {
-				got, ok := s.Labels[k]
-				if !ok || got != v {
-					match = false
-					break
-				}
-			}
-			if !match {
-				continue
-			}
+		if filter.GetLabelSelector() != nil &&
+			!matchLabelSelector(filter.GetLabelSelector(), s.Labels) {
+			continue
 		}
 		filtered = append(filtered, s)
 	}
@@ -20,7 +20,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/containerd/containerd"
+	containerdio "github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/errdefs"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
 	sandboxstore "github.com/containerd/cri/pkg/store/sandbox"
@@ -184,6 +189,12 @@ func TestFilterSandboxes(t *testing.T) {
 			},
 			expect: []*runtime.PodSandbox{testSandboxes[1]},
 		},
+		"label filter with multiple labels requires all to match": {
+			filter: &runtime.PodSandboxFilter{
+				LabelSelector: map[string]string{"a": "b", "x": "y"},
+			},
+			expect: []*runtime.PodSandbox{},
+		},
 		"mixed filter not matched": {
 			filter: &runtime.PodSandboxFilter{
 				Id:            "1",
@@ -206,3 +217,40 @@ func TestFilterSandboxes(t *testing.T) {
 		assert.Equal(t, test.expect, filtered, desc)
 	}
 }
+
+// fakeTasklessSandboxContainer is a sandbox container whose task is gone.
+type fakeTasklessSandboxContainer struct {
+	containerd.Container
+}
+
+func (f fakeTasklessSandboxContainer) Task(context.Context, containerdio.Attach) (containerd.Task, error) {
+	return nil, errdefs.ErrNotFound
+}
+
+func TestListPodSandboxStaleReadyState(t *testing.T) {
+	c := newTestCRIService()
+
+	live := sandboxstore.NewSandbox(
+		sandboxstore.Metadata{ID: "live", Name: "live"},
+		sandboxstore.Status{State: sandboxstore.StateReady},
+	)
+	stale := sandboxstore.NewSandbox(
+		sandboxstore.Metadata{ID: "stale", Name: "stale"},
+		sandboxstore.Status{State: sandboxstore.StateReady},
+	)
+	// The stale sandbox is mid-teardown, its task is already gone.
+	stale.Container = fakeTasklessSandboxContainer{}
+	require.NoError(t, c.sandboxStore.Add(live))
+	require.NoError(t, c.sandboxStore.Add(stale))
+
+	resp, err := c.ListPodSandbox(context.Background(), &runtime.ListPodSandboxRequest{})
+	require.NoError(t, err)
+	states := map[string]runtime.PodSandboxState{}
+	for _, s := range resp.GetItems() {
+		states[s.Id] = s.State
+	}
+	t.Logf("a sandbox without a container to inspect keeps the store state")
+	assert.Equal(t, runtime.PodSandboxState_SANDBOX_READY, states["live"])
+	t.Logf("a sandbox whose task is gone should list as NOTREADY")
+	assert.Equal(t, runtime.PodSandboxState_SANDBOX_NOTREADY, states["stale"])
+}
@@ -18,9 +18,12 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"math"
 	goruntime "runtime"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/containerd/containerd"
 	containerdio "github.com/containerd/containerd/cio"
@@ -53,6 +56,13 @@ func init() {
 // RunPodSandbox creates and starts a pod-level sandbox. Runtimes should ensure
 // the sandbox is in ready state.
 func (c *criService) RunPodSandbox(ctx context.Context, r *runtime.RunPodSandboxRequest) (_ *runtime.RunPodSandboxResponse, retErr error) {
+	defer c.trackOperation()()
+	if c.draining.IsSet() {
+		return nil, errors.Wrap(errdefs.ErrUnavailable, "server is draining, not accepting new sandboxes")
+	}
+	if err := c.checkSandboxLimit(); err != nil {
+		return nil, err
+	}
 	config := r.GetConfig()
 	log.G(ctx).Debugf("Sandbox config %+v", config)
 
@@ -117,10 +127,29 @@ func (c *criService) RunPodSandbox(ctx context.Context, r *runtime.RunPodSandbox
 		// handle. NetNSPath in sandbox metadata and NetNS is non empty only for non host network
 		// namespaces. If the pod is in host network namespace then both are empty and should not
 		// be used.
-		sandbox.NetNS, err = netns.NewNetNS()
-		if err != nil {
-			return nil, errors.Wrapf(err, "failed to create network namespace for sandbox %q", id)
+		if nsPath := config.GetAnnotations()[annotations.SandboxNetNSPath]; nsPath != "" {
+			// Reuse a pre-created network namespace instead of creating
+			// and owning a new one.
+			sandbox.NetNS, err = netns.LoadExternalNetNS(nsPath)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to use pre-created network namespace for sandbox %q", id)
+			}
+		} else {
+			sandbox.NetNS, err = c.sandboxNetNS(id)
+			if err != nil {
+				return nil, err
+			}
 		}
+		if sandbox.NetNS == nil {
+			// Netns creation is not permitted and host network fallback is
+			// enabled. Switch the sandbox to host networking so that spec
+			// generation, sandbox files and status reporting all treat it
+			// the same as a sandbox requested with host network.
+			hostNetworkFallback(config)
+			podNetwork = false
+		}
+	}
+	if podNetwork {
 		sandbox.NetNSPath = sandbox.NetNS.GetPath()
 		defer func() {
 			if retErr != nil {
@@ -186,7 +215,7 @@ func (c *criService) RunPodSandbox(ctx context.Context, r *runtime.RunPodSandbox
 		return nil, errors.Wrap(err, "failed to generate runtime options")
 	}
 	opts := []containerd.NewContainerOpts{
-		containerd.WithSnapshotter(c.config.ContainerdConfig.Snapshotter),
+		containerd.WithSnapshotter(c.runtimeSnapshotter(ociRuntime)),
 		customopts.WithNewSnapshot(id, containerdImage),
 		containerd.WithSpec(spec, specOpts...),
 		containerd.WithContainerLabels(sandboxLabels),
@@ -314,6 +343,44 @@ func (c *criService) RunPodSandbox(ctx context.Context, r *runtime.RunPodSandbox
 	return &runtime.RunPodSandboxResponse{PodSandboxId: id}, nil
 }
 
+// newNetNS is swappable to test netns creation failure handling.
+var newNetNS = netns.NewNetNS
+
+// sandboxNetNS creates a network namespace for the sandbox. When netns
+// creation is not permitted in the current environment, it falls back to
+// host networking if FallbackToHostNetwork is enabled, or returns a clear
+// actionable error otherwise. A nil netns indicates that host networking
+// should be used.
+func (c *criService) sandboxNetNS(id string) (*netns.NetNS, error) {
+	ns, err := newNetNS()
+	if err == nil {
+		return ns, nil
+	}
+	if c.config.FallbackToHostNetwork {
+		logrus.WithError(err).Warnf("Failed to create network namespace for sandbox %q, falling back to host network", id)
+		return nil, nil
+	}
+	return nil, errors.Wrapf(err, "failed to create network namespace for sandbox %q "+
+		"(netns creation may not be permitted in this environment, set `fallback_to_host_network` to use host networking instead)", id)
+}
+
+// hostNetworkFallback updates the sandbox config to use host networking,
+// so that the sandbox container spec does not join a network or UTS
+// namespace, and sandbox files and status reporting follow the host
+// network code path.
+func hostNetworkFallback(config *runtime.PodSandboxConfig) {
+	if config.Linux == nil {
+		config.Linux = &runtime.LinuxPodSandboxConfig{}
+	}
+	if config.Linux.SecurityContext == nil {
+		config.Linux.SecurityContext = &runtime.LinuxSandboxSecurityContext{}
+	}
+	if config.Linux.SecurityContext.NamespaceOptions == nil {
+		config.Linux.SecurityContext.NamespaceOptions = &runtime.NamespaceOption{}
+	}
+	config.Linux.SecurityContext.NamespaceOptions.Network = runtime.NamespaceMode_NODE
+}
+
 // setupPodNetwork setups up the network for a pod
 func (c *criService) setupPodNetwork(ctx context.Context, sandbox *sandboxstore.Sandbox) error {
 	var (
@@ -330,7 +397,9 @@ func (c *criService) setupPodNetwork(ctx context.Context, sandbox *sandboxstore.
 		return errors.Wrap(err, "get cni namespace options")
 	}
 
+	netStart := time.Now()
 	result, err := c.netPlugin.Setup(ctx, id, path, opts...)
+	getCRIMetrics().observeNetworkOp("setup", id, time.Since(netStart))
 	if err != nil {
 		return err
 	}
@@ -338,6 +407,9 @@ func (c *criService) setupPodNetwork(ctx context.Context, sandbox *sandboxstore.
 	// Check if the default interface has IP config
 	if configs, ok := result.Interfaces[defaultIfName]; ok && len(configs.IPConfigs) > 0 {
 		sandbox.IP, sandbox.AdditionalIPs = selectPodIPs(configs.IPConfigs)
+		// Multi-interface (multus-style) pods carry IPs on additional
+		// interfaces, report them as additional pod IPs as well.
+		sandbox.AdditionalIPs = append(sandbox.AdditionalIPs, additionalInterfaceIPs(result, defaultIfName)...)
 		sandbox.CNIResult = result
 		return nil
 	}
@@ -438,6 +510,50 @@ func toCNIDNS(dns *runtime.DNSConfig) *cni.DNS {
 	}
 }
 
+// parseDNSOptions parse DNS options into resolv.conf format content,
+// if none option is specified, will return empty with no error.
+func parseDNSOptions(servers, searches, options []string) (string, error) {
+	resolvContent := ""
+
+	if len(searches) > maxDNSSearches {
+		return "", errors.Errorf("DNSOption.Searches has more than %d domains", maxDNSSearches)
+	}
+
+	if len(searches) > 0 {
+		resolvContent += fmt.Sprintf("search %s\n", strings.Join(searches, " "))
+	}
+
+	if len(servers) > 0 {
+		resolvContent += fmt.Sprintf("nameserver %s\n", strings.Join(servers, "\nnameserver "))
+	}
+
+	if len(options) > 0 {
+		resolvContent += fmt.Sprintf("options %s\n", strings.Join(options, " "))
+	}
+
+	return resolvContent, nil
+}
+
+// additionalInterfaceIPs collects the IPs of all non-default, non-loopback
+// interfaces in the CNI result, sorted by interface name for stable output.
+func additionalInterfaceIPs(result *cni.CNIResult, defaultIf string) []string {
+	var names []string
+	for name := range result.Interfaces {
+		if name == defaultIf || name == "lo" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var ips []string
+	for _, name := range names {
+		for _, ipConfig := range result.Interfaces[name].IPConfigs {
+			ips = append(ips, ipConfig.IP.String())
+		}
+	}
+	return ips
+}
+
 // selectPodIPs select an ip from the ip list. It prefers ipv4 more than ipv6
 // and returns the additional ips
 // TODO(random-liu): Revisit the ip order in the ipv6 beta stage. (cri#1278)
@@ -489,19 +605,21 @@ func (c *criService) getSandboxRuntime(config *runtime.PodSandboxConfig, runtime
 	if untrustedWorkload(config) {
 		// If the untrusted annotation is provided, runtimeHandler MUST be empty.
 		if runtimeHandler != "" && runtimeHandler != criconfig.RuntimeUntrusted {
-			return criconfig.Runtime{}, errors.New("untrusted workload with explicit runtime handler is not allowed")
+			return criconfig.Runtime{}, errors.Errorf("untrusted workload with explicit runtime handler %q is not allowed, configured runtime handlers: %q", runtimeHandler, c.configuredRuntimeNames())
 		}
 
 		//  If the untrusted workload is requesting access to the host/node, this request will fail.
-		//
-		//  Note: If the workload is marked untrusted but requests privileged, this can be granted, as the
-		// runtime may support this.  For example, in a virtual-machine isolated runtime, privileged
-		// is a supported option, granting the workload to access the entire guest VM instead of host.
 		// TODO(windows): Deprecate this so that we don't need to handle it for windows.
 		if hostAccessingSandbox(config) {
 			return criconfig.Runtime{}, errors.New("untrusted workload with host access is not allowed")
 		}
 
+		// Privileged mode grants full host access, which defeats the
+		// isolation the untrusted runtime is supposed to provide.
+		if config.GetLinux().GetSecurityContext().GetPrivileged() {
+			return criconfig.Runtime{}, errors.New("untrusted workload with privileged mode is not allowed")
+		}
+
 		runtimeHandler = criconfig.RuntimeUntrusted
 	}
 
@@ -511,11 +629,23 @@ func (c *criService) getSandboxRuntime(config *runtime.PodSandboxConfig, runtime
 
 	handler, ok := c.config.ContainerdConfig.Runtimes[runtimeHandler]
 	if !ok {
-		return criconfig.Runtime{}, errors.Errorf("no runtime for %q is configured", runtimeHandler)
+		return criconfig.Runtime{}, errors.Errorf("no runtime for %q is configured, configured runtime handlers: %q, default runtime handler: %q",
+			runtimeHandler, c.configuredRuntimeNames(), c.config.ContainerdConfig.DefaultRuntimeName)
 	}
 	return handler, nil
 }
 
+// configuredRuntimeNames returns the sorted names of all configured runtime
+// handlers.
+func (c *criService) configuredRuntimeNames() []string {
+	names := make([]string, 0, len(c.config.ContainerdConfig.Runtimes))
+	for name := range c.config.ContainerdConfig.Runtimes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func logDebugCNIResult(ctx context.Context, sandboxID string, result *cni.CNIResult) {
 	if logrus.GetLevel() < logrus.DebugLevel {
 		return
@@ -17,6 +17,7 @@
 package server
 
 import (
+	"math"
 	"net"
 	"testing"
 
@@ -24,11 +25,14 @@ import (
 	"github.com/containerd/typeurl"
 	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
 	runtimespec "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
 	"github.com/containerd/cri/pkg/annotations"
 	criconfig "github.com/containerd/cri/pkg/config"
+	"github.com/containerd/cri/pkg/netns"
 	sandboxstore "github.com/containerd/cri/pkg/store/sandbox"
 )
 
@@ -41,13 +45,15 @@ func TestSandboxContainerSpec(t *testing.T) {
 		imageConfigChange func(*imagespec.ImageConfig)
 		specCheck         func(*testing.T, *runtimespec.Spec)
 		expectErr         bool
+		errContains       string
 	}{
-		"should return error when entrypoint and cmd are empty": {
+		"should return error naming the sandbox image when entrypoint and cmd are empty": {
 			imageConfigChange: func(c *imagespec.ImageConfig) {
 				c.Entrypoint = nil
 				c.Cmd = nil
 			},
-			expectErr: true,
+			expectErr:   true,
+			errContains: testSandboxImage,
 		},
 		"a passthrough annotation should be passed as an OCI annotation": {
 			podAnnotations: []string{"c"},
@@ -100,6 +106,9 @@ func TestSandboxContainerSpec(t *testing.T) {
 			test.podAnnotations)
 		if test.expectErr {
 			assert.Error(t, err)
+			if test.errContains != "" {
+				assert.Contains(t, err.Error(), test.errContains)
+			}
 			assert.Nil(t, spec)
 			continue
 		}
@@ -112,6 +121,47 @@ func TestSandboxContainerSpec(t *testing.T) {
 	}
 }
 
+func TestSandboxNetNSCreationFailure(t *testing.T) {
+	oldNewNetNS := newNetNS
+	defer func() {
+		newNetNS = oldNewNetNS
+	}()
+	newNetNS = func() (*netns.NetNS, error) {
+		return nil, errors.New("operation not permitted")
+	}
+
+	t.Logf("netns creation failure should return a clear error by default")
+	c := newTestCRIService()
+	ns, err := c.sandboxNetNS("test-id")
+	assert.Nil(t, ns)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "fallback_to_host_network")
+
+	t.Logf("netns creation failure should fall back to host network when enabled")
+	c = newTestCRIService()
+	c.config.FallbackToHostNetwork = true
+	ns, err = c.sandboxNetNS("test-id")
+	assert.Nil(t, ns)
+	assert.NoError(t, err)
+
+	t.Logf("fallback should generate a sandbox spec without a network namespace")
+	config, imageConfig, _ := getRunPodSandboxTestData()
+	hostNetworkFallback(config)
+	assert.Equal(t, runtime.NamespaceMode_NODE,
+		config.GetLinux().GetSecurityContext().GetNamespaceOptions().GetNetwork())
+	spec, err := c.sandboxContainerSpec("test-id", config, imageConfig, "", nil)
+	require.NoError(t, err)
+	require.NotNil(t, spec)
+	if spec.Linux != nil {
+		assert.NotContains(t, spec.Linux.Namespaces, runtimespec.LinuxNamespace{
+			Type: runtimespec.NetworkNamespace,
+		})
+		assert.NotContains(t, spec.Linux.Namespaces, runtimespec.LinuxNamespace{
+			Type: runtimespec.UTSNamespace,
+		})
+	}
+}
+
 func TestTypeurlMarshalUnmarshalSandboxMeta(t *testing.T) {
 	for desc, test := range map[string]struct {
 		configChange func(*runtime.PodSandboxConfig)
@@ -290,6 +340,73 @@ func TestSelectPodIP(t *testing.T) {
 	}
 }
 
+func TestAdditionalInterfaceIPs(t *testing.T) {
+	result := &cni.CNIResult{
+		Interfaces: map[string]*cni.Config{
+			"eth0": {
+				IPConfigs: []*cni.IPConfig{{IP: net.ParseIP("192.168.17.43")}},
+			},
+			"net1": {
+				IPConfigs: []*cni.IPConfig{{IP: net.ParseIP("10.10.0.5")}},
+			},
+			"net2": {
+				IPConfigs: []*cni.IPConfig{
+					{IP: net.ParseIP("10.20.0.5")},
+					{IP: net.ParseIP("2001:db8:85a3::8a2e:370:7334")},
+				},
+			},
+			"lo": {
+				IPConfigs: []*cni.IPConfig{{IP: net.ParseIP("127.0.0.1")}},
+			},
+		},
+	}
+	ips := additionalInterfaceIPs(result, "eth0")
+	assert.Equal(t, []string{"10.10.0.5", "10.20.0.5", "2001:db8:85a3::8a2e:370:7334"}, ips,
+		"all IPs of non-default, non-loopback interfaces should be reported in order")
+}
+
+func TestToCNIBandWidth(t *testing.T) {
+	t.Logf("no bandwidth annotations should produce no capability args")
+	bandWidth, err := toCNIBandWidth(map[string]string{})
+	require.NoError(t, err)
+	assert.Nil(t, bandWidth)
+
+	t.Logf("bandwidth annotations should be translated into capability args")
+	bandWidth, err = toCNIBandWidth(map[string]string{
+		"kubernetes.io/ingress-bandwidth": "10M",
+		"kubernetes.io/egress-bandwidth":  "20M",
+	})
+	require.NoError(t, err)
+	require.NotNil(t, bandWidth)
+	assert.Equal(t, uint64(10000000), bandWidth.IngressRate)
+	assert.Equal(t, uint64(math.MaxUint32), bandWidth.IngressBurst)
+	assert.Equal(t, uint64(20000000), bandWidth.EgressRate)
+	assert.Equal(t, uint64(math.MaxUint32), bandWidth.EgressBurst)
+
+	t.Logf("invalid bandwidth quantities should error")
+	_, err = toCNIBandWidth(map[string]string{
+		"kubernetes.io/ingress-bandwidth": "not-a-quantity",
+	})
+	assert.Error(t, err)
+}
+
+func TestCNINamespaceOptsBandWidth(t *testing.T) {
+	config := &runtime.PodSandboxConfig{
+		Metadata: &runtime.PodSandboxMetadata{
+			Name:      "test-name",
+			Uid:       "test-uid",
+			Namespace: "test-ns",
+		},
+		Annotations: map[string]string{
+			"kubernetes.io/ingress-bandwidth": "10M",
+		},
+	}
+	opts, err := cniNamespaceOpts("test-id", config)
+	require.NoError(t, err)
+	// Labels plus the bandwidth capability arg.
+	assert.Len(t, opts, 2)
+}
+
 func TestHostAccessingSandbox(t *testing.T) {
 	privilegedContext := &runtime.PodSandboxConfig{
 		Linux: &runtime.LinuxPodSandboxConfig{
@@ -356,11 +473,12 @@ func TestGetSandboxRuntime(t *testing.T) {
 	}
 
 	for desc, test := range map[string]struct {
-		sandboxConfig   *runtime.PodSandboxConfig
-		runtimeHandler  string
-		runtimes        map[string]criconfig.Runtime
-		expectErr       bool
-		expectedRuntime criconfig.Runtime
+		sandboxConfig     *runtime.PodSandboxConfig
+		runtimeHandler    string
+		runtimes          map[string]criconfig.Runtime
+		expectErr         bool
+		expectErrContains []string
+		expectedRuntime   criconfig.Runtime
 	}{
 		"should return error if untrusted workload requires host access": {
 			sandboxConfig: &runtime.PodSandboxConfig{
@@ -384,6 +502,24 @@ func TestGetSandboxRuntime(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		"should return error if untrusted workload requests privileged mode": {
+			sandboxConfig: &runtime.PodSandboxConfig{
+				Linux: &runtime.LinuxPodSandboxConfig{
+					SecurityContext: &runtime.LinuxSandboxSecurityContext{
+						Privileged: true,
+					},
+				},
+				Annotations: map[string]string{
+					annotations.UntrustedWorkload: "true",
+				},
+			},
+			runtimes: map[string]criconfig.Runtime{
+				criconfig.RuntimeDefault:   defaultRuntime,
+				criconfig.RuntimeUntrusted: untrustedWorkloadRuntime,
+			},
+			expectErr:         true,
+			expectErrContains: []string{"privileged"},
+		},
 		"should use untrusted workload runtime for untrusted workload": {
 			sandboxConfig: &runtime.PodSandboxConfig{
 				Annotations: map[string]string{
@@ -463,7 +599,8 @@ func TestGetSandboxRuntime(t *testing.T) {
 				criconfig.RuntimeUntrusted: untrustedWorkloadRuntime,
 				"foo":                      fooRuntime,
 			},
-			expectErr: true,
+			expectErr:         true,
+			expectErrContains: []string{criconfig.RuntimeDefault, criconfig.RuntimeUntrusted, "foo"},
 		},
 		"should use correct runtime for a runtime handler": {
 			sandboxConfig:  &runtime.PodSandboxConfig{},
@@ -482,7 +619,8 @@ func TestGetSandboxRuntime(t *testing.T) {
 				criconfig.RuntimeDefault: defaultRuntime,
 				"foo":                    fooRuntime,
 			},
-			expectErr: true,
+			expectErr:         true,
+			expectErrContains: []string{criconfig.RuntimeDefault, "foo"},
 		},
 	} {
 		t.Run(desc, func(t *testing.T) {
@@ -494,7 +632,53 @@ func TestGetSandboxRuntime(t *testing.T) {
 			cri.config.ContainerdConfig.Runtimes = test.runtimes
 			r, err := cri.getSandboxRuntime(test.sandboxConfig, test.runtimeHandler)
 			assert.Equal(t, test.expectErr, err != nil)
+			for _, name := range test.expectErrContains {
+				assert.Contains(t, err.Error(), name)
+			}
 			assert.Equal(t, test.expectedRuntime, r)
 		})
 	}
 }
+
+func TestParseDNSOption(t *testing.T) {
+	for desc, test := range map[string]struct {
+		servers         []string
+		searches        []string
+		options         []string
+		expectedContent string
+		expectErr       bool
+	}{
+		"empty dns options should return empty content": {},
+		"non-empty dns options should return correct content": {
+			servers:  []string{"8.8.8.8", "server.google.com"},
+			searches: []string{"114.114.114.114"},
+			options:  []string{"timeout:1"},
+			expectedContent: `search 114.114.114.114
+nameserver 8.8.8.8
+nameserver server.google.com
+options timeout:1
+`,
+		},
+		"should return error if dns search exceeds limit(6)": {
+			searches: []string{
+				"server0.google.com",
+				"server1.google.com",
+				"server2.google.com",
+				"server3.google.com",
+				"server4.google.com",
+				"server5.google.com",
+				"server6.google.com",
+			},
+			expectErr: true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		resolvContent, err := parseDNSOptions(test.servers, test.searches, test.options)
+		if test.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, resolvContent, test.expectedContent)
+	}
+}
@@ -21,7 +21,6 @@ package server
 import (
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/oci"
@@ -42,8 +41,15 @@ func (c *criService) sandboxContainerSpec(id string, config *runtime.PodSandboxC
 	imageConfig *imagespec.ImageConfig, nsPath string, runtimePodAnnotations []string) (_ *runtimespec.Spec, retErr error) {
 	// Creates a spec Generator with the default spec.
 	// TODO(random-liu): [P1] Compare the default settings with docker and containerd default.
+	// By default the /run mount is removed from the spec. When configured,
+	// mount a tmpfs with copy-up instead, for images expecting a writable
+	// /run.
+	runMountOpt := oci.SpecOpts(customopts.WithoutRunMount)
+	if c.config.EnableRunTmpfs {
+		runMountOpt = customopts.WithRunTmpfs(c.config.RunTmpfsSize)
+	}
 	specOpts := []oci.SpecOpts{
-		customopts.WithoutRunMount,
+		runMountOpt,
 		customopts.WithoutDefaultSecuritySettings,
 		customopts.WithRelativeRoot(relativeRootfsPath),
 		oci.WithEnv(imageConfig.Env),
@@ -56,7 +62,7 @@ func (c *criService) sandboxContainerSpec(id string, config *runtime.PodSandboxC
 
 	if len(imageConfig.Entrypoint) == 0 && len(imageConfig.Cmd) == 0 {
 		// Pause image must have entrypoint or cmd.
-		return nil, errors.Errorf("invalid empty entrypoint and cmd in image config %+v", imageConfig)
+		return nil, errors.Errorf("invalid empty entrypoint and cmd in image config of sandbox image %q, not a valid pause image", c.config.SandboxImage)
 	}
 	specOpts = append(specOpts, oci.WithProcessArgs(append(imageConfig.Entrypoint, imageConfig.Cmd...)...))
 
@@ -65,7 +71,7 @@ func (c *criService) sandboxContainerSpec(id string, config *runtime.PodSandboxC
 		specOpts = append(specOpts, customopts.WithDisabledCgroups)
 	} else {
 		if config.GetLinux().GetCgroupParent() != "" {
-			cgroupsPath := getCgroupsPath(config.GetLinux().GetCgroupParent(), id)
+			cgroupsPath := getCgroupsPath(config.GetLinux().GetCgroupParent(), id, c.config.SystemdCgroup)
 			specOpts = append(specOpts, oci.WithCgroup(cgroupsPath))
 		}
 	}
@@ -260,30 +266,6 @@ func (c *criService) setupSandboxFiles(id string, config *runtime.PodSandboxConf
 	return nil
 }
 
-// parseDNSOptions parse DNS options into resolv.conf format content,
-// if none option is specified, will return empty with no error.
-func parseDNSOptions(servers, searches, options []string) (string, error) {
-	resolvContent := ""
-
-	if len(searches) > maxDNSSearches {
-		return "", errors.Errorf("DNSOption.Searches has more than %d domains", maxDNSSearches)
-	}
-
-	if len(searches) > 0 {
-		resolvContent += fmt.Sprintf("search %s\n", strings.Join(searches, " "))
-	}
-
-	if len(servers) > 0 {
-		resolvContent += fmt.Sprintf("nameserver %s\n", strings.Join(servers, "\nnameserver "))
-	}
-
-	if len(options) > 0 {
-		resolvContent += fmt.Sprintf("options %s\n", strings.Join(options, " "))
-	}
-
-	return resolvContent, nil
-}
-
 // cleanupSandboxFiles unmount some sandbox files, we rely on the removal of sandbox root directory to
 // remove these files. Unmount should *NOT* return error if the mount point is already unmounted.
 func (c *criService) cleanupSandboxFiles(id string, config *runtime.PodSandboxConfig) error {
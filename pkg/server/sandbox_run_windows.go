@@ -43,7 +43,7 @@ func (c *criService) sandboxContainerSpec(id string, config *runtime.PodSandboxC
 
 	if len(imageConfig.Entrypoint) == 0 && len(imageConfig.Cmd) == 0 {
 		// Pause image must have entrypoint or cmd.
-		return nil, errors.Errorf("invalid empty entrypoint and cmd in image config %+v", imageConfig)
+		return nil, errors.Errorf("invalid empty entrypoint and cmd in image config of sandbox image %q, not a valid pause image", c.config.SandboxImage)
 	}
 	specOpts = append(specOpts, oci.WithProcessArgs(append(imageConfig.Entrypoint, imageConfig.Cmd...)...))
 
@@ -75,12 +75,48 @@ func (c *criService) sandboxContainerSpecOpts(config *runtime.PodSandboxConfig,
 	return nil, nil
 }
 
-// No sandbox files needed for windows.
+// setupSandboxFiles sets up necessary sandbox files including hostname, hosts
+// and resolv.conf in the sandbox root directory. On windows the host files
+// live under %SystemRoot%\System32\drivers\etc, and there is no host
+// resolv.conf, so DNS configuration is only materialized when the sandbox
+// config carries one.
 func (c *criService) setupSandboxFiles(id string, config *runtime.PodSandboxConfig) error {
+	sandboxEtcHostname := c.getSandboxHostname(id)
+	hostname := config.GetHostname()
+	if hostname == "" {
+		var err error
+		hostname, err = c.os.Hostname()
+		if err != nil {
+			return errors.Wrap(err, "failed to get hostname")
+		}
+	}
+	if err := c.os.WriteFile(sandboxEtcHostname, []byte(hostname+"\n"), 0644); err != nil {
+		return errors.Wrapf(err, "failed to write hostname to %q", sandboxEtcHostname)
+	}
+
+	sandboxEtcHosts := c.getSandboxHosts(id)
+	if err := c.os.CopyFile(hostEtcHosts(), sandboxEtcHosts, 0644); err != nil {
+		return errors.Wrapf(err, "failed to generate sandbox hosts file %q", sandboxEtcHosts)
+	}
+
+	// Set DNS options. The same search domain limit as on linux applies.
+	if dnsConfig := config.GetDnsConfig(); dnsConfig != nil {
+		resolvContent, err := parseDNSOptions(dnsConfig.Servers, dnsConfig.Searches, dnsConfig.Options)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse sandbox DNSConfig %+v", dnsConfig)
+		}
+		resolvPath := c.getResolvPath(id)
+		if err := c.os.WriteFile(resolvPath, []byte(resolvContent), 0644); err != nil {
+			return errors.Wrapf(err, "failed to write resolv content to %q", resolvPath)
+		}
+	}
+
 	return nil
 }
 
-// No sandbox files needed for windows.
+// cleanupSandboxFiles does nothing on windows, nothing is mounted for the
+// sandbox files, so we rely on the removal of the sandbox root directory to
+// clean up the generated files.
 func (c *criService) cleanupSandboxFiles(id string, config *runtime.PodSandboxConfig) error {
 	return nil
 }
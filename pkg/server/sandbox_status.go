@@ -19,6 +19,7 @@ package server
 import (
 	"encoding/json"
 	goruntime "runtime"
+	"sort"
 
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/errdefs"
@@ -134,12 +135,44 @@ type SandboxInfo struct {
 	// Note: a new field `RuntimeHandler` has been added into the CRI PodSandboxStatus struct, and
 	// should be set. This `RuntimeHandler` field will be deprecated after containerd 1.3 (tracked
 	// in https://github.com/containerd/cri/issues/1064).
-	RuntimeHandler string                    `json:"runtimeHandler"` // see the Note above
-	RuntimeType    string                    `json:"runtimeType"`
-	RuntimeOptions interface{}               `json:"runtimeOptions"`
-	Config         *runtime.PodSandboxConfig `json:"config"`
-	RuntimeSpec    *runtimespec.Spec         `json:"runtimeSpec"`
-	CNIResult      *cni.CNIResult            `json:"cniResult"`
+	RuntimeHandler    string                    `json:"runtimeHandler"` // see the Note above
+	RuntimeType       string                    `json:"runtimeType"`
+	RuntimeOptions    interface{}               `json:"runtimeOptions"`
+	Config            *runtime.PodSandboxConfig `json:"config"`
+	RuntimeSpec       *runtimespec.Spec         `json:"runtimeSpec"`
+	CNIResult         *cni.CNIResult            `json:"cniResult"`
+	NetworkInterfaces []*NetworkInterface       `json:"networkInterfaces,omitempty"`
+}
+
+// NetworkInterface is the network interface information of a sandbox parsed
+// from the CNI result.
+type NetworkInterface struct {
+	Name string   `json:"name"`
+	Mac  string   `json:"mac,omitempty"`
+	IPs  []string `json:"ips,omitempty"`
+}
+
+// toNetworkInterfaces parses network interface details out of the CNI result.
+// Interfaces are sorted by name to make the output deterministic.
+func toNetworkInterfaces(result *cni.CNIResult) []*NetworkInterface {
+	if result == nil {
+		return nil
+	}
+	var interfaces []*NetworkInterface
+	for name, conf := range result.Interfaces {
+		i := &NetworkInterface{
+			Name: name,
+			Mac:  conf.Mac,
+		}
+		for _, ipConf := range conf.IPConfigs {
+			i.IPs = append(i.IPs, ipConf.IP.String())
+		}
+		interfaces = append(interfaces, i)
+	}
+	sort.Slice(interfaces, func(i, j int) bool {
+		return interfaces[i].Name < interfaces[j].Name
+	})
+	return interfaces
 }
 
 // toCRISandboxInfo converts internal container object information to CRI sandbox status response info map.
@@ -161,11 +194,12 @@ func toCRISandboxInfo(ctx context.Context, sandbox sandboxstore.Sandbox) (map[st
 	}
 
 	si := &SandboxInfo{
-		Pid:            sandbox.Status.Get().Pid,
-		RuntimeHandler: sandbox.RuntimeHandler,
-		Status:         string(processStatus),
-		Config:         sandbox.Config,
-		CNIResult:      sandbox.CNIResult,
+		Pid:               sandbox.Status.Get().Pid,
+		RuntimeHandler:    sandbox.RuntimeHandler,
+		Status:            string(processStatus),
+		Config:            sandbox.Config,
+		CNIResult:         sandbox.CNIResult,
+		NetworkInterfaces: toNetworkInterfaces(sandbox.CNIResult),
 	}
 
 	if si.Status == "" {
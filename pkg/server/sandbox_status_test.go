@@ -17,9 +17,11 @@
 package server
 
 import (
+	"net"
 	"testing"
 	"time"
 
+	cni "github.com/containerd/go-cni"
 	"github.com/stretchr/testify/assert"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
@@ -114,3 +116,45 @@ func TestPodSandboxStatus(t *testing.T) {
 		assert.Equal(t, expected, got)
 	}
 }
+
+func TestToNetworkInterfaces(t *testing.T) {
+	for desc, test := range map[string]struct {
+		result   *cni.CNIResult
+		expected []*NetworkInterface
+	}{
+		"nil result should return nil": {
+			result:   nil,
+			expected: nil,
+		},
+		"interfaces should be converted and sorted by name": {
+			result: &cni.CNIResult{
+				Interfaces: map[string]*cni.Config{
+					"veth0": {
+						Mac: "aa:bb:cc:dd:ee:01",
+					},
+					"eth0": {
+						IPConfigs: []*cni.IPConfig{
+							{IP: net.ParseIP("10.10.10.10")},
+							{IP: net.ParseIP("2001:db8:85a3::8a2e:370:7334")},
+						},
+						Mac: "aa:bb:cc:dd:ee:ff",
+					},
+				},
+			},
+			expected: []*NetworkInterface{
+				{
+					Name: "eth0",
+					Mac:  "aa:bb:cc:dd:ee:ff",
+					IPs:  []string{"10.10.10.10", "2001:db8:85a3::8a2e:370:7334"},
+				},
+				{
+					Name: "veth0",
+					Mac:  "aa:bb:cc:dd:ee:01",
+				},
+			},
+		},
+	} {
+		t.Logf("TestCase: %s", desc)
+		assert.Equal(t, test.expected, toNetworkInterfaces(test.result))
+	}
+}
@@ -17,6 +17,8 @@
 package server
 
 import (
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -34,6 +36,7 @@ import (
 // StopPodSandbox stops the sandbox. If there are any running containers in the
 // sandbox, they should be forcibly terminated.
 func (c *criService) StopPodSandbox(ctx context.Context, r *runtime.StopPodSandboxRequest) (*runtime.StopPodSandboxResponse, error) {
+	defer c.trackOperation()()
 	sandbox, err := c.sandboxStore.Get(r.GetPodSandboxId())
 	if err != nil {
 		return nil, errors.Wrapf(err, "an error occurred when try to find sandbox %q",
@@ -87,10 +90,18 @@ func (c *criService) stopPodSandbox(ctx context.Context, sandbox sandboxstore.Sa
 		} else if closed {
 			sandbox.NetNSPath = ""
 		}
-		if err := c.teardownPodNetwork(ctx, sandbox); err != nil {
+		timedOut, err := c.teardownPodNetworkWithTimeout(ctx, sandbox, c.networkTeardownTimeout())
+		if err != nil {
 			return errors.Wrapf(err, "failed to destroy network for sandbox %q", id)
 		}
-		if err := sandbox.NetNS.Remove(); err != nil {
+		if timedOut {
+			// Proceed to mark the sandbox stopped instead of blocking
+			// StopPodSandbox forever on a stuck CNI plugin, so that the
+			// sandbox can still be removed. The network namespace and CNI
+			// resources are leaked until garbage collected externally.
+			log.G(ctx).Errorf("Network teardown for sandbox %q did not finish within %v, leaking network namespace %q and CNI result %+v",
+				id, c.networkTeardownTimeout(), sandbox.NetNSPath, sandbox.CNIResult)
+		} else if err := removeNetNSWithRetry(ctx, id, sandbox.NetNS.Remove); err != nil {
 			return errors.Wrapf(err, "failed to remove network namespace for sandbox %q", id)
 		}
 	}
@@ -100,6 +111,84 @@ func (c *criService) stopPodSandbox(ctx context.Context, sandbox sandboxstore.Sa
 	return nil
 }
 
+// stopTrackedSandboxes stops every sandbox that is still ready or in unknown
+// state using the given stop function. Failures are logged and do not abort
+// stopping the remaining sandboxes; this is a best effort cleanup used when
+// the service shuts down with stop_sandboxes_on_shutdown enabled.
+func stopTrackedSandboxes(ctx context.Context, sandboxes []sandboxstore.Sandbox,
+	stop func(context.Context, sandboxstore.Sandbox) error) {
+	for _, sandbox := range sandboxes {
+		state := sandbox.Status.Get().State
+		if state != sandboxstore.StateReady && state != sandboxstore.StateUnknown {
+			continue
+		}
+		if err := stop(ctx, sandbox); err != nil {
+			log.G(ctx).WithError(err).Errorf("Failed to stop sandbox %q during shutdown", sandbox.ID)
+		}
+	}
+}
+
+// stopAllWorkers is the number of sandboxes stopped concurrently by
+// StopAllSandboxes.
+const stopAllWorkers = 8
+
+// StopAllSandboxes stops all tracked sandboxes concurrently with a bounded
+// worker pool and the given overall timeout. It reuses the single sandbox
+// stop logic, including its network teardown timeout. It is exposed so that
+// a debug endpoint can speed up node shutdown. Failures are logged per
+// sandbox and summarized in the returned error.
+func (c *criService) StopAllSandboxes(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctrdutil.NamespacedContext(), timeout)
+	defer cancel()
+	failed := stopSandboxesConcurrently(ctx, c.sandboxStore.List(), stopAllWorkers, c.stopPodSandbox)
+	if failed != 0 {
+		return errors.Errorf("failed to stop %d sandboxes", failed)
+	}
+	return nil
+}
+
+// stopSandboxesConcurrently stops every ready or unknown sandbox using the
+// given stop function and a pool of the given number of workers. It returns
+// the number of sandboxes which failed to stop, including the ones not
+// dispatched before the context was done.
+func stopSandboxesConcurrently(ctx context.Context, sandboxes []sandboxstore.Sandbox, workers int,
+	stop func(context.Context, sandboxstore.Sandbox) error) int {
+	if workers <= 0 {
+		workers = 1
+	}
+	var (
+		wg     sync.WaitGroup
+		failed int32
+		queue  = make(chan sandboxstore.Sandbox)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sandbox := range queue {
+				if err := stop(ctx, sandbox); err != nil {
+					log.G(ctx).WithError(err).Errorf("Failed to stop sandbox %q", sandbox.ID)
+					atomic.AddInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+	for _, sandbox := range sandboxes {
+		state := sandbox.Status.Get().State
+		if state != sandboxstore.StateReady && state != sandboxstore.StateUnknown {
+			continue
+		}
+		select {
+		case queue <- sandbox:
+		case <-ctx.Done():
+			atomic.AddInt32(&failed, 1)
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return int(failed)
+}
+
 // stopSandboxContainer kills the sandbox container.
 // `task.Delete` is not called here because it will be called when
 // the event monitor handles the `TaskExit` event.
@@ -163,6 +252,67 @@ func (c *criService) waitSandboxStop(ctx context.Context, sandbox sandboxstore.S
 	}
 }
 
+const (
+	// netNSRemoveAttempts is the number of attempts to remove the sandbox
+	// network namespace before giving up.
+	netNSRemoveAttempts = 3
+	// netNSRemoveBackoff is the initial interval between netns removal attempts.
+	// The interval is doubled after each failed attempt.
+	netNSRemoveBackoff = 100 * time.Millisecond
+)
+
+// removeNetNSWithRetry removes the sandbox network namespace with a bounded
+// retry. Removal can transiently fail if something still holds the namespace,
+// e.g. a process which has not released it yet.
+func removeNetNSWithRetry(ctx context.Context, id string, remove func() error) error {
+	var err error
+	backoff := netNSRemoveBackoff
+	for i := 0; i < netNSRemoveAttempts; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = remove(); err == nil {
+			return nil
+		}
+		log.G(ctx).WithError(err).Warnf("Failed to remove network namespace for sandbox %q, attempt %d/%d",
+			id, i+1, netNSRemoveAttempts)
+	}
+	return err
+}
+
+// networkTeardownTimeout returns the configured maximum time to wait for
+// network teardown during StopPodSandbox, or zero when teardown should be
+// waited for without a timeout.
+func (c *criService) networkTeardownTimeout() time.Duration {
+	if c.config.NetworkTeardownTimeout == "" {
+		return 0
+	}
+	// Invalid durations are rejected by config validation.
+	timeout, _ := time.ParseDuration(c.config.NetworkTeardownTimeout)
+	return timeout
+}
+
+// teardownPodNetworkWithTimeout tears down the pod network, giving up after
+// the given timeout. It returns whether teardown timed out. A timed out
+// teardown keeps running in the background, but the sandbox is force-stopped
+// regardless of its outcome.
+func (c *criService) teardownPodNetworkWithTimeout(ctx context.Context, sandbox sandboxstore.Sandbox, timeout time.Duration) (bool, error) {
+	if timeout <= 0 {
+		return false, c.teardownPodNetwork(ctx, sandbox)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.teardownPodNetwork(ctx, sandbox)
+	}()
+	select {
+	case err := <-errCh:
+		return false, err
+	case <-time.After(timeout):
+		return true, nil
+	}
+}
+
 // teardownPodNetwork removes the network from the pod
 func (c *criService) teardownPodNetwork(ctx context.Context, sandbox sandboxstore.Sandbox) error {
 	if c.netPlugin == nil {
@@ -179,7 +329,10 @@ func (c *criService) teardownPodNetwork(ctx context.Context, sandbox sandboxstor
 		return errors.Wrap(err, "get cni namespace options")
 	}
 
-	return c.netPlugin.Remove(ctx, id, path, opts...)
+	netStart := time.Now()
+	err = c.netPlugin.Remove(ctx, id, path, opts...)
+	getCRIMetrics().observeNetworkOp("teardown", id, time.Since(netStart))
+	return err
 }
 
 // cleanupUnknownSandbox cleanup stopped sandbox in unknown state.
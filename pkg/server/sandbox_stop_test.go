@@ -17,12 +17,17 @@
 package server
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/context"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
+	servertesting "github.com/containerd/cri/pkg/server/testing"
 	sandboxstore "github.com/containerd/cri/pkg/store/sandbox"
 )
 
@@ -71,3 +76,162 @@ func TestWaitSandboxStop(t *testing.T) {
 		assert.Equal(t, test.expectErr, err != nil, desc)
 	}
 }
+
+func TestStopTrackedSandboxes(t *testing.T) {
+	sandboxes := []sandboxstore.Sandbox{
+		sandboxstore.NewSandbox(
+			sandboxstore.Metadata{ID: "ready-sandbox"},
+			sandboxstore.Status{State: sandboxstore.StateReady},
+		),
+		sandboxstore.NewSandbox(
+			sandboxstore.Metadata{ID: "stopped-sandbox"},
+			sandboxstore.Status{State: sandboxstore.StateNotReady},
+		),
+		sandboxstore.NewSandbox(
+			sandboxstore.Metadata{ID: "unknown-sandbox"},
+			sandboxstore.Status{State: sandboxstore.StateUnknown},
+		),
+	}
+	var stopped []string
+	stop := func(_ context.Context, sandbox sandboxstore.Sandbox) error {
+		stopped = append(stopped, sandbox.ID)
+		if sandbox.ID == "ready-sandbox" {
+			// A stop failure must not abort stopping the remaining sandboxes.
+			return errors.New("stop failure")
+		}
+		return nil
+	}
+	stopTrackedSandboxes(context.Background(), sandboxes, stop)
+	assert.Equal(t, []string{"ready-sandbox", "unknown-sandbox"}, stopped,
+		"only ready and unknown sandboxes should be stopped")
+}
+
+func TestRemoveNetNSWithRetry(t *testing.T) {
+	removeErr := errors.New("netns still in use")
+	for desc, test := range map[string]struct {
+		failures      int
+		expectedCalls int
+		expectErr     bool
+	}{
+		"should succeed immediately if removal succeeds": {
+			failures:      0,
+			expectedCalls: 1,
+		},
+		"should retry if removal fails once then succeeds": {
+			failures:      1,
+			expectedCalls: 2,
+		},
+		"should return error if removal keeps failing": {
+			failures:      netNSRemoveAttempts,
+			expectedCalls: netNSRemoveAttempts,
+			expectErr:     true,
+		},
+	} {
+		t.Logf("TestCase %q", desc)
+		var calls int
+		remove := func() error {
+			calls++
+			if calls <= test.failures {
+				return removeErr
+			}
+			return nil
+		}
+		err := removeNetNSWithRetry(context.Background(), "test-id", remove)
+		assert.Equal(t, test.expectedCalls, calls)
+		if test.expectErr {
+			assert.Equal(t, removeErr, err)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestTeardownPodNetworkWithTimeout(t *testing.T) {
+	sandbox := sandboxstore.NewSandbox(
+		sandboxstore.Metadata{
+			ID: "test-id",
+			Config: &runtime.PodSandboxConfig{
+				Metadata: &runtime.PodSandboxMetadata{
+					Name:      "test-name",
+					Uid:       "test-uid",
+					Namespace: "test-ns",
+				},
+			},
+		},
+		sandboxstore.Status{State: sandboxstore.StateReady},
+	)
+
+	t.Logf("a responsive CNI plugin should tear down within the timeout")
+	c := newTestCRIService()
+	timedOut, err := c.teardownPodNetworkWithTimeout(context.Background(), sandbox, time.Second)
+	assert.NoError(t, err)
+	assert.False(t, timedOut)
+
+	t.Logf("a hanging CNI plugin should time out instead of blocking the stop")
+	c = newTestCRIService()
+	c.netPlugin.(*servertesting.FakeCNIPlugin).RemoveDelay = time.Hour
+	start := time.Now()
+	timedOut, err = c.teardownPodNetworkWithTimeout(context.Background(), sandbox, 100*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, timedOut)
+	assert.True(t, time.Since(start) < 10*time.Second)
+
+	t.Logf("a zero timeout should wait for teardown to finish")
+	c = newTestCRIService()
+	timedOut, err = c.teardownPodNetworkWithTimeout(context.Background(), sandbox, 0)
+	assert.NoError(t, err)
+	assert.False(t, timedOut)
+}
+
+func TestStopSandboxesConcurrently(t *testing.T) {
+	newSandboxes := func(n int) []sandboxstore.Sandbox {
+		var sandboxes []sandboxstore.Sandbox
+		for i := 0; i < n; i++ {
+			sandboxes = append(sandboxes, sandboxstore.NewSandbox(
+				sandboxstore.Metadata{ID: fmt.Sprintf("sandbox-%d", i)},
+				sandboxstore.Status{State: sandboxstore.StateReady},
+			))
+		}
+		return sandboxes
+	}
+
+	t.Logf("all sandboxes should be stopped, several at a time")
+	var (
+		mu            sync.Mutex
+		stopped       []string
+		inflight      int
+		maxConcurrent int
+	)
+	stop := func(_ context.Context, sandbox sandboxstore.Sandbox) error {
+		mu.Lock()
+		inflight++
+		if inflight > maxConcurrent {
+			maxConcurrent = inflight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inflight--
+		stopped = append(stopped, sandbox.ID)
+		mu.Unlock()
+		return nil
+	}
+	start := time.Now()
+	failed := stopSandboxesConcurrently(context.Background(), newSandboxes(8), 4, stop)
+	assert.Zero(t, failed)
+	assert.Len(t, stopped, 8)
+	assert.True(t, maxConcurrent > 1, "sandboxes should be stopped concurrently")
+	assert.True(t, time.Since(start) < 8*20*time.Millisecond, "concurrent stop should be faster than sequential")
+
+	t.Logf("a stuck stop should not block past the deadline")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	hang := func(ctx context.Context, _ sandboxstore.Sandbox) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	start = time.Now()
+	failed = stopSandboxesConcurrently(ctx, newSandboxes(4), 2, hang)
+	assert.Equal(t, 4, failed)
+	assert.True(t, time.Since(start) < 10*time.Second)
+}
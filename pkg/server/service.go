@@ -23,15 +23,18 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/oci"
 	"github.com/containerd/containerd/plugin"
+	"github.com/containerd/containerd/snapshots"
 	"github.com/containerd/cri/pkg/streaming"
 	cni "github.com/containerd/go-cni"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
@@ -61,6 +64,16 @@ type CRIService interface {
 	io.Closer
 	plugin.Service
 	grpcServices
+	// SetDrain toggles drain mode. It is exposed so that a debug endpoint
+	// can put the server into drain mode for node maintenance.
+	SetDrain(drain bool)
+	// StopAllSandboxes stops all tracked sandboxes concurrently. It is
+	// exposed so that a debug endpoint can speed up node shutdown.
+	StopAllSandboxes(timeout time.Duration) error
+	// DryRunContainerSpec returns the OCI spec a `CreateContainer` request
+	// would produce, serialized as JSON, without creating the container.
+	// It is exposed so that a debug endpoint can inspect generated specs.
+	DryRunContainerSpec(ctx context.Context, r *runtime.CreateContainerRequest) ([]byte, error)
 }
 
 // criService implements CRIService.
@@ -85,6 +98,26 @@ type criService struct {
 	imageStore *imagestore.Store
 	// snapshotStore stores information of all snapshots.
 	snapshotStore *snapshotstore.Store
+	// snapshotService is the snapshot service of the configured snapshotter,
+	// used to verify container snapshots still exist before starting tasks.
+	snapshotService snapshots.Snapshotter
+	// getContainerdImage fetches a containerd image by reference. It goes
+	// through the containerd client and is overridden in unit tests.
+	getContainerdImage func(ctx context.Context, ref string) (containerd.Image, error)
+	// createContainerdContainer creates the backing containerd container.
+	// It goes through the containerd client and is overridden in unit tests
+	// to inject creation failures.
+	createContainerdContainer func(ctx context.Context, id string, opts ...containerd.NewContainerOpts) (containerd.Container, error)
+	// getImageFSStats returns the free bytes and free inodes of the
+	// filesystem at the given path. It is overridden in unit tests.
+	getImageFSStats func(path string) (uint64, uint64, error)
+	// pullContainerdImage pulls an image through the containerd client.
+	// It is overridden in unit tests.
+	pullContainerdImage func(ctx context.Context, ref string, opts ...containerd.RemoteOpt) (containerd.Image, error)
+	// loadApparmorProfile loads an apparmor profile of the given name from
+	// the configured profiles directory into the kernel. When nil, the
+	// default file backed loader is used. It is overridden in unit tests.
+	loadApparmorProfile func(profile string) error
 	// netPlugin is used to setup and teardown network when run/stop pod sandbox.
 	netPlugin cni.CNI
 	// client is an instance of the containerd client
@@ -96,6 +129,22 @@ type criService struct {
 	// initialized indicates whether the server is initialized. All GRPC services
 	// should return error before the server is initialized.
 	initialized atomic.Bool
+	// draining indicates whether the server is in drain mode. In drain mode
+	// creation of new sandboxes and containers is rejected, while all other
+	// operations proceed, so that running pods can finish before node
+	// maintenance.
+	draining atomic.Bool
+	// inflightOperations tracks in-flight create/stop/remove operations,
+	// so that shutdown can wait for them to finish.
+	inflightOperations sync.WaitGroup
+	// loadSem bounds concurrent image load operations, so that they do
+	// not contend on the content store.
+	loadSem chan struct{}
+	// initErrMu protects initErr.
+	initErrMu sync.Mutex
+	// initErr is the last initialization error, kept so that Status can
+	// report why the service is unavailable instead of silently failing.
+	initErr error
 	// cniNetConfMonitor is used to reload cni network conf if there is
 	// any valid fs change events from cni network conf dir.
 	cniNetConfMonitor *cniNetConfSyncer
@@ -118,12 +167,20 @@ func NewCRIService(config criconfig.Config, client *containerd.Client) (CRIServi
 		sandboxNameIndex:   registrar.NewRegistrar(),
 		containerNameIndex: registrar.NewRegistrar(),
 		initialized:        atomic.NewBool(false),
+		draining:           atomic.NewBool(false),
+		loadSem:            make(chan struct{}, maxConcurrentLoads(config.MaxConcurrentLoads)),
 	}
 
-	if client.SnapshotService(c.config.ContainerdConfig.Snapshotter) == nil {
+	c.snapshotService = client.SnapshotService(c.config.ContainerdConfig.Snapshotter)
+	if c.snapshotService == nil {
 		return nil, errors.Errorf("failed to find snapshotter %q", c.config.ContainerdConfig.Snapshotter)
 	}
 
+	c.getContainerdImage = client.GetImage
+	c.createContainerdContainer = client.NewContainer
+	c.getImageFSStats = getImageFSStats
+	c.pullContainerdImage = client.Pull
+
 	c.imageFSPath = imageFSPath(config.ContainerdRootDir, config.ContainerdConfig.Snapshotter)
 	logrus.Infof("Get image filesystem path %q", c.imageFSPath)
 
@@ -153,6 +210,18 @@ func NewCRIService(config criconfig.Config, client *containerd.Client) (CRIServi
 	return c, nil
 }
 
+// SetDrain toggles drain mode. While draining, RunPodSandbox and
+// CreateContainer return an unavailable error, all other operations proceed.
+func (c *criService) SetDrain(drain bool) {
+	if drain {
+		logrus.Info("Drain mode enabled, not accepting new sandboxes or containers")
+		c.draining.Set()
+		return
+	}
+	logrus.Info("Drain mode disabled")
+	c.draining.Unset()
+}
+
 // Register registers all required services onto a specific grpc server.
 // This is used by containerd cri plugin.
 func (c *criService) Register(s *grpc.Server) error {
@@ -175,7 +244,9 @@ func (c *criService) Run() error {
 
 	logrus.Infof("Start recovering state")
 	if err := c.recover(ctrdutil.NamespacedContext()); err != nil {
-		return errors.Wrap(err, "failed to recover state")
+		err = errors.Wrap(err, "failed to recover state")
+		c.setInitError(err)
+		return err
 	}
 
 	// Start event handler.
@@ -188,6 +259,7 @@ func (c *criService) Run() error {
 		c.snapshotStore,
 		c.client.SnapshotService(c.config.ContainerdConfig.Snapshotter),
 		time.Duration(c.config.StatsCollectPeriod)*time.Second,
+		c.config.StatsCollectJitter,
 	)
 	snapshotsSyncer.start()
 
@@ -199,6 +271,16 @@ func (c *criService) Run() error {
 		cniNetConfMonitorErrCh <- c.cniNetConfMonitor.syncLoop()
 	}()
 
+	// Start state dump signal handler.
+	logrus.Info("Start state dump handler")
+	c.startStateDumpHandler()
+
+	// Start profiling server if enabled. This is best effort, the CRI
+	// service keeps running without it.
+	if err := c.startProfilingServer(); err != nil {
+		logrus.WithError(err).Error("Failed to start profiling server")
+	}
+
 	// Start streaming server.
 	logrus.Info("Start streaming server")
 	streamServerErrCh := make(chan error)
@@ -259,10 +341,63 @@ func (c *criService) Run() error {
 	return nil
 }
 
+// defaultShutdownTimeout is the default maximum time to wait for in-flight
+// operations on shutdown.
+const defaultShutdownTimeout = 10 * time.Second
+
+// trackOperation registers an in-flight operation. The returned function must
+// be called when the operation finishes.
+func (c *criService) trackOperation() func() {
+	c.inflightOperations.Add(1)
+	return c.inflightOperations.Done
+}
+
+// waitInflightOperations waits for in-flight create/stop/remove operations to
+// finish, up to the configured shutdown timeout, so that shutdown does not
+// leave half-finished state behind.
+func (c *criService) waitInflightOperations() {
+	timeout := defaultShutdownTimeout
+	if c.config.ShutdownTimeout != "" {
+		// Validated when the config is loaded.
+		timeout, _ = time.ParseDuration(c.config.ShutdownTimeout)
+	}
+	doneCh := make(chan struct{})
+	go func() {
+		c.inflightOperations.Wait()
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+	case <-time.After(timeout):
+		logrus.Errorf("In-flight operations not finished in %v, proceeding with shutdown", timeout)
+	}
+}
+
+// setInitError records the last initialization error, so that Status can
+// report why the service is unavailable.
+func (c *criService) setInitError(err error) {
+	c.initErrMu.Lock()
+	defer c.initErrMu.Unlock()
+	c.initErr = err
+}
+
+// initError returns the last initialization error, or nil if initialization
+// succeeded.
+func (c *criService) initError() error {
+	c.initErrMu.Lock()
+	defer c.initErrMu.Unlock()
+	return c.initErr
+}
+
 // Close stops the CRI service.
 // TODO(random-liu): Make close synchronous.
 func (c *criService) Close() error {
 	logrus.Info("Stop CRI service")
+	c.waitInflightOperations()
+	if c.config.StopSandboxesOnShutdown {
+		logrus.Info("Stop tracked sandboxes before shutdown")
+		stopTrackedSandboxes(ctrdutil.NamespacedContext(), c.sandboxStore.List(), c.stopPodSandbox)
+	}
 	if err := c.cniNetConfMonitor.stop(); err != nil {
 		logrus.WithError(err).Error("failed to stop cni network conf monitor")
 	}
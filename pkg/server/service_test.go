@@ -21,11 +21,18 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/oci"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 
+	"github.com/containerd/cri/pkg/atomic"
 	criconfig "github.com/containerd/cri/pkg/config"
 	ostesting "github.com/containerd/cri/pkg/os/testing"
 	"github.com/containerd/cri/pkg/registrar"
@@ -67,6 +74,7 @@ func newTestCRIService() *criService {
 		containerStore:     containerstore.NewStore(labels),
 		containerNameIndex: registrar.NewRegistrar(),
 		netPlugin:          servertesting.NewFakeCNIPlugin(),
+		draining:           atomic.NewBool(false),
 	}
 }
 
@@ -100,3 +108,108 @@ func TestLoadBaseOCISpec(t *testing.T) {
 	assert.Equal(t, "1.0.2", out.Version)
 	assert.Equal(t, "default", out.Hostname)
 }
+
+func TestWaitInflightOperations(t *testing.T) {
+	t.Logf("should return immediately when there is no in-flight operation")
+	c := newTestCRIService()
+	c.waitInflightOperations()
+
+	t.Logf("should wait for in-flight operations to finish")
+	c = newTestCRIService()
+	done := c.trackOperation()
+	finished := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		done()
+		close(finished)
+	}()
+	c.waitInflightOperations()
+	select {
+	case <-finished:
+	default:
+		t.Errorf("in-flight operation should have finished before shutdown")
+	}
+
+	t.Logf("should give up after the shutdown timeout")
+	c = newTestCRIService()
+	c.config.ShutdownTimeout = "100ms"
+	c.trackOperation() // Never finished.
+	start := time.Now()
+	c.waitInflightOperations()
+	assert.WithinDuration(t, start.Add(100*time.Millisecond), time.Now(), time.Second)
+}
+
+func TestResourceLimits(t *testing.T) {
+	c := newTestCRIService()
+	ctx := context.Background()
+	c.config.MaxSandboxes = 1
+	c.config.MaxContainers = 1
+
+	t.Logf("creation beyond the sandbox limit should be rejected")
+	sandbox := sandboxstore.NewSandbox(
+		sandboxstore.Metadata{ID: "test-sandbox-id", Name: "test-sandbox-name"},
+		sandboxstore.Status{State: sandboxstore.StateReady},
+	)
+	require.NoError(t, c.sandboxStore.Add(sandbox))
+	_, err := c.RunPodSandbox(ctx, &runtime.RunPodSandboxRequest{})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	t.Logf("removing a sandbox should free a slot")
+	c.sandboxStore.Delete("test-sandbox-id")
+	assert.NoError(t, c.checkSandboxLimit())
+
+	t.Logf("creation beyond the container limit should be rejected")
+	container, err := containerstore.NewContainer(containerstore.Metadata{ID: "test-container-id"})
+	require.NoError(t, err)
+	require.NoError(t, c.containerStore.Add(container))
+	_, err = c.CreateContainer(ctx, &runtime.CreateContainerRequest{})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	t.Logf("removing a container should free a slot")
+	c.containerStore.Delete("test-container-id")
+	assert.NoError(t, c.checkContainerLimit())
+}
+
+func TestDrainMode(t *testing.T) {
+	c := newTestCRIService()
+	ctx := context.Background()
+	c.SetDrain(true)
+
+	t.Logf("new sandboxes should be rejected while draining")
+	_, err := c.RunPodSandbox(ctx, &runtime.RunPodSandboxRequest{})
+	assert.True(t, errdefs.IsUnavailable(err))
+
+	t.Logf("new containers should be rejected while draining")
+	_, err = c.CreateContainer(ctx, &runtime.CreateContainerRequest{})
+	assert.True(t, errdefs.IsUnavailable(err))
+
+	t.Logf("stopping sandboxes should still work while draining")
+	sandbox := sandboxstore.NewSandbox(
+		sandboxstore.Metadata{ID: "test-id", Name: "test-name"},
+		sandboxstore.Status{State: sandboxstore.StateNotReady},
+	)
+	require.NoError(t, c.sandboxStore.Add(sandbox))
+	_, err = c.StopPodSandbox(ctx, &runtime.StopPodSandboxRequest{PodSandboxId: "test-id"})
+	assert.NoError(t, err)
+
+	t.Logf("drain mode should be reported in status")
+	resp, err := c.Status(ctx, &runtime.StatusRequest{})
+	require.NoError(t, err)
+	var found bool
+	for _, cond := range resp.GetStatus().GetConditions() {
+		if cond.Type == "Draining" {
+			found = true
+			assert.True(t, cond.Status)
+			assert.Equal(t, drainingReason, cond.Reason)
+		}
+	}
+	assert.True(t, found, "draining condition should be reported")
+
+	t.Logf("draining condition should be cleared when drain is disabled")
+	c.SetDrain(false)
+	resp, err = c.Status(ctx, &runtime.StatusRequest{})
+	require.NoError(t, err)
+	for _, cond := range resp.GetStatus().GetConditions() {
+		assert.NotEqual(t, "Draining", cond.Type)
+	}
+}
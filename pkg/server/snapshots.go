@@ -18,6 +18,7 @@ package server
 
 import (
 	"context"
+	"math/rand"
 	"time"
 
 	"github.com/containerd/containerd/errdefs"
@@ -29,6 +30,11 @@ import (
 	snapshotstore "github.com/containerd/cri/pkg/store/snapshot"
 )
 
+// minSyncPeriod is the lower bound for the snapshots stats collection
+// period. Smaller periods would hammer the snapshotter with walk and
+// usage calls without making the cached stats meaningfully fresher.
+const minSyncPeriod = time.Second
+
 // snapshotsSyncer syncs snapshot stats periodically. imagefs info and container stats
 // should both use cached result here.
 // TODO(random-liu): Benchmark with high workload. We may need a statsSyncer instead if
@@ -37,15 +43,21 @@ type snapshotsSyncer struct {
 	store       *snapshotstore.Store
 	snapshotter snapshot.Snapshotter
 	syncPeriod  time.Duration
+	jitter      float64
 }
 
 // newSnapshotsSyncer creates a snapshot syncer.
 func newSnapshotsSyncer(store *snapshotstore.Store, snapshotter snapshot.Snapshotter,
-	period time.Duration) *snapshotsSyncer {
+	period time.Duration, jitter float64) *snapshotsSyncer {
+	if period > 0 && period < minSyncPeriod {
+		logrus.Warnf("Snapshot stats collection period %v is below the minimum %v, clamping up", period, minSyncPeriod)
+		period = minSyncPeriod
+	}
 	return &snapshotsSyncer{
 		store:       store,
 		snapshotter: snapshotter,
 		syncPeriod:  period,
+		jitter:      jitter,
 	}
 }
 
@@ -53,20 +65,34 @@ func newSnapshotsSyncer(store *snapshotstore.Store, snapshotter snapshot.Snapsho
 // the syncer doesn't update any persistent states, it's fine to let it
 // exit with the process.
 func (s *snapshotsSyncer) start() {
-	tick := time.NewTicker(s.syncPeriod)
+	if s.syncPeriod <= 0 {
+		logrus.Info("Snapshot stats collection is disabled")
+		return
+	}
+	logrus.Infof("Snapshot stats will be collected every %v", s.syncPeriod)
 	go func() {
-		defer tick.Stop()
 		// TODO(random-liu): This is expensive. We should do benchmark to
 		// check the resource usage and optimize this.
 		for {
 			if err := s.sync(); err != nil {
 				logrus.WithError(err).Error("Failed to sync snapshot stats")
 			}
-			<-tick.C
+			time.Sleep(s.nextInterval())
 		}
 	}()
 }
 
+// nextInterval returns the interval before the next stats collection,
+// randomized within period +/- period*jitter so that collection is not
+// synchronized across nodes started at the same time.
+func (s *snapshotsSyncer) nextInterval() time.Duration {
+	if s.jitter <= 0 {
+		return s.syncPeriod
+	}
+	factor := 1 + s.jitter*(2*rand.Float64()-1)
+	return time.Duration(float64(s.syncPeriod) * factor)
+}
+
 // sync updates all snapshots stats.
 func (s *snapshotsSyncer) sync() error {
 	ctx := ctrdutil.NamespacedContext()
@@ -0,0 +1,66 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	snapshotstore "github.com/containerd/cri/pkg/store/snapshot"
+)
+
+func TestSnapshotsSyncerDisabled(t *testing.T) {
+	// A non-positive period disables collection. The sync loop must not
+	// be started at all; it would panic on the nil snapshotter below.
+	for _, period := range []time.Duration{0, -time.Second} {
+		s := newSnapshotsSyncer(snapshotstore.NewStore(), nil, period, 0.1)
+		s.start()
+	}
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestSnapshotsSyncerMinimumPeriod(t *testing.T) {
+	t.Logf("a sub-minimum period should be clamped up to the minimum")
+	s := newSnapshotsSyncer(snapshotstore.NewStore(), nil, 100*time.Millisecond, 0)
+	assert.Equal(t, minSyncPeriod, s.syncPeriod)
+
+	t.Logf("a period at or above the minimum should be kept as is")
+	s = newSnapshotsSyncer(snapshotstore.NewStore(), nil, 10*time.Second, 0)
+	assert.Equal(t, 10*time.Second, s.syncPeriod)
+
+	t.Logf("a non-positive period should not be clamped, it disables collection")
+	s = newSnapshotsSyncer(snapshotstore.NewStore(), nil, 0, 0)
+	assert.Equal(t, time.Duration(0), s.syncPeriod)
+}
+
+func TestSnapshotsSyncerNextInterval(t *testing.T) {
+	const period = 10 * time.Second
+
+	t.Logf("no jitter should return the configured period")
+	s := newSnapshotsSyncer(snapshotstore.NewStore(), nil, period, 0)
+	assert.Equal(t, period, s.nextInterval())
+
+	t.Logf("jittered intervals should stay within the configured bounds")
+	s = newSnapshotsSyncer(snapshotstore.NewStore(), nil, period, 0.2)
+	for i := 0; i < 1000; i++ {
+		interval := s.nextInterval()
+		assert.True(t, interval >= 8*time.Second, "interval %v below lower bound", interval)
+		assert.True(t, interval <= 12*time.Second, "interval %v above upper bound", interval)
+	}
+}
@@ -29,6 +29,12 @@ import (
 // networkNotReadyReason is the reason reported when network is not ready.
 const networkNotReadyReason = "NetworkPluginNotReady"
 
+// drainingReason is the reason reported when the server is in drain mode.
+const drainingReason = "ServerDraining"
+
+// initErrorReason is the reason reported when initialization failed.
+const initErrorReason = "InitializationFailed"
+
 // Status returns the status of the runtime.
 func (c *criService) Status(ctx context.Context, r *runtime.StatusRequest) (*runtime.StatusResponse, error) {
 	// As a containerd plugin, if CRI plugin is serving request,
@@ -37,6 +43,13 @@ func (c *criService) Status(ctx context.Context, r *runtime.StatusRequest) (*run
 		Type:   runtime.RuntimeReady,
 		Status: true,
 	}
+	// Report the last initialization error, so that operators can see why
+	// the service is unavailable instead of just "not initialized".
+	if err := c.initError(); err != nil {
+		runtimeCondition.Status = false
+		runtimeCondition.Reason = initErrorReason
+		runtimeCondition.Message = fmt.Sprintf("Initialization returns error: %v", err)
+	}
 	networkCondition := &runtime.RuntimeCondition{
 		Type:   runtime.NetworkReady,
 		Status: true,
@@ -48,11 +61,26 @@ func (c *criService) Status(ctx context.Context, r *runtime.StatusRequest) (*run
 		networkCondition.Message = fmt.Sprintf("Network plugin returns error: %v", err)
 	}
 
+	conditions := []*runtime.RuntimeCondition{
+		runtimeCondition,
+		networkCondition,
+	}
+	// Report a degraded condition when the image filesystem is running
+	// out of bytes or inodes, before pulls and creates start failing.
+	if cond := c.imageFSCondition(ctx); cond != nil {
+		conditions = append(conditions, cond)
+	}
+	if c.draining.IsSet() {
+		conditions = append(conditions, &runtime.RuntimeCondition{
+			Type:    "Draining",
+			Status:  true,
+			Reason:  drainingReason,
+			Message: "Server is draining, new sandboxes and containers are rejected",
+		})
+	}
+
 	resp := &runtime.StatusResponse{
-		Status: &runtime.RuntimeStatus{Conditions: []*runtime.RuntimeCondition{
-			runtimeCondition,
-			networkCondition,
-		}},
+		Status: &runtime.RuntimeStatus{Conditions: conditions},
 	}
 	if r.Verbose {
 		configByt, err := json.Marshal(c.config)
@@ -78,6 +106,12 @@ func (c *criService) Status(ctx context.Context, r *runtime.StatusRequest) (*run
 			lastCNILoadStatus = lerr.Error()
 		}
 		resp.Info["lastCNILoadStatus"] = lastCNILoadStatus
+
+		lastInitStatus := "OK"
+		if ierr := c.initError(); ierr != nil {
+			lastInitStatus = ierr.Error()
+		}
+		resp.Info["lastInitStatus"] = lastInitStatus
 	}
 	return resp, nil
 }
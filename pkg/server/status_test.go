@@ -0,0 +1,56 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package server
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func getRuntimeCondition(t *testing.T, resp *runtime.StatusResponse, conditionType string) *runtime.RuntimeCondition {
+	for _, condition := range resp.GetStatus().GetConditions() {
+		if condition.GetType() == conditionType {
+			return condition
+		}
+	}
+	t.Fatalf("condition %q not found in status response", conditionType)
+	return nil
+}
+
+func TestStatusInitError(t *testing.T) {
+	c := newTestCRIService()
+
+	t.Logf("runtime should be ready when initialization succeeded")
+	resp, err := c.Status(context.Background(), &runtime.StatusRequest{})
+	require.NoError(t, err)
+	assert.True(t, getRuntimeCondition(t, resp, runtime.RuntimeReady).GetStatus())
+
+	t.Logf("the last initialization error should be reported in the runtime condition")
+	initErr := errors.New("failed to initialize networking")
+	c.setInitError(initErr)
+	resp, err = c.Status(context.Background(), &runtime.StatusRequest{})
+	require.NoError(t, err)
+	condition := getRuntimeCondition(t, resp, runtime.RuntimeReady)
+	assert.False(t, condition.GetStatus())
+	assert.Equal(t, initErrorReason, condition.GetReason())
+	assert.Contains(t, condition.GetMessage(), initErr.Error())
+}
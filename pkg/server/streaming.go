@@ -20,12 +20,16 @@ import (
 	"context"
 	"crypto/tls"
 	"io"
+	"io/ioutil"
 	"math"
 	"net"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	k8snet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/tools/remotecommand"
@@ -82,7 +86,34 @@ func newStreamServer(c *criService, addr, port, streamIdleTimeout string) (strea
 			return nil, errors.Wrap(err, "invalid stream idle timeout")
 		}
 	}
+	if port == "0" {
+		// Pick an ephemeral port up front so that the port is known before
+		// the server starts serving, keeping the redirect URLs handed to
+		// kubelet correct.
+		l, err := net.Listen("tcp", net.JoinHostPort(addr, "0"))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to pick ephemeral stream server port")
+		}
+		port = strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+		if err := l.Close(); err != nil {
+			return nil, errors.Wrap(err, "failed to release ephemeral stream server port")
+		}
+		// Persist the chosen port so that the config reported by `Status`
+		// reflects the port actually in use.
+		c.config.StreamServerPort = port
+		logrus.Infof("Stream server is using ephemeral port %s", port)
+	}
 	config.Addr = net.JoinHostPort(addr, port)
+	if c.config.StreamAuthTokenFile != "" {
+		token, err := ioutil.ReadFile(c.config.StreamAuthTokenFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read stream auth token file")
+		}
+		config.AuthToken = strings.TrimSpace(string(token))
+		if config.AuthToken == "" {
+			return nil, errors.Errorf("stream auth token file %q is empty", c.config.StreamAuthTokenFile)
+		}
+	}
 	run := newStreamRuntime(c)
 	tlsMode, err := getStreamListenerMode(c)
 	if err != nil {
@@ -17,10 +17,22 @@
 package server
 
 import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/containerd/cri/pkg/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8scert "k8s.io/client-go/util/cert"
+	runtime "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
 )
 
 func TestValidateStreamServer(t *testing.T) {
@@ -151,3 +163,135 @@ func TestValidateStreamServer(t *testing.T) {
 		})
 	}
 }
+
+func TestNewStreamServerAuthTokenFile(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "stream-auth-token")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	newService := func(tokenFile string) *criService {
+		return &criService{
+			config: config.Config{
+				PluginConfig: config.PluginConfig{
+					StreamAuthTokenFile: tokenFile,
+				},
+			},
+		}
+	}
+
+	t.Logf("a missing token file should be rejected")
+	_, err = newStreamServer(newService(filepath.Join(tmpDir, "missing")), "127.0.0.1", "0", "")
+	assert.Error(t, err)
+
+	t.Logf("an empty token file should be rejected")
+	emptyFile := filepath.Join(tmpDir, "empty")
+	require.NoError(t, ioutil.WriteFile(emptyFile, []byte("\n"), 0600))
+	_, err = newStreamServer(newService(emptyFile), "127.0.0.1", "0", "")
+	assert.Error(t, err)
+
+	t.Logf("a token file with surrounding whitespace should be accepted")
+	tokenFile := filepath.Join(tmpDir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("stream-token\n"), 0600))
+	_, err = newStreamServer(newService(tokenFile), "127.0.0.1", "0", "")
+	assert.NoError(t, err)
+}
+
+func TestNewStreamServerEphemeralPort(t *testing.T) {
+	c := &criService{
+		config: config.Config{
+			PluginConfig: config.PluginConfig{
+				StreamServerPort: "0",
+			},
+		},
+	}
+	s, err := newStreamServer(c, "127.0.0.1", c.config.StreamServerPort, "")
+	require.NoError(t, err)
+
+	t.Logf("the chosen ephemeral port should be persisted in the config")
+	require.NotEqual(t, "0", c.config.StreamServerPort)
+	port, err := strconv.Atoi(c.config.StreamServerPort)
+	require.NoError(t, err)
+	assert.True(t, port > 0)
+
+	t.Logf("redirect URLs should use the chosen port")
+	resp, err := s.GetPortForward(&runtime.PortForwardRequest{
+		PodSandboxId: "test-sandbox",
+		Port:         []int32{8080},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, resp.Url, ":"+c.config.StreamServerPort)
+}
+
+func TestStreamServerTLSAndAuth(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "stream-server-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	certPem, keyPem, err := k8scert.GenerateSelfSignedCertKey("localhost", []net.IP{net.ParseIP("127.0.0.1")}, nil)
+	require.NoError(t, err)
+	certFile := filepath.Join(tmpDir, "stream.crt")
+	keyFile := filepath.Join(tmpDir, "stream.key")
+	tokenFile := filepath.Join(tmpDir, "token")
+	require.NoError(t, ioutil.WriteFile(certFile, certPem, 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, keyPem, 0600))
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("stream-token\n"), 0600))
+
+	c := &criService{
+		config: config.Config{
+			PluginConfig: config.PluginConfig{
+				EnableTLSStreaming: true,
+				X509KeyPairStreaming: config.X509KeyPairStreaming{
+					TLSCertFile: certFile,
+					TLSKeyFile:  keyFile,
+				},
+				StreamAuthTokenFile: tokenFile,
+			},
+		},
+	}
+
+	// Reserve a free port for the stream server.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := fmt.Sprintf("%d", l.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, l.Close())
+
+	s, err := newStreamServer(c, "127.0.0.1", port, "")
+	require.NoError(t, err)
+	go s.Start(true) // nolint: errcheck
+	defer s.Stop()   // nolint: errcheck
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	url := fmt.Sprintf("https://127.0.0.1:%s/exec/unknown", port)
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		resp, err = client.Get(url)
+		if err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	require.NoError(t, err, "stream server did not come up")
+
+	t.Logf("a request without the bearer token should be rejected")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	t.Logf("a request with the bearer token should reach the stream handler")
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer stream-token")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	assert.NotEqual(t, http.StatusUnauthorized, resp.StatusCode)
+	resp.Body.Close()
+
+	t.Logf("a plain http connection should be rejected by the TLS listener")
+	resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%s/exec/unknown", port))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+}
@@ -18,6 +18,7 @@ package testing
 
 import (
 	"context"
+	"time"
 
 	cni "github.com/containerd/go-cni"
 )
@@ -26,6 +27,12 @@ import (
 type FakeCNIPlugin struct {
 	StatusErr error
 	LoadErr   error
+	// SetupDelay is an artificial delay applied to Setup.
+	SetupDelay time.Duration
+	// SetupResult is the result returned by Setup.
+	SetupResult *cni.CNIResult
+	// RemoveDelay is an artificial delay applied to Remove.
+	RemoveDelay time.Duration
 }
 
 // NewFakeCNIPlugin create a FakeCNIPlugin.
@@ -35,11 +42,17 @@ func NewFakeCNIPlugin() *FakeCNIPlugin {
 
 // Setup setups the network of PodSandbox.
 func (f *FakeCNIPlugin) Setup(ctx context.Context, id, path string, opts ...cni.NamespaceOpts) (*cni.CNIResult, error) {
-	return nil, nil
+	if f.SetupDelay > 0 {
+		time.Sleep(f.SetupDelay)
+	}
+	return f.SetupResult, nil
 }
 
 // Remove teardown the network of PodSandbox.
 func (f *FakeCNIPlugin) Remove(ctx context.Context, id, path string, opts ...cni.NamespaceOpts) error {
+	if f.RemoveDelay > 0 {
+		time.Sleep(f.RemoveDelay)
+	}
 	return nil
 }
 
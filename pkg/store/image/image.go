@@ -54,6 +54,10 @@ type Store struct {
 	lock sync.RWMutex
 	// refCache is a containerd image reference to image id cache.
 	refCache map[string]string
+	// configCache is a cache of decoded image configs keyed by image id,
+	// so that repeated updates for the same image skip content store
+	// round-trips. Entries are removed when the image is removed.
+	configCache map[string]imagespec.Image
 	// client is the containerd client.
 	client *containerd.Client
 	// store is the internal image store indexed by image id.
@@ -63,8 +67,9 @@ type Store struct {
 // NewStore creates an image store.
 func NewStore(client *containerd.Client) *Store {
 	return &Store{
-		refCache: make(map[string]string),
-		client:   client,
+		refCache:    make(map[string]string),
+		configCache: make(map[string]imagespec.Image),
+		client:      client,
 		store: &store{
 			images:    make(map[string]Image),
 			digestSet: digestset.NewSet(),
@@ -82,7 +87,7 @@ func (s *Store) Update(ctx context.Context, ref string) error {
 	}
 	var img *Image
 	if err == nil {
-		img, err = getImage(ctx, i)
+		img, err = s.getImage(ctx, i)
 		if err != nil {
 			return errors.Wrap(err, "get image info from containerd")
 		}
@@ -98,7 +103,7 @@ func (s *Store) update(ref string, img *Image) error {
 		// The image reference doesn't exist in containerd.
 		if oldExist {
 			// Remove the reference from the store.
-			s.store.delete(oldID, ref)
+			s.delete(oldID, ref)
 			delete(s.refCache, ref)
 		}
 		return nil
@@ -108,15 +113,25 @@ func (s *Store) update(ref string, img *Image) error {
 			return nil
 		}
 		// Updated. Remove tag from old image.
-		s.store.delete(oldID, ref)
+		s.delete(oldID, ref)
 	}
 	// New image. Add new image.
 	s.refCache[ref] = img.ID
 	return s.store.add(*img)
 }
 
+// delete deletes the image reference from the internal store, and drops
+// the cached image config once the image is not referenced any more, so
+// that a removed and re-pulled image is decoded from fresh content.
+func (s *Store) delete(id, ref string) {
+	s.store.delete(id, ref)
+	if _, err := s.store.get(id); err != nil {
+		delete(s.configCache, id)
+	}
+}
+
 // getImage gets image information from containerd.
-func getImage(ctx context.Context, i containerd.Image) (*Image, error) {
+func (s *Store) getImage(ctx context.Context, i containerd.Image) (*Image, error) {
 	// Get image information.
 	diffIDs, err := i.RootFS(ctx)
 	if err != nil {
@@ -135,13 +150,9 @@ func getImage(ctx context.Context, i containerd.Image) (*Image, error) {
 	}
 	id := desc.Digest.String()
 
-	rb, err := content.ReadBlob(ctx, i.ContentStore(), desc)
+	ociimage, err := s.decodeImageConfig(ctx, i.ContentStore(), desc)
 	if err != nil {
-		return nil, errors.Wrap(err, "read image config from content store")
-	}
-	var ociimage imagespec.Image
-	if err := json.Unmarshal(rb, &ociimage); err != nil {
-		return nil, errors.Wrapf(err, "unmarshal image config %s", rb)
+		return nil, err
 	}
 
 	return &Image{
@@ -153,6 +164,26 @@ func getImage(ctx context.Context, i containerd.Image) (*Image, error) {
 	}, nil
 }
 
+// decodeImageConfig decodes the image config described by desc, using the
+// cached copy from a previous decode when available. The config digest is
+// the image id, so a cached entry can never be stale for that id.
+func (s *Store) decodeImageConfig(ctx context.Context, provider content.Provider, desc imagespec.Descriptor) (imagespec.Image, error) {
+	id := desc.Digest.String()
+	if config, ok := s.configCache[id]; ok {
+		return config, nil
+	}
+	rb, err := content.ReadBlob(ctx, provider, desc)
+	if err != nil {
+		return imagespec.Image{}, errors.Wrap(err, "read image config from content store")
+	}
+	var ociimage imagespec.Image
+	if err := json.Unmarshal(rb, &ociimage); err != nil {
+		return imagespec.Image{}, errors.Wrapf(err, "unmarshal image config %s", rb)
+	}
+	s.configCache[id] = ociimage
+	return ociimage, nil
+}
+
 // Resolve resolves a image reference to image id.
 func (s *Store) Resolve(ref string) (string, error) {
 	s.lock.RLock()
@@ -17,12 +17,19 @@
 package image
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"sort"
 	"strings"
 	"testing"
 
+	"github.com/containerd/containerd/content"
+	imagedigest "github.com/opencontainers/go-digest"
 	"github.com/opencontainers/go-digest/digestset"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
 	assertlib "github.com/stretchr/testify/assert"
+	requirelib "github.com/stretchr/testify/require"
 
 	storeutil "github.com/containerd/cri/pkg/store"
 )
@@ -246,3 +253,67 @@ func TestImageStore(t *testing.T) {
 		}
 	}
 }
+
+// fakeConfigProvider is a content provider which serves a single config
+// blob and counts how many times it is read.
+type fakeConfigProvider struct {
+	blob  []byte
+	reads int
+}
+
+func (p *fakeConfigProvider) ReaderAt(ctx context.Context, desc imagespec.Descriptor) (content.ReaderAt, error) {
+	p.reads++
+	return &fakeReaderAt{Reader: bytes.NewReader(p.blob), size: int64(len(p.blob))}, nil
+}
+
+type fakeReaderAt struct {
+	*bytes.Reader
+	size int64
+}
+
+func (r *fakeReaderAt) Size() int64 { return r.size }
+
+func (r *fakeReaderAt) Close() error { return nil }
+
+func TestImageConfigCache(t *testing.T) {
+	assert := assertlib.New(t)
+	require := requirelib.New(t)
+	config := imagespec.Image{
+		Config: imagespec.ImageConfig{
+			User:       "user",
+			WorkingDir: "/workdir",
+		},
+	}
+	blob, err := json.Marshal(config)
+	require.NoError(err)
+	desc := imagespec.Descriptor{
+		MediaType: imagespec.MediaTypeImageConfig,
+		Digest:    imagedigest.FromBytes(blob),
+		Size:      int64(len(blob)),
+	}
+	id := desc.Digest.String()
+	ref := "ref-1"
+	provider := &fakeConfigProvider{blob: blob}
+	s := NewStore(nil)
+
+	t.Logf("the first decode should read the config from the content store")
+	got, err := s.decodeImageConfig(context.Background(), provider, desc)
+	require.NoError(err)
+	assert.Equal(config, got)
+	assert.Equal(1, provider.reads)
+
+	t.Logf("the second decode for the same image should be served from cache")
+	got, err = s.decodeImageConfig(context.Background(), provider, desc)
+	require.NoError(err)
+	assert.Equal(config, got)
+	assert.Equal(1, provider.reads)
+
+	t.Logf("removing the image should invalidate the cached config")
+	require.NoError(s.store.add(Image{ID: id, References: []string{ref}, ImageSpec: config}))
+	s.refCache[ref] = id
+	s.delete(id, ref)
+	got, err = s.decodeImageConfig(context.Background(), provider, desc)
+	require.NoError(err)
+	assert.Equal(config, got)
+	assert.Equal(2, provider.reads)
+}
@@ -33,6 +33,7 @@ limitations under the License.
 package streaming
 
 import (
+	"crypto/subtle"
 	"crypto/tls"
 	"errors"
 	"io"
@@ -109,6 +110,11 @@ type Config struct {
 
 	// The config for serving over TLS. If nil, TLS will not be used.
 	TLSConfig *tls.Config
+
+	// The optional bearer token clients must present in the Authorization
+	// header. If set, requests without a matching token are rejected with
+	// 401 Unauthorized.
+	AuthToken string
 }
 
 // DefaultConfig provides default values for server Config. The DefaultConfig is partial, so
@@ -161,6 +167,9 @@ func NewServer(config Config, runtime Runtime) (Server, error) {
 	handler := restful.NewContainer()
 	handler.Add(ws)
 	s.handler = handler
+	if s.config.AuthToken != "" {
+		s.handler = authenticated(s.handler, s.config.AuthToken)
+	}
 	s.server = &http.Server{
 		Addr:      s.config.Addr,
 		Handler:   s.handler,
@@ -273,6 +282,20 @@ func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.handler.ServeHTTP(w, r)
 }
 
+// authenticated wraps handler to reject requests which do not present the
+// expected bearer token in the Authorization header.
+func authenticated(handler http.Handler, token string) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, expected) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
 func (s *server) buildURL(method, token string) string {
 	return s.config.BaseURL.ResolveReference(&url.URL{
 		Path: path.Join(method, token),